@@ -0,0 +1,25 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/qri-io/startf/dap"
+)
+
+func runDebug(args []string) error {
+	fs := newFlagSet("debug", "[transform.star]")
+	addr := fs.String("addr", "127.0.0.1:4711", "address to listen for a debug adapter protocol client on")
+	fs.Parse(args)
+
+	s := &dap.Server{Program: fs.Arg(0)}
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+
+	fmt.Fprintf(os.Stderr, "waiting for a debugger to attach on %s\n", ln.Addr())
+	return s.Serve(ln)
+}
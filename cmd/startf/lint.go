@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/qri-io/qfs"
+	"github.com/qri-io/startf"
+)
+
+func runLint(args []string) error {
+	fs := newFlagSet("lint", "transform.star [transform.star ...]")
+	noFloat := fs.Bool("no-float", false, "disallow floating point numbers")
+	noSet := fs.Bool("no-set", false, "disallow the set data type")
+	noLambda := fs.Bool("no-lambda", false, "disallow lambda expressions")
+	nestedDef := fs.Bool("nested-def", false, "allow nested def statements")
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("at least one script path is required")
+	}
+
+	opt := func(o *startf.ExecOpts) {
+		o.AllowFloat = !*noFloat
+		o.AllowSet = !*noSet
+		o.AllowLambda = !*noLambda
+		o.AllowNestedDef = *nestedDef
+	}
+
+	found := 0
+	for _, path := range fs.Args() {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		issues, err := startf.Lint(qfs.NewMemfileBytes(path, data), opt)
+		if err != nil {
+			return err
+		}
+		for _, issue := range issues {
+			fmt.Printf("%s:%s\n", path, issue)
+		}
+		found += len(issues)
+	}
+
+	if found > 0 {
+		return errFailed
+	}
+	return nil
+}
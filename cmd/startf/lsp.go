@@ -0,0 +1,14 @@
+package main
+
+import (
+	"os"
+
+	"github.com/qri-io/startf/lsp"
+)
+
+func runLsp(args []string) error {
+	fs := newFlagSet("lsp", "")
+	fs.Parse(args)
+
+	return lsp.NewServer().Serve(os.Stdin, os.Stdout)
+}
@@ -0,0 +1,83 @@
+// Command startf is a command line tool for working with starlark transform scripts
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// command is a startf subcommand
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands = []command{
+	{"test", "run test_* functions in a transform's test file", runTest},
+	{"lint", "check transform scripts for problems without running them", runLint},
+	{"debug", "serve the debug adapter protocol for editors to debug a transform", runDebug},
+	{"lsp", "serve the language server protocol over stdio for editors", runLsp},
+	{"repl", "explore a dataset & prototype transform code interactively", runRepl},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == os.Args[1] {
+			if err := cmd.run(os.Args[2:]); err != nil {
+				if err != errFailed {
+					fmt.Fprintln(os.Stderr, err)
+				}
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "unknown command: %s\n", os.Args[1])
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: startf <command> [arguments]\n\ncommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", cmd.name, cmd.usage)
+	}
+}
+
+// errFailed signals a command failed after reporting its own output
+var errFailed = fmt.Errorf("failed")
+
+// newFlagSet creates a flag set for a subcommand
+func newFlagSet(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: startf %s [flags] %s\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// keyValues collects repeated key=value flags
+type keyValues map[string]interface{}
+
+func (kv keyValues) String() string {
+	return fmt.Sprintf("%v", map[string]interface{}(kv))
+}
+
+func (kv keyValues) Set(s string) error {
+	i := strings.Index(s, "=")
+	if i < 1 {
+		return fmt.Errorf("expected key=value, got: %q", s)
+	}
+	kv[s[:i]] = s[i+1:]
+	return nil
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/qri-io/dataset"
+	"github.com/qri-io/startf"
+	"go.starlark.net/repl"
+)
+
+func runRepl(args []string) error {
+	fs := newFlagSet("repl", "")
+	prevPath := fs.String("prev", "", "JSON dataset file to bind to ds as the previous version")
+	config := keyValues{}
+	fs.Var(config, "config", "transform config value as key=value, available with ctx.get_config. may be repeated")
+	secrets := keyValues{}
+	fs.Var(secrets, "secret", "secret as key=value, available with ctx.get_secret. may be repeated")
+	fs.Parse(args)
+
+	var prev *dataset.Dataset
+	if *prevPath != "" {
+		var err error
+		if prev, err = startf.LoadDatasetFile(*prevPath); err != nil {
+			return err
+		}
+	}
+
+	thread, globals := startf.NewREPL(nil, prev, config, startf.SetOutWriter(os.Stdout), func(o *startf.ExecOpts) {
+		o.Secrets = secrets
+	})
+
+	fmt.Println("startf repl. ds & ctx are bound to the transform's dataset & context. ctrl-d to exit")
+	repl.REPL(thread, globals)
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/qri-io/dataset"
+	"github.com/qri-io/startf"
+	"github.com/qri-io/startf/golden"
+)
+
+func runTest(args []string) error {
+	fs := newFlagSet("test", "transform.star")
+	testPath := fs.String("file", "", "path to test file. defaults to the script path with a _test suffix")
+	junitPath := fs.String("junit", "", "write JUnit XML results to this path")
+	goldenDir := fs.String("golden", "", "compare transform output to golden files in this directory")
+	update := fs.Bool("update", false, "write golden files instead of comparing against them")
+	prevPath := fs.String("prev", "", "JSON dataset file to use as the previous version in golden comparisons")
+	config := keyValues{}
+	fs.Var(config, "config", "transform config value as key=value for golden comparisons, available with ctx.get_config. may be repeated")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("a transform script path is required")
+	}
+	scriptPath := fs.Arg(0)
+
+	passed := true
+	if *goldenDir == "" || *testPath != "" || exists(startf.TestFilePath(scriptPath)) {
+		res, err := startf.RunTests(scriptPath, *testPath)
+		if err != nil {
+			return err
+		}
+		if err := res.WriteGoTest(os.Stdout); err != nil {
+			return err
+		}
+		if *junitPath != "" {
+			if err := writeJUnit(res, *junitPath); err != nil {
+				return err
+			}
+		}
+		passed = res.Passed()
+	}
+
+	if *goldenDir != "" {
+		ok, err := checkGolden(scriptPath, *goldenDir, *prevPath, config, *update)
+		if err != nil {
+			return err
+		}
+		passed = passed && ok
+	}
+
+	if !passed {
+		return errFailed
+	}
+	return nil
+}
+
+func writeJUnit(res *startf.TestResults, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return res.WriteJUnit(f)
+}
+
+// checkGolden runs a script & compares the output to golden files, printing
+// any differences
+func checkGolden(scriptPath, dir, prevPath string, config map[string]interface{}, update bool) (bool, error) {
+	var prev *dataset.Dataset
+	if prevPath != "" {
+		var err error
+		if prev, err = startf.LoadDatasetFile(prevPath); err != nil {
+			return false, err
+		}
+	}
+
+	name := strings.TrimSuffix(filepath.Base(scriptPath), filepath.Ext(scriptPath))
+	ds, err := golden.Case{Name: name, Script: scriptPath, Prev: prev, Config: config}.Run()
+	if err != nil {
+		return false, err
+	}
+
+	diffs, err := golden.Compare(dir, name, ds, update)
+	if err != nil {
+		return false, err
+	}
+	if update {
+		fmt.Printf("updated golden files for %s in %s\n", name, dir)
+		return true, nil
+	}
+	for _, d := range diffs {
+		fmt.Println(d)
+	}
+	if len(diffs) > 0 {
+		fmt.Printf("FAIL\tgolden %s\t%d differences\n", name, len(diffs))
+		return false, nil
+	}
+	fmt.Printf("ok  \tgolden %s\n", name)
+	return true, nil
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -15,6 +15,8 @@ type Context struct {
 	values  starlark.StringDict
 	config  map[string]interface{}
 	secrets map[string]interface{}
+	// secretsDisabled blocks access to secrets when true
+	secretsDisabled bool
 }
 
 // NewContext creates a new contex
@@ -49,6 +51,16 @@ func (c *Context) SetResult(name string, value starlark.Value) {
 	c.results[name] = value
 }
 
+// EnableSecrets allows calls to get_secret
+func (c *Context) EnableSecrets() {
+	c.secretsDisabled = false
+}
+
+// DisableSecrets causes calls to get_secret to fail
+func (c *Context) DisableSecrets() {
+	c.secretsDisabled = true
+}
+
 func (c *Context) setValue(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
 	var (
 		key   starlark.String
@@ -75,6 +87,9 @@ func (c *Context) getValue(thread *starlark.Thread, _ *starlark.Builtin, args st
 
 // GetSecret fetches a secret for a given string
 func (c *Context) GetSecret(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if c.secretsDisabled {
+		return starlark.None, fmt.Errorf("secrets are not available in this step")
+	}
 	if c.secrets == nil {
 		return starlark.None, fmt.Errorf("no secrets provided")
 	}
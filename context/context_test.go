@@ -83,3 +83,30 @@ func newLoader() func(thread *starlark.Thread, module string) (starlark.StringDi
 		return nil, fmt.Errorf("invalid module")
 	}
 }
+
+func TestDisableSecrets(t *testing.T) {
+	thread := &starlark.Thread{}
+	ctx := NewContext(nil, map[string]interface{}{"foo": "bar"})
+	ctx.DisableSecrets()
+
+	_, err := ctx.GetSecret(thread, nil, starlark.Tuple{starlark.String("foo")}, nil)
+	expect := "secrets are not available in this step"
+	if err == nil || err.Error() != expect {
+		t.Errorf("error message mismatch. expected: %s, got: %v", expect, err)
+	}
+
+	ctx.EnableSecrets()
+	val, err := ctx.GetSecret(thread, nil, starlark.Tuple{starlark.String("foo")}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val != starlark.String("bar") {
+		t.Errorf("expected secret value 'bar', got: %s", val)
+	}
+	// disabled secrets error the same way whether or not any are provided
+	ctx = NewContext(nil, nil)
+	ctx.DisableSecrets()
+	if _, err := ctx.GetSecret(thread, nil, starlark.Tuple{starlark.String("foo")}, nil); err == nil || err.Error() != expect {
+		t.Errorf("error message mismatch. expected: %s, got: %v", expect, err)
+	}
+}
@@ -0,0 +1,22 @@
+/*Package context defines the transformation context object within starlark
+
+  outline: context
+    context carries values across special function calls in a transformation.
+    the context is passed to each special function as the ctx argument
+
+    types:
+      Context
+        a transformation context. The return value of each special function is
+        available on the context by name, eg: ctx.download
+        methods:
+          get_config(key string) value|None
+            get a value from the transform configuration by key
+          get_secret(key string) value|None
+            get a secret value by key. secrets are only available in steps that
+            allow them
+          set(key string, value)
+            store a value on the context for use in later steps
+          get(key string) value
+            get a value stored with set, erroring if key isn't set
+*/
+package context
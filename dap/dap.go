@@ -0,0 +1,470 @@
+// Package dap serves the Debug Adapter Protocol for transform scripts, letting
+// editors set breakpoints, step through scripts & inspect variables. Only a single
+// thread is supported, and variables can't be expanded
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"sync"
+
+	"github.com/qri-io/dataset"
+	"github.com/qri-io/qfs"
+	"github.com/qri-io/startf"
+	"github.com/qri-io/startf/internal/framing"
+)
+
+const (
+	// threadID is the id of the only thread
+	threadID = 1
+	// variable references for scopes
+	localsRef  = 1
+	globalsRef = 2
+)
+
+// Server runs debug sessions
+type Server struct {
+	// Program is the script to debug if a launch request doesn't name one
+	Program string
+	// Opts are passed to ExecScript
+	Opts []func(o *startf.ExecOpts)
+}
+
+// Serve accepts a single connection from ln & serves a debug session on it
+func (s *Server) Serve(ln net.Listener) error {
+	conn, err := ln.Accept()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return s.ServeConn(conn)
+}
+
+// ServeConn serves a debug session, returning when the client disconnects
+func (s *Server) ServeConn(rw io.ReadWriter) error {
+	sess := &session{
+		server:   s,
+		w:        rw,
+		program:  s.Program,
+		debugger: startf.NewDebugger(),
+		closed:   make(chan struct{}),
+	}
+	defer sess.close()
+
+	r := bufio.NewReader(rw)
+	for {
+		data, err := framing.Read(r)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		req := &request{}
+		if err := json.Unmarshal(data, req); err != nil {
+			return fmt.Errorf("decoding request: %s", err)
+		}
+		if req.Type != "request" {
+			continue
+		}
+		if done := sess.handle(req); done {
+			return nil
+		}
+	}
+}
+
+type request struct {
+	Seq       int             `json:"seq"`
+	Type      string          `json:"type"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments"`
+}
+
+type response struct {
+	Seq        int         `json:"seq"`
+	Type       string      `json:"type"`
+	RequestSeq int         `json:"request_seq"`
+	Command    string      `json:"command"`
+	Success    bool        `json:"success"`
+	Message    string      `json:"message,omitempty"`
+	Body       interface{} `json:"body,omitempty"`
+}
+
+type event struct {
+	Seq   int         `json:"seq"`
+	Type  string      `json:"type"`
+	Event string      `json:"event"`
+	Body  interface{} `json:"body,omitempty"`
+}
+
+type launchArgs struct {
+	Program     string                 `json:"program"`
+	StopOnEntry bool                   `json:"stopOnEntry"`
+	Config      map[string]interface{} `json:"config"`
+}
+
+type setBreakpointsArgs struct {
+	Source struct {
+		Path string `json:"path"`
+	} `json:"source"`
+	Breakpoints []struct {
+		Line int `json:"line"`
+	} `json:"breakpoints"`
+}
+
+type scopesArgs struct {
+	FrameID int `json:"frameId"`
+}
+
+type variablesArgs struct {
+	VariablesReference int `json:"variablesReference"`
+}
+
+type session struct {
+	server   *Server
+	debugger *startf.Debugger
+	program  string
+	config   map[string]interface{}
+	closed   chan struct{}
+
+	wlock sync.Mutex
+	w     io.Writer
+	seq   int
+
+	lock    sync.Mutex
+	stop    *startf.DebugStop
+	running bool
+}
+
+// handle responds to a request, returning true when the session is over
+func (s *session) handle(req *request) (done bool) {
+	var (
+		body interface{}
+		err  error
+	)
+
+	switch req.Command {
+	case "initialize":
+		body = map[string]interface{}{"supportsConfigurationDoneRequest": true}
+		s.respond(req, body, nil)
+		s.event("initialized", nil)
+		return false
+	case "launch":
+		err = s.launch(req.Arguments)
+	case "setBreakpoints":
+		body, err = s.setBreakpoints(req.Arguments)
+	case "configurationDone":
+		err = s.start()
+	case "threads":
+		body = map[string]interface{}{
+			"threads": []map[string]interface{}{{"id": threadID, "name": "transform"}},
+		}
+	case "stackTrace":
+		body, err = s.stackTrace()
+	case "scopes":
+		body, err = s.scopes(req.Arguments)
+	case "variables":
+		body, err = s.variables(req.Arguments)
+	case "continue":
+		body = map[string]interface{}{"allThreadsContinued": true}
+		err = s.resume(s.debugger.Continue)
+	case "next":
+		err = s.resume(s.debugger.StepOver)
+	case "stepIn":
+		err = s.resume(s.debugger.StepInto)
+	case "stepOut":
+		err = s.resume(s.debugger.StepOut)
+	case "disconnect":
+		s.respond(req, nil, nil)
+		return true
+	default:
+		err = fmt.Errorf("unsupported command: %s", req.Command)
+	}
+
+	s.respond(req, body, err)
+	return false
+}
+
+func (s *session) launch(data json.RawMessage) error {
+	args := &launchArgs{}
+	if err := unmarshalArgs(data, args); err != nil {
+		return err
+	}
+	if args.Program != "" {
+		s.program = args.Program
+	}
+	if s.program == "" {
+		return fmt.Errorf("launch: no program to debug")
+	}
+	abs, err := filepath.Abs(s.program)
+	if err != nil {
+		return err
+	}
+	s.program = abs
+	s.config = args.Config
+	s.debugger.StopOnEntry = args.StopOnEntry
+	return nil
+}
+
+func (s *session) setBreakpoints(data json.RawMessage) (interface{}, error) {
+	args := &setBreakpointsArgs{}
+	if err := unmarshalArgs(data, args); err != nil {
+		return nil, err
+	}
+
+	path, err := filepath.Abs(args.Source.Path)
+	if err != nil {
+		return nil, err
+	}
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// only lines the debugger can stop on are verified
+	stoppable := map[int]bool{}
+	reason := "breakpoints can only be set on lines that start a simple statement"
+	if lines, err := startf.BreakpointLines(path, src); err != nil {
+		reason = fmt.Sprintf("script doesn't parse: %s", err)
+	} else {
+		for _, l := range lines {
+			stoppable[l] = true
+		}
+	}
+
+	var lines []int
+	bps := make([]map[string]interface{}, len(args.Breakpoints))
+	for i, bp := range args.Breakpoints {
+		bps[i] = map[string]interface{}{"verified": stoppable[bp.Line], "line": bp.Line}
+		if stoppable[bp.Line] {
+			lines = append(lines, bp.Line)
+		} else {
+			bps[i]["message"] = reason
+		}
+	}
+	s.debugger.SetBreakpoints(path, lines)
+	return map[string]interface{}{"breakpoints": bps}, nil
+}
+
+// start runs the script in the background, reporting stops as events
+func (s *session) start() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.running {
+		return fmt.Errorf("script is already running")
+	}
+	if s.program == "" {
+		return fmt.Errorf("no program to debug, send a launch request first")
+	}
+	s.running = true
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.exec()
+	}()
+	go s.watch(done)
+	return nil
+}
+
+func (s *session) exec() error {
+	data, err := ioutil.ReadFile(s.program)
+	if err != nil {
+		return err
+	}
+	ds := &dataset.Dataset{Transform: &dataset.Transform{Config: s.config}}
+	ds.Transform.SetScriptFile(qfs.NewMemfileBytes(s.program, data))
+
+	opts := append([]func(o *startf.ExecOpts){}, s.server.Opts...)
+	opts = append(opts, startf.SetDebugger(s.debugger), startf.SetOutWriter(outputWriter{s}))
+	return startf.ExecScript(ds, nil, opts...)
+}
+
+// watch reports stops until the script finishes. Once the session is closed
+// stops are resumed without reporting them
+func (s *session) watch(done chan error) {
+	for {
+		select {
+		case stop := <-s.debugger.Stops():
+			select {
+			case <-s.closed:
+				s.debugger.Continue()
+				continue
+			default:
+			}
+			s.lock.Lock()
+			s.stop = stop
+			s.lock.Unlock()
+			s.event("stopped", map[string]interface{}{
+				"reason":            stop.Reason,
+				"threadId":          threadID,
+				"allThreadsStopped": true,
+			})
+		case err := <-done:
+			code := 0
+			if err != nil {
+				code = 1
+				s.event("output", map[string]interface{}{"category": "stderr", "output": err.Error() + "\n"})
+			}
+			s.lock.Lock()
+			s.running, s.stop = false, nil
+			s.lock.Unlock()
+			s.event("exited", map[string]interface{}{"exitCode": code})
+			s.event("terminated", nil)
+			return
+		}
+	}
+}
+
+func (s *session) stopped() (*startf.DebugStop, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.stop == nil {
+		return nil, fmt.Errorf("script is not stopped")
+	}
+	return s.stop, nil
+}
+
+func (s *session) resume(step func()) error {
+	if _, err := s.stopped(); err != nil {
+		return err
+	}
+	s.lock.Lock()
+	s.stop = nil
+	s.lock.Unlock()
+	step()
+	return nil
+}
+
+func (s *session) stackTrace() (interface{}, error) {
+	stop, err := s.stopped()
+	if err != nil {
+		return nil, err
+	}
+
+	// DAP lists frames innermost first
+	frames := make([]map[string]interface{}, 0, len(stop.Frames))
+	for i := len(stop.Frames) - 1; i >= 0; i-- {
+		fr := stop.Frames[i]
+		frame := map[string]interface{}{
+			"id":     len(frames),
+			"name":   fr.Name,
+			"line":   fr.Line,
+			"column": fr.Col,
+		}
+		if fr.Line > 0 {
+			frame["source"] = map[string]interface{}{"name": filepath.Base(fr.File), "path": fr.File}
+		}
+		frames = append(frames, frame)
+	}
+	return map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)}, nil
+}
+
+func (s *session) scopes(data json.RawMessage) (interface{}, error) {
+	args := &scopesArgs{}
+	if err := unmarshalArgs(data, args); err != nil {
+		return nil, err
+	}
+	if _, err := s.stopped(); err != nil {
+		return nil, err
+	}
+
+	var scopes []map[string]interface{}
+	// locals are only known for the innermost frame
+	if args.FrameID == 0 {
+		scopes = append(scopes, map[string]interface{}{"name": "Locals", "variablesReference": localsRef, "expensive": false})
+	}
+	scopes = append(scopes, map[string]interface{}{"name": "Globals", "variablesReference": globalsRef, "expensive": false})
+	return map[string]interface{}{"scopes": scopes}, nil
+}
+
+func (s *session) variables(data json.RawMessage) (interface{}, error) {
+	args := &variablesArgs{}
+	if err := unmarshalArgs(data, args); err != nil {
+		return nil, err
+	}
+	stop, err := s.stopped()
+	if err != nil {
+		return nil, err
+	}
+
+	vars := stop.Locals
+	if args.VariablesReference == globalsRef {
+		vars = stop.Globals
+	}
+
+	list := make([]map[string]interface{}, 0, len(vars))
+	for _, name := range vars.Keys() {
+		v := vars[name]
+		list = append(list, map[string]interface{}{
+			"name":               name,
+			"value":              v.String(),
+			"type":               v.Type(),
+			"variablesReference": 0,
+		})
+	}
+	return map[string]interface{}{"variables": list}, nil
+}
+
+func (s *session) respond(req *request, body interface{}, err error) {
+	res := &response{
+		Type:       "response",
+		RequestSeq: req.Seq,
+		Command:    req.Command,
+		Success:    err == nil,
+		Body:       body,
+	}
+	if err != nil {
+		res.Message = err.Error()
+	}
+	s.send(func(seq int) interface{} {
+		res.Seq = seq
+		return res
+	})
+}
+
+func (s *session) event(name string, body interface{}) {
+	s.send(func(seq int) interface{} {
+		return &event{Seq: seq, Type: "event", Event: name, Body: body}
+	})
+}
+
+// send writes a message, msg is called with the message sequence number. write
+// errors are ignored, a broken connection ends the session when the next read fails
+func (s *session) send(msg func(seq int) interface{}) {
+	s.wlock.Lock()
+	defer s.wlock.Unlock()
+	s.seq++
+	data, err := json.Marshal(msg(s.seq))
+	if err != nil {
+		return
+	}
+	framing.Write(s.w, data)
+}
+
+// close ends the session, letting a paused script run to completion
+func (s *session) close() {
+	close(s.closed)
+	s.debugger.Continue()
+}
+
+func unmarshalArgs(data json.RawMessage, v interface{}) error {
+	if len(data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(data, v)
+}
+
+// outputWriter sends script print output to the client as output events
+type outputWriter struct {
+	s *session
+}
+
+func (w outputWriter) Write(p []byte) (int, error) {
+	w.s.event("output", map[string]interface{}{"category": "stdout", "output": string(p)})
+	return len(p), nil
+}
@@ -0,0 +1,174 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/qri-io/startf/internal/framing"
+)
+
+// client is a minimal DAP client for testing
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	seq  int
+	msgs chan map[string]interface{}
+}
+
+func newClient(t *testing.T, conn net.Conn) *client {
+	c := &client{t: t, conn: conn, msgs: make(chan map[string]interface{}, 100)}
+	go func() {
+		r := bufio.NewReader(conn)
+		for {
+			data, err := framing.Read(r)
+			if err != nil {
+				close(c.msgs)
+				return
+			}
+			msg := map[string]interface{}{}
+			if err := json.Unmarshal(data, &msg); err != nil {
+				t.Errorf("decoding message: %s", err)
+			}
+			c.msgs <- msg
+		}
+	}()
+	return c
+}
+
+// request sends a request & waits for its response, failing the test if the
+// request fails
+func (c *client) request(command string, args interface{}) map[string]interface{} {
+	c.t.Helper()
+	c.seq++
+	data, err := json.Marshal(map[string]interface{}{
+		"seq":       c.seq,
+		"type":      "request",
+		"command":   command,
+		"arguments": args,
+	})
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if err := framing.Write(c.conn, data); err != nil {
+		c.t.Fatal(err)
+	}
+
+	res := c.await("response", command)
+	if res["success"] != true {
+		c.t.Fatalf("%s request failed: %v", command, res["message"])
+	}
+	body, _ := res["body"].(map[string]interface{})
+	return body
+}
+
+// await waits for a response to command, or an event named name
+func (c *client) await(typ, name string) map[string]interface{} {
+	c.t.Helper()
+	key := "command"
+	if typ == "event" {
+		key = "event"
+	}
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case msg, ok := <-c.msgs:
+			if !ok {
+				c.t.Fatalf("connection closed waiting for %s %s", typ, name)
+			}
+			if msg["type"] == typ && msg[key] == name {
+				return msg
+			}
+		case <-timeout:
+			c.t.Fatalf("timed out waiting for %s %s", typ, name)
+		}
+	}
+}
+
+func TestServeConn(t *testing.T) {
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+
+	s := &Server{}
+	done := make(chan error)
+	go func() {
+		done <- s.ServeConn(serverConn)
+	}()
+
+	program, err := filepath.Abs("../testdata/debug.star")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := newClient(t, clientConn)
+	c.request("initialize", map[string]interface{}{"adapterID": "startf"})
+	c.await("event", "initialized")
+	c.request("launch", map[string]interface{}{"program": program})
+	bps := c.request("setBreakpoints", map[string]interface{}{
+		"source":      map[string]interface{}{"path": program},
+		"breakpoints": []map[string]interface{}{{"line": 7}, {"line": 4}, {"line": 5}},
+	})
+	list, _ := bps["breakpoints"].([]interface{})
+	if len(list) != 3 {
+		t.Fatalf("expected 3 breakpoints, got: %v", bps["breakpoints"])
+	}
+	// line 4 is blank & line 5 starts a def, neither can stop
+	for i, verified := range []bool{true, false, false} {
+		if bp := list[i].(map[string]interface{}); bp["verified"] != verified {
+			t.Errorf("breakpoint %d (line %v) verified mismatch. expected: %t, got: %v", i, bp["line"], verified, bp["verified"])
+		}
+	}
+	c.request("configurationDone", nil)
+
+	stopped := c.await("event", "stopped")
+	if reason := stopped["body"].(map[string]interface{})["reason"]; reason != "breakpoint" {
+		t.Errorf("expected stop reason 'breakpoint', got: %v", reason)
+	}
+
+	trace := c.request("stackTrace", map[string]interface{}{"threadId": threadID})
+	frames := trace["stackFrames"].([]interface{})
+	top := frames[0].(map[string]interface{})
+	if top["name"] != "transform" || top["line"] != float64(7) {
+		t.Errorf("expected top frame to be transform at line 7, got: %v", top)
+	}
+
+	scopes := c.request("scopes", map[string]interface{}{"frameId": 0})
+	if list := scopes["scopes"].([]interface{}); len(list) != 2 {
+		t.Errorf("expected locals & globals scopes, got: %v", list)
+	}
+
+	vars := c.request("variables", map[string]interface{}{"variablesReference": localsRef})
+	names := []string{}
+	for _, v := range vars["variables"].([]interface{}) {
+		names = append(names, v.(map[string]interface{})["name"].(string))
+	}
+	if len(names) != 3 || names[0] != "a" || names[1] != "ctx" || names[2] != "ds" {
+		t.Errorf("locals mismatch. expected: [a ctx ds], got: %v", names)
+	}
+
+	c.request("next", map[string]interface{}{"threadId": threadID})
+	c.await("event", "stopped")
+	trace = c.request("stackTrace", map[string]interface{}{"threadId": threadID})
+	top = trace["stackFrames"].([]interface{})[0].(map[string]interface{})
+	if top["line"] != float64(8) {
+		t.Errorf("expected step to stop at line 8, got: %v", top["line"])
+	}
+
+	// continue to the breakpoint() call, then to the end of the script
+	c.request("continue", map[string]interface{}{"threadId": threadID})
+	c.await("event", "stopped")
+	c.request("continue", map[string]interface{}{"threadId": threadID})
+	exited := c.await("event", "exited")
+	if code := exited["body"].(map[string]interface{})["exitCode"]; code != float64(0) {
+		t.Errorf("expected exit code 0, got: %v", code)
+	}
+	c.await("event", "terminated")
+
+	c.request("disconnect", nil)
+	if err := <-done; err != nil {
+		t.Errorf("unexpected serve error: %s", err)
+	}
+}
@@ -0,0 +1,71 @@
+package startf
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/qri-io/dataset"
+	"github.com/qri-io/dataset/dsio"
+	"github.com/qri-io/qfs"
+)
+
+// LoadDatasetFile reads a dataset from a JSON file, for use as the previous
+// version of a dataset in tests & the REPL. Files can include an inline "body"
+// value, which is encoded using the file's structure, or as json if no structure
+// is given
+func LoadDatasetFile(path string) (*dataset.Dataset, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ds := &dataset.Dataset{}
+	if err := json.Unmarshal(data, ds); err != nil {
+		return nil, fmt.Errorf("reading dataset file %s: %s", path, err)
+	}
+	if ds.Body == nil {
+		return ds, nil
+	}
+
+	if ds.Structure == nil {
+		sch := dataset.BaseSchemaArray
+		if _, ok := ds.Body.(map[string]interface{}); ok {
+			sch = dataset.BaseSchemaObject
+		}
+		ds.Structure = &dataset.Structure{Format: "json", Schema: sch}
+	}
+
+	w, err := dsio.NewEntryBuffer(ds.Structure)
+	if err != nil {
+		return nil, err
+	}
+	switch body := ds.Body.(type) {
+	case []interface{}:
+		for i, v := range body {
+			if err := w.WriteEntry(dsio.Entry{Index: i, Value: v}); err != nil {
+				return nil, err
+			}
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(body))
+		for k := range body {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if err := w.WriteEntry(dsio.Entry{Key: k, Value: body[k]}); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("dataset file %s: body must be an array or object", path)
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	ds.Body = nil
+	ds.SetBodyFile(qfs.NewMemfileBytes(fmt.Sprintf("body.%s", ds.Structure.Format), w.Bytes()))
+	return ds, nil
+}
@@ -0,0 +1,39 @@
+package startf
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestLoadDatasetFile(t *testing.T) {
+	ds, err := LoadDatasetFile("testdata/dataset.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ds.Meta == nil || ds.Meta.Title != "counts" {
+		t.Errorf("expected meta title 'counts', got: %v", ds.Meta)
+	}
+	if ds.Structure == nil || ds.Structure.Format != "json" || ds.Structure.Schema["type"] != "object" {
+		t.Fatalf("expected a json object structure, got: %v", ds.Structure)
+	}
+	if ds.Body != nil {
+		t.Errorf("expected the inline body to be moved to the body file")
+	}
+	data, err := ioutil.ReadAll(ds.BodyFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := map[string]interface{}{}
+	if err := json.Unmarshal(data, &body); err != nil {
+		t.Fatal(err)
+	}
+	if expect := map[string]interface{}{"a": 1.0, "b": 2.0}; !reflect.DeepEqual(body, expect) {
+		t.Errorf("body mismatch. expected: %v, got: %v", expect, body)
+	}
+
+	if _, err := LoadDatasetFile("testdata/missing.json"); err == nil {
+		t.Error("expected an error loading a missing file")
+	}
+}
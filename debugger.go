@@ -0,0 +1,444 @@
+package startf
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// debugHookName is the name of the builtin instrumented scripts call before each statement
+const debugHookName = "__startf_debug__"
+
+// Reasons a Debugger can stop
+const (
+	StopEntry      = "entry"      // stopped before the first statement of the script
+	StopBreakpoint = "breakpoint" // stopped at a breakpoint, or a call to breakpoint()
+	StopStep       = "step"       // stopped after a step request
+)
+
+type stepMode int
+
+const (
+	modeContinue stepMode = iota
+	modeStepInto
+	modeStepOver
+	modeStepOut
+)
+
+// DebugStop describes the state of a paused script
+type DebugStop struct {
+	// Reason is why the script stopped, one of StopEntry, StopBreakpoint or StopStep
+	Reason string
+	// File & Line are the location of the next statement to execute
+	File string
+	Line int
+	// Frames is the call stack, outermost call first
+	Frames []StackFrame
+	// Locals are the variables bound in the innermost function. Only variables that
+	// are certain to be bound at this point in the script are included
+	Locals starlark.StringDict
+	// Globals are the global variables defined so far
+	Globals starlark.StringDict
+}
+
+// Debugger pauses transform script execution at breakpoints & steps through
+// scripts. Provide a debugger to ExecScript with SetDebugger, then call
+// ExecScript in a goroutine and read from Stops. Each stop must be followed by a
+// call to Continue, StepOver, StepInto or StepOut to resume execution.
+//
+// Breakpoints can be set on any line that starts a simple statement (assignments,
+// expressions, return, pass, break & continue), which BreakpointLines lists.
+// Breakpoints on other lines stop at the next simple statement. Scripts can also
+// call breakpoint() to stop.
+type Debugger struct {
+	// StopOnEntry pauses before the first statement of the script
+	StopOnEntry bool
+
+	stops  chan *DebugStop
+	resume chan stepMode
+
+	lock        sync.Mutex
+	breakpoints map[string]map[int]bool
+	// lines that can stop, by file
+	lines     map[string][]int
+	mode      stepMode
+	stepDepth int
+	entry     bool
+	// most recent statement, used to find locals for breakpoint()
+	hookSeq    int
+	stoppedSeq int
+	depth      int
+	locals     starlark.StringDict
+}
+
+// NewDebugger creates a Debugger
+func NewDebugger() *Debugger {
+	return &Debugger{
+		stops:       make(chan *DebugStop),
+		resume:      make(chan stepMode, 1),
+		breakpoints: map[string]map[int]bool{},
+		lines:       map[string][]int{},
+	}
+}
+
+// SetDebugger runs scripts under d
+func SetDebugger(d *Debugger) func(o *ExecOpts) {
+	return func(o *ExecOpts) {
+		o.Debugger = d
+	}
+}
+
+// Stops returns a channel that receives a value each time the script pauses
+func (d *Debugger) Stops() <-chan *DebugStop {
+	return d.stops
+}
+
+// SetBreakpoints replaces breakpoints for a file with the given line numbers
+func (d *Debugger) SetBreakpoints(file string, lines []int) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	set := map[int]bool{}
+	for _, l := range lines {
+		set[l] = true
+	}
+	d.breakpoints[filepath.Clean(file)] = set
+}
+
+// Continue resumes execution until the next breakpoint
+func (d *Debugger) Continue() { d.step(modeContinue) }
+
+// StepOver resumes execution until the next statement in the current function
+func (d *Debugger) StepOver() { d.step(modeStepOver) }
+
+// StepInto resumes execution until the next statement, including statements in
+// called functions
+func (d *Debugger) StepInto() { d.step(modeStepInto) }
+
+// StepOut resumes execution until the current function returns
+func (d *Debugger) StepOut() { d.step(modeStepOut) }
+
+func (d *Debugger) step(mode stepMode) {
+	select {
+	case d.resume <- mode:
+	default:
+		// a resume is already pending
+	}
+}
+
+// Breakpoint is the starlark breakpoint() builtin. It pauses the script when run
+// under a Debugger, and does nothing otherwise
+func (d *Debugger) Breakpoint(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackPositionalArgs("breakpoint", args, kwargs, 0); err != nil {
+		return nil, err
+	}
+	if d == nil {
+		return starlark.None, nil
+	}
+
+	depth := callerDepth(thread)
+
+	d.lock.Lock()
+	if d.stoppedSeq == d.hookSeq && d.depth == depth {
+		// already stopped at this statement
+		d.lock.Unlock()
+		return starlark.None, nil
+	}
+	var locals starlark.StringDict
+	if d.depth == depth {
+		locals = d.locals
+	}
+	d.lock.Unlock()
+
+	d.pause(thread, StopBreakpoint, depth, locals)
+	return starlark.None, nil
+}
+
+// hook is called by instrumented scripts before each simple statement with a dict
+// of bound local variables
+func (d *Debugger) hook(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var vars *starlark.Dict
+	if err := starlark.UnpackPositionalArgs(debugHookName, args, kwargs, 1, &vars); err != nil {
+		return nil, err
+	}
+
+	locals := starlark.StringDict{}
+	for _, item := range vars.Items() {
+		if name, ok := item[0].(starlark.String); ok {
+			locals[string(name)] = item[1]
+		}
+	}
+
+	depth := callerDepth(thread)
+	file, line, _ := position(thread.CallFrame(1).Pos)
+
+	d.lock.Lock()
+	d.hookSeq++
+	d.depth = depth
+	d.locals = locals
+	reason := d.stopReason(filepath.Clean(file), line, depth)
+	if reason != "" {
+		d.stoppedSeq = d.hookSeq
+	}
+	d.lock.Unlock()
+
+	if reason != "" {
+		d.pause(thread, reason, depth, locals)
+	}
+	return starlark.None, nil
+}
+
+// stopReason decides if execution should stop at a statement, d.lock must be held
+func (d *Debugger) stopReason(file string, line, depth int) string {
+	if d.entry {
+		d.entry = false
+		return StopEntry
+	}
+	if d.breakpointAt(file, line) {
+		return StopBreakpoint
+	}
+	switch d.mode {
+	case modeStepInto:
+		return StopStep
+	case modeStepOver:
+		if depth <= d.stepDepth {
+			return StopStep
+		}
+	case modeStepOut:
+		if depth < d.stepDepth {
+			return StopStep
+		}
+	}
+	return ""
+}
+
+// breakpointAt reports whether a breakpoint resolves to a line. breakpoints on lines
+// that can't stop resolve to the next line that can, d.lock must be held
+func (d *Debugger) breakpointAt(file string, line int) bool {
+	bps := d.breakpoints[file]
+	if bps[line] {
+		return true
+	}
+	lines := d.lines[file]
+	i := sort.SearchInts(lines, line)
+	if i >= len(lines) || lines[i] != line {
+		return false
+	}
+	// check for breakpoints between the previous stoppable line and this one
+	prev := 0
+	if i > 0 {
+		prev = lines[i-1]
+	}
+	for bp := range bps {
+		if bp > prev && bp < line {
+			return true
+		}
+	}
+	return false
+}
+
+// pause reports a stop & blocks until execution is resumed. pause must be called
+// from a builtin, the stop describes the builtin's caller
+func (d *Debugger) pause(thread *starlark.Thread, reason string, depth int, locals starlark.StringDict) {
+	stack := thread.CallStack()
+	stop := &DebugStop{
+		Reason: reason,
+		Frames: stackFrames(stack[:len(stack)-1]),
+		Locals: locals,
+	}
+	stop.File, stop.Line, _ = position(thread.CallFrame(1).Pos)
+	if fn, ok := thread.DebugFrame(1).Callable().(*starlark.Function); ok {
+		stop.Globals = fn.Globals()
+	}
+
+	d.stops <- stop
+	mode := <-d.resume
+
+	d.lock.Lock()
+	d.mode = mode
+	d.stepDepth = depth
+	d.lock.Unlock()
+}
+
+// start prepares the debugger to run a script
+func (d *Debugger) start() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.mode = modeContinue
+	d.entry = d.StopOnEntry
+	d.hookSeq, d.stoppedSeq = 0, -1
+	// drain any resume requested while no script was running
+	select {
+	case <-d.resume:
+	default:
+	}
+}
+
+// instrument adds a call to the debug hook before each simple statement in a
+// script. Calls are inserted on the same line as the statement they precede so
+// line numbers are unchanged. If the script doesn't parse the source is returned
+// as-is, leaving ExecFile to report the error
+func (d *Debugger) instrument(filename string, src []byte) []byte {
+	ins, lines, err := findHooks(filename, src)
+	if err != nil {
+		return src
+	}
+
+	for _, line := range lines {
+		l := ins.lines[line-1]
+		indent := len(l) - len(bytes.TrimLeft(l, " \t"))
+		hook := fmt.Sprintf("%s(%s); ", debugHookName, dictLiteral(ins.hooks[line]))
+		ins.lines[line-1] = append(append(append([]byte{}, l[:indent]...), hook...), l[indent:]...)
+	}
+
+	d.lock.Lock()
+	d.lines[filepath.Clean(filename)] = lines
+	d.lock.Unlock()
+
+	return bytes.Join(ins.lines, []byte("\n"))
+}
+
+// BreakpointLines lists the lines of a script that breakpoints stop on exactly:
+// lines that start a simple statement
+func BreakpointLines(filename string, src []byte) ([]int, error) {
+	_, lines, err := findHooks(filename, src)
+	return lines, err
+}
+
+// findHooks parses a script, finding the statements to hook & the sorted lines
+// they start on
+func findHooks(filename string, src []byte) (*instrumenter, []int, error) {
+	f, err := syntax.Parse(filename, src, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ins := &instrumenter{lines: bytes.Split(src, []byte("\n")), hooks: map[int][]string{}}
+	ins.block(f.Stmts, nil)
+
+	lines := make([]int, 0, len(ins.hooks))
+	for line := range ins.hooks {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	return ins, lines, nil
+}
+
+// instrumenter finds statements to hook, tracking which names are certain to be
+// bound before each statement
+type instrumenter struct {
+	lines [][]byte
+	// bound names by line of the statement to hook
+	hooks map[int][]string
+}
+
+func (ins *instrumenter) block(stmts []syntax.Stmt, bound []string) {
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *syntax.AssignStmt, *syntax.ExprStmt, *syntax.ReturnStmt, *syntax.BranchStmt:
+			ins.hook(stmt, bound)
+			if a, ok := s.(*syntax.AssignStmt); ok && a.Op == syntax.EQ {
+				bound = appendNames(bound, a.LHS)
+			}
+		case *syntax.LoadStmt:
+			for _, id := range s.To {
+				bound = append(bound, id.Name)
+			}
+		case *syntax.DefStmt:
+			var params []string
+			for _, p := range s.Params {
+				params = appendParam(params, p)
+			}
+			ins.block(s.Body, params)
+			bound = append(bound, s.Name.Name)
+		case *syntax.ForStmt:
+			ins.block(s.Body, appendNames(copyNames(bound), s.Vars))
+		case *syntax.IfStmt:
+			ins.block(s.True, copyNames(bound))
+			ins.block(s.False, copyNames(bound))
+		}
+	}
+}
+
+// hook records a statement to instrument if it's the first thing on its line
+func (ins *instrumenter) hook(stmt syntax.Stmt, bound []string) {
+	start, _ := stmt.Span()
+	line := int(start.Line)
+	if line < 1 || line > len(ins.lines) || ins.hooks[line] != nil {
+		return
+	}
+	l := ins.lines[line-1]
+	col := int(start.Col) - 1
+	if col > len(l) || len(bytes.TrimSpace(l[:col])) > 0 {
+		return
+	}
+	ins.hooks[line] = copyNames(bound)
+}
+
+func copyNames(names []string) []string {
+	return append([]string{}, names...)
+}
+
+// appendNames adds identifiers bound by an assignment target
+func appendNames(names []string, e syntax.Expr) []string {
+	switch x := e.(type) {
+	case *syntax.Ident:
+		return append(names, x.Name)
+	case *syntax.TupleExpr:
+		for _, el := range x.List {
+			names = appendNames(names, el)
+		}
+	case *syntax.ListExpr:
+		for _, el := range x.List {
+			names = appendNames(names, el)
+		}
+	case *syntax.ParenExpr:
+		return appendNames(names, x.X)
+	}
+	return names
+}
+
+// appendParam adds the name bound by a function parameter
+func appendParam(names []string, p syntax.Expr) []string {
+	switch x := p.(type) {
+	case *syntax.Ident:
+		return append(names, x.Name)
+	case *syntax.BinaryExpr:
+		// parameter with a default value
+		return appendParam(names, x.X)
+	case *syntax.UnaryExpr:
+		// *args & **kwargs
+		if x.X != nil {
+			return appendParam(names, x.X)
+		}
+	}
+	return names
+}
+
+// dictLiteral writes a starlark dict literal that maps each name to its value
+func dictLiteral(names []string) string {
+	seen := map[string]bool{}
+	buf := &bytes.Buffer{}
+	buf.WriteString("{")
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		if len(seen) > 0 {
+			buf.WriteString(", ")
+		}
+		seen[name] = true
+		fmt.Fprintf(buf, "%q: %s", name, name)
+	}
+	buf.WriteString("}")
+	return buf.String()
+}
+
+// callerDepth is the depth of the call stack of a builtin's caller
+func callerDepth(thread *starlark.Thread) int {
+	return thread.CallStackDepth() - 1
+}
@@ -0,0 +1,125 @@
+package startf
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qri-io/dataset"
+	"go.starlark.net/starlark"
+)
+
+func TestDebugger(t *testing.T) {
+	d := NewDebugger()
+	d.SetBreakpoints("testdata/debug.star", []int{5})
+
+	ds := &dataset.Dataset{Transform: &dataset.Transform{}}
+	ds.Transform.SetScriptFile(scriptFile(t, "testdata/debug.star"))
+	done := make(chan error)
+	go func() {
+		done <- ExecScript(ds, nil, SetDebugger(d))
+	}()
+
+	cases := []struct {
+		reason string
+		line   int
+		frames string
+		locals string
+		resume func()
+	}{
+		{StopBreakpoint, 6, "transform", "ctx,ds", d.StepOver},
+		{StopStep, 7, "transform", "a,ctx,ds", d.StepInto},
+		{StopStep, 2, "transform,double", "x", d.StepOut},
+		{StopStep, 8, "transform", "a,b,ctx,ds", d.Continue},
+		{StopBreakpoint, 9, "transform", "a,b,c,ctx,ds", d.Continue},
+	}
+
+	for i, c := range cases {
+		var stop *DebugStop
+		select {
+		case stop = <-d.Stops():
+		case err := <-done:
+			t.Fatalf("case %d: script finished before stopping. error: %v", i, err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("case %d: timed out waiting for stop", i)
+		}
+
+		if stop.Reason != c.reason || stop.Line != c.line {
+			t.Errorf("case %d stop mismatch. expected: %s at line %d, got: %s at line %d", i, c.reason, c.line, stop.Reason, stop.Line)
+		}
+		names := make([]string, len(stop.Frames))
+		for j, fr := range stop.Frames {
+			names[j] = fr.Name
+		}
+		if got := strings.Join(names, ","); got != c.frames {
+			t.Errorf("case %d frames mismatch. expected: %s, got: %s", i, c.frames, got)
+		}
+		if got := strings.Join(stop.Locals.Keys(), ","); got != c.locals {
+			t.Errorf("case %d locals mismatch. expected: %s, got: %s", i, c.locals, got)
+		}
+		if _, ok := stop.Globals["double"]; !ok {
+			t.Errorf("case %d expected globals to include 'double'", i)
+		}
+		c.resume()
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-d.Stops():
+		t.Fatal("unexpected stop")
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for script to finish")
+	}
+}
+
+func TestBreakpointNoDebugger(t *testing.T) {
+	ds := &dataset.Dataset{Transform: &dataset.Transform{}}
+	ds.Transform.SetScriptFile(scriptFile(t, "testdata/debug.star"))
+	if err := ExecScript(ds, nil); err != nil {
+		t.Errorf("expected breakpoint() without a debugger to be a no-op, got error: %s", err)
+	}
+	if _, ok := starlark.Universe["breakpoint"]; ok {
+		t.Error("expected breakpoint to be predeclared for each script, not added to the universe")
+	}
+}
+
+func TestInstrument(t *testing.T) {
+	src := "x = 1\nfor i in [1]:\n  y = i\nif x: z = 2\nw = 3\n"
+	expect := []string{
+		`__startf_debug__({}); x = 1`,
+		`for i in [1]:`,
+		`  __startf_debug__({"x": x, "i": i}); y = i`,
+		`if x: z = 2`,
+		`__startf_debug__({"x": x}); w = 3`,
+		``,
+	}
+
+	got := strings.Split(string(NewDebugger().instrument("test.star", []byte(src))), "\n")
+	if len(got) != len(expect) {
+		t.Fatalf("line count mismatch. expected: %d, got: %d", len(expect), len(got))
+	}
+	for i, line := range expect {
+		if got[i] != line {
+			t.Errorf("line %d mismatch. expected: %q, got: %q", i+1, line, got[i])
+		}
+	}
+}
+
+func TestBreakpointLines(t *testing.T) {
+	src := "# comment\nx = [1,\n  2]\n\ndef f():\n  return x\nif x: y = 1\n"
+	lines, err := BreakpointLines("test.star", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(lines) != "[2 6]" {
+		t.Errorf("expected breakpoint lines [2 6], got: %v", lines)
+	}
+
+	if _, err := BreakpointLines("test.star", []byte("def f(\n")); err == nil {
+		t.Error("expected a syntax error")
+	}
+}
@@ -0,0 +1,358 @@
+package ds
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/qri-io/dataset"
+	"github.com/qri-io/dataset/dsio"
+	"github.com/qri-io/qfs"
+	"go.starlark.net/starlark"
+)
+
+// bodyProvider returns the dataset whose body get_body reads, which is the write
+// dataset once set_body has been called. it's nil if there's no dataset to read
+func (d *Dataset) bodyProvider() *dataset.Dataset {
+	if d.modBody && d.write != nil {
+		return d.write
+	}
+	return d.read
+}
+
+// streamBody passes the body file of a dataset to read, then makes the body
+// readable again without keeping a copy of it: seekable files are rewound & files
+// with a body path are reopened with the body opener. Bodies that can be neither
+// are kept in memory the first time they're read, so later reads can rewind them
+func (d *Dataset) streamBody(provider *dataset.Dataset, read func(r io.Reader) error) error {
+	f := provider.BodyFile()
+	if s, ok := f.(io.Seeker); ok {
+		err := read(f)
+		if _, serr := s.Seek(0, io.SeekStart); err == nil {
+			err = serr
+		}
+		return err
+	}
+
+	if d.openBody != nil && provider.BodyPath != "" {
+		err := read(f)
+		f.Close()
+		if oerr := d.openBody(provider); err == nil {
+			err = oerr
+		}
+		return err
+	}
+
+	buf := &bytes.Buffer{}
+	err := read(io.TeeReader(f, buf))
+	if _, cerr := io.Copy(buf, f); err == nil {
+		err = cerr
+	}
+	f.Close()
+	provider.SetBodyFile(newBodyFile(f.FileName(), buf.Bytes()))
+	return err
+}
+
+// newBodyReader reads body entries. json bodies with decimal values are read
+// keeping numbers as json.Number, so decimals keep their exact value instead of
+// being rounded to a float
+func newBodyReader(st *dataset.Structure, r io.Reader) (dsio.EntryReader, error) {
+	if st.Format == "json" && newTypedSchema(st.Schema).hasDecimal() {
+		return newJSONNumberReader(st, r)
+	}
+	return dsio.NewEntryReader(st, r)
+}
+
+// jsonNumberReader reads the entries of a json array or object body, decoding
+// numbers as json.Number
+type jsonNumberReader struct {
+	st      *dataset.Structure
+	dec     *json.Decoder
+	object  bool
+	started bool
+	i       int
+}
+
+func newJSONNumberReader(st *dataset.Structure, r io.Reader) (*jsonNumberReader, error) {
+	tlt, err := dsio.GetTopLevelType(st)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	return &jsonNumberReader{st: st, dec: dec, object: tlt == "object"}, nil
+}
+
+// Structure gives this reader's structure
+func (r *jsonNumberReader) Structure() *dataset.Structure {
+	return r.st
+}
+
+// ReadEntry reads one entry of the body
+func (r *jsonNumberReader) ReadEntry() (e dsio.Entry, err error) {
+	if !r.started {
+		r.started = true
+		open := json.Delim('[')
+		if r.object {
+			open = json.Delim('{')
+		}
+		tok, err := r.dec.Token()
+		if err != nil {
+			return e, err
+		}
+		if tok != open {
+			return e, fmt.Errorf("expected json body to start with '%s', got: %v", open, tok)
+		}
+	}
+	if !r.dec.More() {
+		return e, io.EOF
+	}
+
+	if r.object {
+		tok, err := r.dec.Token()
+		if err != nil {
+			return e, err
+		}
+		e.Key, _ = tok.(string)
+	} else {
+		e.Index = r.i
+		r.i++
+	}
+	err = r.dec.Decode(&e.Value)
+	return e, err
+}
+
+// Close finalizes the reader
+func (r *jsonNumberReader) Close() error {
+	return nil
+}
+
+// bodyFile is an in-memory body file that can be rewound to read it again
+type bodyFile struct {
+	qfs.File
+	data *bytes.Reader
+}
+
+func newBodyFile(name string, data []byte) *bodyFile {
+	return &bodyFile{File: qfs.NewMemfileBytes(name, nil), data: bytes.NewReader(data)}
+}
+
+func (f *bodyFile) Read(p []byte) (int, error) {
+	return f.data.Read(p)
+}
+
+// Seek implements io.Seeker
+func (f *bodyFile) Seek(offset int64, whence int) (int64, error) {
+	return f.data.Seek(offset, whence)
+}
+
+// bodyRange reads limit entries of the body starting at offset. a negative limit
+// reads to the end of the body. entries before offset are skipped by the
+// underlying reader without converting them to starlark values
+func (d *Dataset) bodyRange(valx starlark.Value, offset, limit int) (starlark.Value, error) {
+	if offset < 0 {
+		return starlark.None, fmt.Errorf("get_body: offset cannot be negative")
+	}
+	if d.bodyCache != nil {
+		return sliceBody(d.bodyCache, offset, limit), nil
+	}
+
+	provider := d.bodyProvider()
+	if provider == nil || provider.BodyFile() == nil {
+		if valx == nil {
+			return starlark.None, nil
+		}
+		return valx, nil
+	}
+	st := provider.Structure
+	if st == nil {
+		return starlark.None, fmt.Errorf("error: no structure for dataset")
+	}
+	defer d.since("get_body", time.Now())
+
+	w, err := NewStarlarkEntryWriter(st)
+	if err != nil {
+		return starlark.None, fmt.Errorf("error allocating starlark entry writer: %s", err)
+	}
+	err = d.streamBody(provider, func(data io.Reader) error {
+		r, err := newBodyReader(st, data)
+		if err != nil {
+			return fmt.Errorf("error allocating data reader: %s", err)
+		}
+		for i := 0; limit < 0 || i < offset+limit; i++ {
+			e, err := r.ReadEntry()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if i >= offset {
+				if err := w.WriteEntry(e); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return starlark.None, err
+	}
+	return w.Value(), nil
+}
+
+// sliceBody gives limit entries of a converted body starting at offset
+func sliceBody(body starlark.Value, offset, limit int) starlark.Value {
+	var items []starlark.Value
+	if dict, ok := body.(*starlark.Dict); ok {
+		for _, item := range dict.Items() {
+			items = append(items, item)
+		}
+	} else {
+		iter := body.(starlark.Iterable).Iterate()
+		defer iter.Done()
+		var v starlark.Value
+		for iter.Next(&v) {
+			items = append(items, v)
+		}
+	}
+
+	if offset > len(items) {
+		offset = len(items)
+	}
+	end := len(items)
+	if limit >= 0 && offset+limit < end {
+		end = offset + limit
+	}
+	items = items[offset:end]
+
+	if _, ok := body.(*starlark.Dict); ok {
+		dict := starlark.NewDict(len(items))
+		for _, item := range items {
+			kv := item.(starlark.Tuple)
+			dict.SetKey(kv[0], kv[1])
+		}
+		return dict
+	}
+	return starlark.NewList(items)
+}
+
+// GetEntry gets a single body entry by index for array bodies, or by key for
+// object bodies, reading the body only as far as the entry
+func (d *Dataset) GetEntry(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var key starlark.Value
+	if err := starlark.UnpackPositionalArgs("get_entry", args, kwargs, 1, &key); err != nil {
+		return starlark.None, err
+	}
+
+	index, isIndex := -1, false
+	switch k := key.(type) {
+	case starlark.Int:
+		i, ok := k.Int64()
+		if !ok || i < 0 {
+			return starlark.None, fmt.Errorf("get_entry: index must be a non-negative int, got %s", k)
+		}
+		index, isIndex = int(i), true
+	case starlark.String:
+	default:
+		return starlark.None, fmt.Errorf("get_entry: expected an int index or string key, got %s", key.Type())
+	}
+
+	if d.bodyCache != nil {
+		return entryOf(d.bodyCache, key, index, isIndex)
+	}
+
+	provider := d.bodyProvider()
+	if provider == nil || provider.BodyFile() == nil {
+		return starlark.None, fmt.Errorf("get_entry: dataset has no body")
+	}
+	st := provider.Structure
+	if st == nil {
+		return starlark.None, fmt.Errorf("error: no structure for dataset")
+	}
+	mode, err := schemaScanMode(st)
+	if err != nil {
+		return starlark.None, err
+	}
+	if isIndex != (mode == smArray) {
+		return starlark.None, entryKindError(isIndex)
+	}
+	defer d.since("get_entry", time.Now())
+
+	types := newTypedSchema(st.Schema)
+	var (
+		found   bool
+		entry   dsio.Entry
+		entries int
+	)
+	err = d.streamBody(provider, func(data io.Reader) error {
+		r, err := newBodyReader(st, data)
+		if err != nil {
+			return fmt.Errorf("error allocating data reader: %s", err)
+		}
+		for ; ; entries++ {
+			e, err := r.ReadEntry()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if (isIndex && entries == index) || (!isIndex && e.Key == string(key.(starlark.String))) {
+				found, entry = true, e
+				return nil
+			}
+		}
+	})
+	if err != nil {
+		return starlark.None, fmt.Errorf("get_entry: %s", err)
+	}
+
+	if !found && isIndex {
+		return starlark.None, fmt.Errorf("get_entry: index %d out of range, body has %d entries", index, entries)
+	} else if !found {
+		return starlark.None, fmt.Errorf("get_entry: body has no key %s", key)
+	}
+	if isIndex {
+		return marshalTyped(entry.Value, types.item(index))
+	}
+	return marshalTyped(entry.Value, types.prop(entry.Key))
+}
+
+// entryOf looks up an entry of a converted body
+func entryOf(body starlark.Value, key starlark.Value, index int, isIndex bool) (starlark.Value, error) {
+	if dict, ok := body.(*starlark.Dict); ok {
+		if isIndex {
+			return starlark.None, entryKindError(isIndex)
+		}
+		v, found, err := dict.Get(key)
+		if err != nil {
+			return starlark.None, err
+		}
+		if !found {
+			return starlark.None, fmt.Errorf("get_entry: body has no key %s", key)
+		}
+		return v, nil
+	}
+
+	if !isIndex {
+		return starlark.None, entryKindError(isIndex)
+	}
+	list, ok := body.(starlark.Indexable)
+	if !ok {
+		return starlark.None, fmt.Errorf("get_entry: can't index a %s body", body.Type())
+	}
+	if index >= list.Len() {
+		return starlark.None, fmt.Errorf("get_entry: index %d out of range, body has %d entries", index, list.Len())
+	}
+	return list.Index(index), nil
+}
+
+func entryKindError(isIndex bool) error {
+	if isIndex {
+		return fmt.Errorf("get_entry: object bodies are indexed by string keys")
+	}
+	return fmt.Errorf("get_entry: array bodies are indexed by int")
+}
@@ -0,0 +1,184 @@
+package ds
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/qri-io/dataset"
+	"github.com/qri-io/qfs"
+	"go.starlark.net/starlark"
+)
+
+func jsonDataset(body string, schema map[string]interface{}) *Dataset {
+	prev := &dataset.Dataset{Structure: &dataset.Structure{Format: "json", Schema: schema}}
+	prev.SetBodyFile(qfs.NewMemfileBytes("body.json", []byte(body)))
+	return NewDataset(prev, nil)
+}
+
+func TestGetBodyRange(t *testing.T) {
+	thread := &starlark.Thread{}
+	kw := func(k string, v int) starlark.Tuple {
+		return starlark.Tuple{starlark.String(k), starlark.MakeInt(v)}
+	}
+
+	cases := []struct {
+		kwargs []starlark.Tuple
+		expect string
+	}{
+		{[]starlark.Tuple{kw("offset", 1), kw("limit", 2)}, "[2, 3]"},
+		{[]starlark.Tuple{kw("limit", 0)}, "[]"},
+		{[]starlark.Tuple{kw("offset", 3)}, "[4, 5]"},
+		{[]starlark.Tuple{kw("offset", 10), kw("limit", 2)}, "[]"},
+	}
+	for i, c := range cases {
+		// ranges read from the body file, and from the converted body once it's loaded
+		ds := jsonDataset("[1,2,3,4,5]", dataset.BaseSchemaArray)
+		for _, loaded := range []bool{false, true} {
+			if loaded {
+				if _, err := ds.GetBody(thread, nil, starlark.Tuple{}, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got, err := ds.GetBody(thread, nil, starlark.Tuple{}, c.kwargs)
+			if err != nil {
+				t.Errorf("case %d: unexpected error: %s", i, err)
+				continue
+			}
+			if got.String() != c.expect {
+				t.Errorf("case %d (loaded: %t): expected: %s, got: %s", i, loaded, c.expect, got)
+			}
+		}
+	}
+
+	// reading part of the body leaves the rest of the body readable
+	ds := jsonDataset(`{"a": 1, "b": 2, "c": 3}`, dataset.BaseSchemaObject)
+	got, err := ds.GetBody(thread, nil, starlark.Tuple{}, []starlark.Tuple{kw("offset", 1), kw("limit", 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := `{"b": 2}`; got.String() != expect {
+		t.Errorf("expected: %s, got: %s", expect, got)
+	}
+	if got, err = ds.GetBody(thread, nil, starlark.Tuple{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if expect := `{"a": 1, "b": 2, "c": 3}`; got.String() != expect {
+		t.Errorf("expected the full body after a range read: %s, got: %s", expect, got)
+	}
+
+	expect := "get_body: offset cannot be negative"
+	if _, err := ds.GetBody(thread, nil, starlark.Tuple{}, []starlark.Tuple{kw("offset", -1)}); err == nil || err.Error() != expect {
+		t.Errorf("expected error: %q, got: %v", expect, err)
+	}
+}
+
+func TestGetEntry(t *testing.T) {
+	thread := &starlark.Thread{}
+	get := func(ds *Dataset, key starlark.Value) (starlark.Value, error) {
+		return ds.GetEntry(thread, nil, starlark.Tuple{key}, nil)
+	}
+
+	arr := jsonDataset(`[["a", 1], ["b", 2]]`, dataset.BaseSchemaArray)
+	obj := jsonDataset(`{"a": [1], "b": [2]}`, dataset.BaseSchemaObject)
+	for _, loaded := range []bool{false, true} {
+		if loaded {
+			for _, ds := range []*Dataset{arr, obj} {
+				if _, err := ds.GetBody(thread, nil, starlark.Tuple{}, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+
+		cases := []struct {
+			ds     *Dataset
+			key    starlark.Value
+			expect string
+		}{
+			{arr, starlark.MakeInt(1), `["b", 2]`},
+			{obj, starlark.String("a"), `[1]`},
+		}
+		for i, c := range cases {
+			got, err := get(c.ds, c.key)
+			if err != nil {
+				t.Errorf("case %d (loaded: %t): unexpected error: %s", i, loaded, err)
+				continue
+			}
+			if got.String() != c.expect {
+				t.Errorf("case %d (loaded: %t): expected: %s, got: %s", i, loaded, c.expect, got)
+			}
+		}
+
+		errs := []struct {
+			ds     *Dataset
+			key    starlark.Value
+			expect string
+		}{
+			{arr, starlark.MakeInt(2), "get_entry: index 2 out of range, body has 2 entries"},
+			{arr, starlark.MakeInt(-1), "get_entry: index must be a non-negative int, got -1"},
+			{arr, starlark.String("a"), "get_entry: array bodies are indexed by int"},
+			{obj, starlark.MakeInt(0), "get_entry: object bodies are indexed by string keys"},
+			{obj, starlark.String("c"), `get_entry: body has no key "c"`},
+			{obj, starlark.None, "get_entry: expected an int index or string key, got NoneType"},
+		}
+		for i, c := range errs {
+			if _, err := get(c.ds, c.key); err == nil || err.Error() != c.expect {
+				t.Errorf("case %d (loaded: %t): expected error: %q, got: %v", i, loaded, c.expect, err)
+			}
+		}
+	}
+
+	if _, err := get(NewDataset(nil, nil), starlark.MakeInt(0)); err == nil || err.Error() != "get_entry: dataset has no body" {
+		t.Errorf("expected a no body error, got: %v", err)
+	}
+}
+
+func TestStreamBody(t *testing.T) {
+	readAll := func(d *Dataset, provider *dataset.Dataset) string {
+		var data []byte
+		err := d.streamBody(provider, func(r io.Reader) (err error) {
+			data, err = ioutil.ReadAll(r)
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	// files that can't be rewound or reopened are kept in memory to read again
+	prev := &dataset.Dataset{}
+	prev.SetBodyFile(qfs.NewMemfileReader("body.json", strings.NewReader("[1,2]")))
+	d := NewDataset(prev, nil)
+	for i := 0; i < 2; i++ {
+		if got := readAll(d, prev); got != "[1,2]" {
+			t.Errorf("read %d: expected body [1,2], got: %q", i, got)
+		}
+	}
+	if _, ok := prev.BodyFile().(io.Seeker); !ok {
+		t.Error("expected the body to be rewindable after the first read")
+	}
+
+	// files with a body path are reopened after reading
+	prev = &dataset.Dataset{BodyPath: "/body.json"}
+	prev.SetBodyFile(qfs.NewMemfileReader("body.json", strings.NewReader("[3]")))
+	d = NewDataset(prev, nil)
+	opens := 0
+	d.SetBodyOpener(func(ds *dataset.Dataset) error {
+		opens++
+		ds.SetBodyFile(qfs.NewMemfileReader("body.json", strings.NewReader("[3]")))
+		return nil
+	})
+	for i := 0; i < 2; i++ {
+		if got := readAll(d, prev); got != "[3]" {
+			t.Errorf("read %d: expected body [3], got: %q", i, got)
+		}
+	}
+	if opens != 2 {
+		t.Errorf("expected the body to be reopened after each read, got %d opens", opens)
+	}
+	if _, ok := prev.BodyFile().(io.Seeker); ok {
+		t.Error("expected a reopened body not to be held in memory")
+	}
+}
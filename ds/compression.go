@@ -0,0 +1,106 @@
+package ds
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/qri-io/dataset"
+)
+
+// compressions lists the compression values parse_as data can be decoded with
+var compressions = []string{"gzip", "zip", "bz2"}
+
+// maxDecompressedSize is the most bytes compressed data can decode to, so small
+// archives can't expand to exhaust memory
+var maxDecompressedSize int64 = 256 << 20
+
+// decompress decodes compressed data. zip archives read the named member, or
+// their only file if member is empty
+func decompress(data []byte, compression, member string) ([]byte, error) {
+	if member != "" && compression != "zip" {
+		return nil, fmt.Errorf("member can only be used with zip compression")
+	}
+
+	var r io.Reader
+	switch compression {
+	case "":
+		return data, nil
+	case "gzip":
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("reading gzip data: %s", err)
+		}
+		defer gz.Close()
+		r = gz
+	case "bz2":
+		r = bzip2.NewReader(bytes.NewReader(data))
+	case "zip":
+		f, err := zipMember(data, member)
+		if err != nil {
+			return nil, err
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf("reading zip member '%s': %s", f.Name, err)
+		}
+		defer rc.Close()
+		r = rc
+	default:
+		return nil, fmt.Errorf("invalid compression: '%s', expected one of: %s", compression, strings.Join(compressions, ", "))
+	}
+
+	out, err := ioutil.ReadAll(io.LimitReader(r, maxDecompressedSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading %s data: %s", compression, err)
+	}
+	if int64(len(out)) > maxDecompressedSize {
+		return nil, fmt.Errorf("%s data decompresses to more than %d bytes", compression, maxDecompressedSize)
+	}
+	return out, nil
+}
+
+// zipMember finds a file in a zip archive by name, defaulting to the only file in
+// the archive when name is empty
+func zipMember(data []byte, name string) (*zip.File, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("reading zip data: %s", err)
+	}
+
+	var names []string
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		if f.Name == name {
+			return f, nil
+		}
+		names = append(names, f.Name)
+	}
+
+	if name == "" && len(names) == 1 {
+		return zipMember(data, names[0])
+	}
+	if name == "" {
+		return nil, fmt.Errorf("zip archive has %d files, choose one with member: %s", len(names), strings.Join(names, ", "))
+	}
+	return nil, fmt.Errorf("zip archive has no member '%s', expected one of: %s", name, strings.Join(names, ", "))
+}
+
+// withSheet returns a copy of an xlsx structure that reads the named sheet
+func withSheet(st *dataset.Structure, sheet string) *dataset.Structure {
+	cfg := map[string]interface{}{}
+	if st != nil && st.Format == "xlsx" {
+		for k, v := range st.FormatConfig {
+			cfg[k] = v
+		}
+	}
+	cfg["sheetName"] = sheet
+	return &dataset.Structure{Format: "xlsx", FormatConfig: cfg}
+}
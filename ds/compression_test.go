@@ -0,0 +1,197 @@
+package ds
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/qri-io/dataset"
+	"go.starlark.net/starlark"
+)
+
+func TestDecompress(t *testing.T) {
+	gz := &bytes.Buffer{}
+	w := gzip.NewWriter(gz)
+	w.Write([]byte("gzipped"))
+	w.Close()
+
+	one := zipData(t, map[string]string{"data.csv": "zipped"})
+	two := zipData(t, map[string]string{"a.csv": "a", "b.csv": "b"})
+
+	cases := []struct {
+		data                []byte
+		compression, member string
+		expect              string
+	}{
+		{[]byte("plain"), "", "", "plain"},
+		{gz.Bytes(), "gzip", "", "gzipped"},
+		{one, "zip", "", "zipped"},
+		{two, "zip", "b.csv", "b"},
+		{readFixture(t, "body.csv.bz2"), "bz2", "", "a,b\n1,2\n3,4\n"},
+	}
+	for i, c := range cases {
+		got, err := decompress(c.data, c.compression, c.member)
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %s", i, err)
+			continue
+		}
+		if string(got) != c.expect {
+			t.Errorf("case %d: expected: %q, got: %q", i, c.expect, got)
+		}
+	}
+
+	errs := []struct {
+		data                []byte
+		compression, member string
+		expect              string
+	}{
+		{[]byte("plain"), "rar", "", "invalid compression: 'rar', expected one of: gzip, zip, bz2"},
+		{[]byte("plain"), "gzip", "", "reading gzip data: unexpected EOF"},
+		{gz.Bytes(), "gzip", "a.csv", "member can only be used with zip compression"},
+		{two, "zip", "", "zip archive has 2 files, choose one with member: a.csv, b.csv"},
+		{two, "zip", "c.csv", "zip archive has no member 'c.csv', expected one of: a.csv, b.csv"},
+		{[]byte("plain"), "bz2", "", "reading bz2 data: bzip2 data invalid: bad magic value"},
+	}
+	for i, c := range errs {
+		if _, err := decompress(c.data, c.compression, c.member); err == nil || err.Error() != c.expect {
+			t.Errorf("case %d: expected error: %q, got: %v", i, c.expect, err)
+		}
+	}
+
+	defer func(max int64) { maxDecompressedSize = max }(maxDecompressedSize)
+	maxDecompressedSize = 4
+	expect := "gzip data decompresses to more than 4 bytes"
+	if _, err := decompress(gz.Bytes(), "gzip", ""); err == nil || err.Error() != expect {
+		t.Errorf("expected error: %q, got: %v", expect, err)
+	}
+	maxDecompressedSize = int64(len("gzipped"))
+	if got, err := decompress(gz.Bytes(), "gzip", ""); err != nil || string(got) != "gzipped" {
+		t.Errorf("expected data at the size limit to decompress, got: %q, %v", got, err)
+	}
+}
+
+func TestSetBodyCompression(t *testing.T) {
+	thread := &starlark.Thread{}
+	ds := NewDataset(nil, nil)
+	ds.SetMutable(&dataset.Dataset{})
+	kw := func(k, v string) starlark.Tuple {
+		return starlark.Tuple{starlark.String(k), starlark.String(v)}
+	}
+
+	data := zipData(t, map[string]string{"readme.txt": "hi", "data/body.csv": "a,b\n1,2\n"})
+	kwargs := []starlark.Tuple{kw("parse_as", "csv"), kw("compression", "zip"), kw("member", "data/body.csv")}
+	if _, err := ds.SetBody(thread, nil, starlark.Tuple{starlark.String(data)}, kwargs); err != nil {
+		t.Fatal(err)
+	}
+	if st := ds.write.Structure; st.Format != "csv" || st.Entries != 1 {
+		t.Errorf("expected a csv structure with 1 entry, got: %#v", st)
+	}
+	body, err := ds.GetBody(thread, nil, starlark.Tuple{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := "[[1, 2]]"; body.String() != expect {
+		t.Errorf("expected body: %s, got: %s", expect, body)
+	}
+
+	errs := []struct {
+		kwargs []starlark.Tuple
+		expect string
+	}{
+		{[]starlark.Tuple{kw("compression", "gzip")}, "set_body: compression, member & sheet require parse_as"},
+		{[]starlark.Tuple{kw("parse_as", "csv"), kw("sheet", "Sheet1")}, "set_body: sheet can only be used when parsing xlsx"},
+		{[]starlark.Tuple{kw("parse_as", "csv"), kw("compression", "zip"), kw("member", "body.csv")}, "set_body: zip archive has no member 'body.csv', expected one of: data/body.csv, readme.txt"},
+	}
+	for _, c := range errs {
+		if _, err := ds.SetBody(thread, nil, starlark.Tuple{starlark.String(data)}, c.kwargs); err == nil || err.Error() != c.expect {
+			t.Errorf("expected error: %q, got: %v", c.expect, err)
+		}
+	}
+
+	// bz2 compressed csv
+	kwargs = []starlark.Tuple{kw("parse_as", "csv"), kw("compression", "bz2")}
+	if _, err := ds.SetBody(thread, nil, starlark.Tuple{starlark.String(readFixture(t, "body.csv.bz2"))}, kwargs); err != nil {
+		t.Fatal(err)
+	}
+	if body, err = ds.GetBody(thread, nil, starlark.Tuple{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if expect := "[[1, 2], [3, 4]]"; body.String() != expect {
+		t.Errorf("expected bz2 body: %s, got: %s", expect, body)
+	}
+
+	if st := withSheet(&dataset.Structure{Format: "xlsx", FormatConfig: map[string]interface{}{"sheetName": "a"}}, "b"); st.FormatConfig["sheetName"] != "b" {
+		t.Errorf("expected sheetName b, got: %v", st.FormatConfig)
+	}
+}
+
+func TestSetBodyXLSXSheet(t *testing.T) {
+	thread := &starlark.Thread{}
+	ds := NewDataset(nil, nil)
+	ds.SetMutable(&dataset.Dataset{})
+	kw := func(k, v string) starlark.Tuple {
+		return starlark.Tuple{starlark.String(k), starlark.String(v)}
+	}
+	data := starlark.String(readFixture(t, "sheets.xlsx"))
+
+	cases := []struct {
+		sheet, expect string
+	}{
+		{"Sheet1", `[["a", "b"]]`},
+		{"animals", `[["cat", "dog"], ["owl", "hen"]]`},
+	}
+	for _, c := range cases {
+		kwargs := []starlark.Tuple{kw("parse_as", "xlsx"), kw("sheet", c.sheet)}
+		if _, err := ds.SetBody(thread, nil, starlark.Tuple{data}, kwargs); err != nil {
+			t.Fatalf("sheet %s: %s", c.sheet, err)
+		}
+		if st := ds.write.Structure; st.Format != "xlsx" || st.FormatConfig["sheetName"] != c.sheet {
+			t.Errorf("sheet %s: expected an xlsx structure reading the sheet, got: %#v", c.sheet, st)
+		}
+		body, err := ds.GetBody(thread, nil, starlark.Tuple{}, nil)
+		if err != nil {
+			t.Fatalf("sheet %s: %s", c.sheet, err)
+		}
+		if body.String() != c.expect {
+			t.Errorf("sheet %s: expected body: %s, got: %s", c.sheet, c.expect, body)
+		}
+	}
+}
+
+func readFixture(t *testing.T, name string) []byte {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// zipData builds a zip archive of files, written in name order
+func zipData(t *testing.T, files map[string]string) []byte {
+	buf := &bytes.Buffer{}
+	w := zip.NewWriter(buf)
+	for _, name := range sortedKeys(files) {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(files[name]))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
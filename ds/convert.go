@@ -0,0 +1,245 @@
+package ds
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	starlibtime "github.com/qri-io/starlib/time"
+	"github.com/qri-io/starlib/util"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// typedSchema marks the values of a schema that convert to typed starlark values:
+// strings with format "date-time" become times, and values with format
+// "decimal" become decimals. a nil *typedSchema has no typed values
+type typedSchema struct {
+	format string
+	// items describes every item of an array, cols describes items by position
+	items *typedSchema
+	cols  []*typedSchema
+	props map[string]*typedSchema
+}
+
+// newTypedSchema finds typed values in a json schema, returning nil if there
+// aren't any
+func newTypedSchema(sch map[string]interface{}) *typedSchema {
+	if sch == nil {
+		return nil
+	}
+	t := &typedSchema{}
+	typed := false
+
+	if f, _ := sch["format"].(string); f == "date-time" || f == "decimal" {
+		t.format = f
+		typed = true
+	}
+	switch items := sch["items"].(type) {
+	case map[string]interface{}:
+		if t.items = newTypedSchema(items); t.items != nil {
+			typed = true
+		}
+	case []interface{}:
+		t.cols = make([]*typedSchema, len(items))
+		for i, item := range items {
+			sch, _ := item.(map[string]interface{})
+			if t.cols[i] = newTypedSchema(sch); t.cols[i] != nil {
+				typed = true
+			}
+		}
+	}
+	if props, ok := sch["properties"].(map[string]interface{}); ok {
+		t.props = map[string]*typedSchema{}
+		for key, prop := range props {
+			sch, _ := prop.(map[string]interface{})
+			if p := newTypedSchema(sch); p != nil {
+				t.props[key] = p
+				typed = true
+			}
+		}
+	}
+
+	if !typed {
+		return nil
+	}
+	return t
+}
+
+// hasDecimal reports whether any value of the schema is a decimal
+func (t *typedSchema) hasDecimal() bool {
+	if t == nil {
+		return false
+	}
+	if t.format == "decimal" || t.items.hasDecimal() {
+		return true
+	}
+	for _, c := range t.cols {
+		if c.hasDecimal() {
+			return true
+		}
+	}
+	for _, p := range t.props {
+		if p.hasDecimal() {
+			return true
+		}
+	}
+	return false
+}
+
+// item gives the schema of the array item at index i
+func (t *typedSchema) item(i int) *typedSchema {
+	if t == nil {
+		return nil
+	}
+	if t.cols != nil {
+		if i < len(t.cols) {
+			return t.cols[i]
+		}
+		return nil
+	}
+	return t.items
+}
+
+// prop gives the schema of an object property
+func (t *typedSchema) prop(key string) *typedSchema {
+	if t == nil {
+		return nil
+	}
+	return t.props[key]
+}
+
+// marshalTyped converts a go value to starlark, creating times & decimals where
+// the schema declares them. values that don't parse as their declared type are
+// left as they are. json.Number values that aren't decimals become ints or floats
+func marshalTyped(v interface{}, t *typedSchema) (starlark.Value, error) {
+	if t == nil {
+		return util.Marshal(jsonNumbers(v))
+	}
+
+	switch t.format {
+	case "date-time":
+		if s, ok := v.(string); ok {
+			if ts, err := time.Parse(time.RFC3339Nano, s); err == nil {
+				return starlibtime.Time(ts), nil
+			}
+		}
+	case "decimal":
+		if d, ok := goDecimal(v); ok {
+			return d, nil
+		}
+	}
+
+	switch x := v.(type) {
+	case []interface{}:
+		vals := make([]starlark.Value, len(x))
+		for i, e := range x {
+			val, err := marshalTyped(e, t.item(i))
+			if err != nil {
+				return nil, err
+			}
+			vals[i] = val
+		}
+		return starlark.NewList(vals), nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		dict := starlark.NewDict(len(x))
+		for _, k := range keys {
+			val, err := marshalTyped(x[k], t.prop(k))
+			if err != nil {
+				return nil, err
+			}
+			if err := dict.SetKey(starlark.String(k), val); err != nil {
+				return nil, err
+			}
+		}
+		return dict, nil
+	}
+	return util.Marshal(jsonNumbers(v))
+}
+
+// goDecimal converts a decoded number or numeric string to a decimal
+func goDecimal(v interface{}) (Decimal, bool) {
+	var s string
+	switch x := v.(type) {
+	case string:
+		s = x
+	case json.Number:
+		s = string(x)
+	case int:
+		s = strconv.Itoa(x)
+	case int64:
+		s = strconv.FormatInt(x, 10)
+	case float64:
+		s = strconv.FormatFloat(x, 'f', -1, 64)
+	default:
+		return Decimal{}, false
+	}
+	d, err := ParseDecimal(s)
+	return d, err == nil
+}
+
+// unmarshalTyped converts a starlark value to go, writing times as RFC3339
+// strings & decimals as json numbers so they keep their exact value. any
+// IterableMapping converts to an object, & must have string keys. structs convert
+// to objects of their fields
+func unmarshalTyped(v starlark.Value) (interface{}, error) {
+	switch x := v.(type) {
+	case starlibtime.Time:
+		return time.Time(x).Format(time.RFC3339Nano), nil
+	case Decimal:
+		return json.Number(x.String()), nil
+	case *starlark.List:
+		return unmarshalElems(x)
+	case starlark.Tuple:
+		return unmarshalElems(x)
+	case *starlarkstruct.Struct:
+		return unmarshalTyped(structDict(x))
+	case starlark.IterableMapping:
+		items := x.Items()
+		obj := make(map[string]interface{}, len(items))
+		for _, item := range items {
+			key, ok := starlark.AsString(item[0])
+			if !ok {
+				return nil, fmt.Errorf("%s keys must be strings, got %s: %s", x.Type(), item[0].Type(), item[0])
+			}
+			val, err := unmarshalTyped(item[1])
+			if err != nil {
+				return nil, err
+			}
+			obj[key] = val
+		}
+		return obj, nil
+	}
+	return util.Unmarshal(v)
+}
+
+// structDict gives the fields of a struct as a dict, in field name order
+func structDict(s *starlarkstruct.Struct) *starlark.Dict {
+	names := s.AttrNames()
+	d := starlark.NewDict(len(names))
+	for _, name := range names {
+		// struct fields are always found, so errors can't happen
+		v, _ := s.Attr(name)
+		d.SetKey(starlark.String(name), v)
+	}
+	return d
+}
+
+func unmarshalElems(elems starlark.Indexable) (interface{}, error) {
+	vals := make([]interface{}, elems.Len())
+	for i := range vals {
+		val, err := unmarshalTyped(elems.Index(i))
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = val
+	}
+	return vals, nil
+}
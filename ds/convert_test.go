@@ -0,0 +1,151 @@
+package ds
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/qri-io/dataset"
+	"github.com/qri-io/qfs"
+	starlibtime "github.com/qri-io/starlib/time"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+func TestTypedBody(t *testing.T) {
+	thread := &starlark.Thread{}
+	prev := &dataset.Dataset{Structure: &dataset.Structure{
+		Format: "json",
+		Schema: map[string]interface{}{
+			"type": "array",
+			"items": map[string]interface{}{
+				"type": "array",
+				"items": []interface{}{
+					map[string]interface{}{"title": "at", "type": "string", "format": "date-time"},
+					map[string]interface{}{"title": "amount", "type": "number", "format": "decimal"},
+					map[string]interface{}{"title": "note", "type": "string"},
+				},
+			},
+		},
+	}}
+	prev.SetBodyFile(qfs.NewMemfileBytes("body.json", []byte(`[["2019-07-01T12:00:00Z",0.1,"2019-07-01T12:00:00Z"]]`)))
+	ds := NewDataset(prev, nil)
+	ds.SetMutable(&dataset.Dataset{})
+
+	body, err := ds.GetBody(thread, nil, starlark.Tuple{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	row := body.(*starlark.List).Index(0).(*starlark.List)
+	at, ok := row.Index(0).(starlibtime.Time)
+	if !ok || !time.Time(at).Equal(time.Date(2019, 7, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected a date-time column to read as a time, got: %s %v", row.Index(0).Type(), row.Index(0))
+	}
+	amount, ok := row.Index(1).(Decimal)
+	if !ok || amount.String() != "0.1" {
+		t.Errorf("expected a decimal column to read as a decimal, got: %s %v", row.Index(1).Type(), row.Index(1))
+	}
+	if _, ok := row.Index(2).(starlark.String); !ok {
+		t.Errorf("expected a string column without a format to read as a string, got: %s", row.Index(2).Type())
+	}
+
+	// decimal arithmetic is exact & written back without rounding errors
+	two, _ := ParseDecimal("0.2")
+	total, err := starlark.Binary(syntax.PLUS, amount, two)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := starlark.NewList([]starlark.Value{
+		starlark.NewList([]starlark.Value{at, total, starlark.String("x")}),
+	})
+	if _, err := ds.SetBody(thread, nil, starlark.Tuple{next}, nil); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(ds.write.BodyFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := `[["2019-07-01T12:00:00Z",0.3,"x"]]`; string(data) != expect {
+		t.Errorf("body mismatch, expected: %s, got: %s", expect, data)
+	}
+}
+
+func TestDecimalPrecision(t *testing.T) {
+	thread := &starlark.Thread{}
+	prev := &dataset.Dataset{Structure: &dataset.Structure{
+		Format: "json",
+		Schema: map[string]interface{}{
+			"type": "array",
+			"items": map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"amount": map[string]interface{}{"type": "number", "format": "decimal"},
+					"n":      map[string]interface{}{"type": "integer"},
+				},
+			},
+		},
+	}}
+	// the first amount has more digits than a float64 can hold
+	prev.SetBodyFile(qfs.NewMemfileBytes("body.json", []byte(`[{"amount":12345678901234567.891,"n":2},{"amount":0.1,"n":3.5}]`)))
+	ds := NewDataset(prev, nil)
+
+	body, err := ds.GetBody(thread, nil, starlark.Tuple{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := `[{"amount": 12345678901234567.891, "n": 2}, {"amount": 0.1, "n": 3.5}]`; body.String() != expect {
+		t.Errorf("body mismatch.\nexpected: %s\ngot:      %s", expect, body)
+	}
+	ds.bodyCache = nil
+	entry, err := ds.GetEntry(thread, nil, starlark.Tuple{starlark.MakeInt(0)}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	amount, _, _ := entry.(*starlark.Dict).Get(starlark.String("amount"))
+	if d, ok := amount.(Decimal); !ok || d.String() != "12345678901234567.891" {
+		t.Errorf("expected get_entry to read the exact decimal, got: %v", amount)
+	}
+
+	stats, err := ds.GetStats(thread, nil, starlark.Tuple{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cols, _, _ := stats.(*starlark.Dict).Get(starlark.String("columns"))
+	col, _, _ := cols.(*starlark.Dict).Get(starlark.String("amount"))
+	max, _, _ := col.(*starlark.Dict).Get(starlark.String("max"))
+	if d, ok := max.(Decimal); !ok || d.String() != "12345678901234567.891" {
+		t.Errorf("expected get_stats to give the exact decimal max, got: %v", max)
+	}
+}
+
+func TestInferTypedSchema(t *testing.T) {
+	thread := &starlark.Thread{}
+	ds := NewDataset(nil, nil)
+	ds.SetMutable(&dataset.Dataset{})
+
+	at := starlibtime.Time(time.Date(2019, 7, 1, 12, 0, 0, 0, time.UTC))
+	price, _ := ParseDecimal("1.50")
+	rows := starlark.NewList([]starlark.Value{
+		starlark.NewList([]starlark.Value{at, price, starlark.MakeInt(1)}),
+		starlark.NewList([]starlark.Value{at, starlark.MakeInt(2), starlark.Float(1.5)}),
+	})
+	if _, err := ds.SetBody(thread, nil, starlark.Tuple{rows}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	items := schemaItems(ds.write.Structure.Schema)
+	expect := []string{"date-time", "decimal", ""}
+	for i, item := range items {
+		if got, _ := item.(map[string]interface{})["format"].(string); got != expect[i] {
+			t.Errorf("column %d: expected format %q, got: %q", i, expect[i], got)
+		}
+	}
+
+	body, err := ds.GetBody(thread, nil, starlark.Tuple{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := body.(*starlark.List).Index(1).(*starlark.List).Index(1); got.Type() != "decimal" || got.String() != "2" {
+		t.Errorf("expected an int in a decimal column to read as a decimal, got: %s %v", got.Type(), got)
+	}
+}
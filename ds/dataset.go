@@ -4,12 +4,13 @@ package ds
 import (
 	"encoding/json"
 	"fmt"
-	"io/ioutil"
+	"io"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/qri-io/dataset"
 	"github.com/qri-io/dataset/dsio"
-	"github.com/qri-io/qfs"
 	"github.com/qri-io/starlib/util"
 	"go.starlark.net/starlark"
 	"go.starlark.net/starlarkstruct"
@@ -30,7 +31,9 @@ func LoadModule() (starlark.StringDict, error) {
 	once.Do(func() {
 		datasetModule = starlark.StringDict{
 			"dataset": starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
-				"new": starlark.NewBuiltin("new", New),
+				"new":     starlark.NewBuiltin("new", New),
+				"table":   starlark.NewBuiltin("table", MakeTable),
+				"decimal": starlark.NewBuiltin("decimal", decimalBuiltin),
 			}),
 		}
 	})
@@ -42,6 +45,18 @@ func LoadModule() (starlark.StringDict, error) {
 // a path as possible and bail if an error is returned
 type MutateFieldCheck func(path ...string) error
 
+// VersionLoader fetches a dataset version by path. Returned datasets should
+// have an open body file if the version has a body
+type VersionLoader func(path string) (*dataset.Dataset, error)
+
+// BodyOpener opens the body file of a dataset that has a body path, such as
+// with dataset.OpenBodyFile. it's used to read a body again after streaming it
+type BodyOpener func(ds *dataset.Dataset) error
+
+// TimingFunc records time spent on an operation, such as converting a body
+// between starlark & qri data
+type TimingFunc func(name string, d time.Duration)
+
 // Dataset is a qri dataset starlark type
 type Dataset struct {
 	read      *dataset.Dataset
@@ -49,6 +64,11 @@ type Dataset struct {
 	bodyCache starlark.Iterable
 	check     MutateFieldCheck
 	modBody   bool
+
+	loadVersion VersionLoader
+	openBody    BodyOpener
+	history     []*dataset.Dataset
+	timing      TimingFunc
 }
 
 // NewDataset creates a dataset object, intended to be called from go-land to prepare datasets
@@ -68,6 +88,31 @@ func (d *Dataset) SetMutable(ds *dataset.Dataset) {
 	d.write = ds
 }
 
+// SetVersionLoader assigns the function used to walk back through previous
+// versions of the read dataset with get_history
+func (d *Dataset) SetVersionLoader(load VersionLoader) {
+	d.loadVersion = load
+}
+
+// SetBodyOpener assigns the function used to reopen body files that can't be
+// rewound once they've been read
+func (d *Dataset) SetBodyOpener(open BodyOpener) {
+	d.openBody = open
+}
+
+// SetTimingFunc assigns a function to record time spent converting bodies in
+// get_body & set_body
+func (d *Dataset) SetTimingFunc(fn TimingFunc) {
+	d.timing = fn
+}
+
+// since records time elapsed since start with the timing func, if one is set
+func (d *Dataset) since(name string, start time.Time) {
+	if d.timing != nil {
+		d.timing(name, time.Since(start))
+	}
+}
+
 // IsBodyModified returns whether the body has been modified by set_body
 func (d *Dataset) IsBodyModified() bool {
 	return d.modBody
@@ -81,7 +126,12 @@ func (d *Dataset) Methods() *starlarkstruct.Struct {
 		"get_structure": starlark.NewBuiltin("get_structure", d.GetStructure),
 		"set_structure": starlark.NewBuiltin("set_structure", d.SetStructure),
 		"get_body":      starlark.NewBuiltin("get_body", d.GetBody),
+		"get_table":     starlark.NewBuiltin("get_table", d.GetTable),
+		"get_entry":     starlark.NewBuiltin("get_entry", d.GetEntry),
+		"get_stats":     starlark.NewBuiltin("get_stats", d.GetStats),
 		"set_body":      starlark.NewBuiltin("set_body", d.SetBody),
+		"get_history":   starlark.NewBuiltin("get_history", d.GetHistory),
+		"infer_schema":  starlark.NewBuiltin("infer_schema", d.InferSchema),
 	})
 }
 
@@ -214,25 +264,64 @@ func (d *Dataset) SetStructure(thread *starlark.Thread, _ *starlark.Builtin, arg
 
 // GetBody returns the body of the dataset we're transforming. The read version is returned until
 // the dataset is modified by set_body, then the write version is returned instead.
+// Passing as_dicts=True returns rows of an array body as dicts keyed by the column titles of the
+// structure's schema. offset & limit read part of the body, without loading all of it
 func (d *Dataset) GetBody(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
-	if d.bodyCache != nil {
-		return d.bodyCache, nil
+	var (
+		valx    starlark.Value
+		asDicts bool
+		offset  = 0
+		limit   = -1
+	)
+	if err := starlark.UnpackArgs("get_body", args, kwargs, "default?", &valx, "as_dicts?", &asDicts, "offset?", &offset, "limit?", &limit); err != nil {
+		return starlark.None, err
 	}
 
-	var valx starlark.Value
-	if err := starlark.UnpackArgs("get_body", args, kwargs, "default?", &valx); err != nil {
-		return starlark.None, err
+	var (
+		body starlark.Value
+		err  error
+	)
+	if offset != 0 || limit >= 0 {
+		body, err = d.bodyRange(valx, offset, limit)
+	} else {
+		body, err = d.body(valx)
+	}
+	if err != nil || !asDicts || body == starlark.None {
+		return body, err
 	}
+	return d.rowDicts(body)
+}
 
-	var provider *dataset.Dataset
-	if d.read != nil {
-		provider = d.read
+// rowDicts converts the rows of an array body to dicts keyed by column title
+func (d *Dataset) rowDicts(body starlark.Value) (starlark.Value, error) {
+	rows, ok := body.(*starlark.List)
+	if !ok {
+		return starlark.None, fmt.Errorf("get_body: as_dicts requires an array body, got %s", body.Type())
 	}
-	if d.modBody && d.write != nil {
-		provider = d.write
+
+	var items []interface{}
+	if st := d.bodyStructure(); st != nil {
+		items = schemaItems(st.Schema)
+	}
+	t, err := tableFromRows(rows, nil, items)
+	if err != nil {
+		return starlark.None, fmt.Errorf("get_body: %s", err)
+	}
+	dicts := make([]starlark.Value, t.Len())
+	for i := range dicts {
+		dicts[i] = t.rowDict(i)
+	}
+	return starlark.NewList(dicts), nil
+}
+
+// body reads the body get_body returns, returning valx if the dataset has no body
+func (d *Dataset) body(valx starlark.Value) (starlark.Value, error) {
+	if d.bodyCache != nil {
+		return d.bodyCache, nil
 	}
 
-	if provider.BodyFile() == nil {
+	provider := d.bodyProvider()
+	if provider == nil || provider.BodyFile() == nil {
 		if valx == nil {
 			return starlark.None, nil
 		}
@@ -242,24 +331,19 @@ func (d *Dataset) GetBody(thread *starlark.Thread, _ *starlark.Builtin, args sta
 	if provider.Structure == nil {
 		return starlark.None, fmt.Errorf("error: no structure for dataset")
 	}
+	defer d.since("get_body", time.Now())
 
-	// TODO - this is bad. make not bad.
-	data, err := ioutil.ReadAll(provider.BodyFile())
-	if err != nil {
-		return starlark.None, err
-	}
-	provider.SetBodyFile(qfs.NewMemfileBytes("body.json", data))
-
-	rr, err := dsio.NewEntryReader(provider.Structure, qfs.NewMemfileBytes("body.json", data))
-	if err != nil {
-		return starlark.None, fmt.Errorf("error allocating data reader: %s", err)
-	}
 	w, err := NewStarlarkEntryWriter(provider.Structure)
 	if err != nil {
 		return starlark.None, fmt.Errorf("error allocating starlark entry writer: %s", err)
 	}
-
-	err = dsio.Copy(rr, w)
+	err = d.streamBody(provider, func(data io.Reader) error {
+		rr, err := newBodyReader(provider.Structure, data)
+		if err != nil {
+			return fmt.Errorf("error allocating data reader: %s", err)
+		}
+		return dsio.Copy(rr, w)
+	})
 	if err != nil {
 		return starlark.None, err
 	}
@@ -274,15 +358,113 @@ func (d *Dataset) GetBody(thread *starlark.Thread, _ *starlark.Builtin, args sta
 	return starlark.None, fmt.Errorf("value is not iterable")
 }
 
+// GetTable gets the dataset body as a table, naming columns with the titles of the
+// structure's schema. The body must be an array of rows
+func (d *Dataset) GetTable(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackArgs("get_table", args, kwargs); err != nil {
+		return starlark.None, err
+	}
+
+	body, err := d.GetBody(thread, nil, nil, nil)
+	if err != nil {
+		return starlark.None, err
+	}
+	if body == starlark.None {
+		return starlark.None, nil
+	}
+	rows, ok := body.(*starlark.List)
+	if !ok {
+		return starlark.None, fmt.Errorf("get_table: body must be an array of rows, got %s", body.Type())
+	}
+
+	var items []interface{}
+	if st := d.bodyStructure(); st != nil {
+		items = schemaItems(st.Schema)
+	}
+	return tableFromRows(rows, nil, items)
+}
+
+// bodyStructure returns the structure of the body get_body reads
+func (d *Dataset) bodyStructure() *dataset.Structure {
+	if d.modBody && d.write != nil {
+		return d.write.Structure
+	}
+	if d.read != nil {
+		return d.read.Structure
+	}
+	return nil
+}
+
+// formatStructure returns the structure set_body writes with, falling back to the
+// read structure
+func (d *Dataset) formatStructure() *dataset.Structure {
+	if d.write != nil && d.write.Structure != nil {
+		return d.write.Structure
+	}
+	if d.read != nil {
+		return d.read.Structure
+	}
+	return nil
+}
+
+// isTabular reports whether a structure describes rows of columns, either with a
+// tabular format or a schema of arrays of arrays
+func isTabular(st *dataset.Structure) bool {
+	if st == nil {
+		return false
+	}
+	if st.Format == "csv" || st.Format == "xlsx" {
+		return true
+	}
+	rows, ok := st.Schema["items"].(map[string]interface{})
+	return ok && rows["type"] == "array"
+}
+
+// isObject reports whether body data is an object body: a mapping with keys
+// that can be iterated
+func isObject(data starlark.Value) bool {
+	_, ok := data.(starlark.IterableMapping)
+	return ok
+}
+
+// isDictRows reports whether a list is made up of dicts
+func isDictRows(rows *starlark.List) bool {
+	if rows.Len() == 0 {
+		return false
+	}
+	for i := 0; i < rows.Len(); i++ {
+		if _, ok := rows.Index(i).(*starlark.Dict); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// schemaItems finds the column schemas of a tabular schema, which describes an
+// array of arrays with an array of items schemas
+func schemaItems(schema map[string]interface{}) []interface{} {
+	rows, ok := schema["items"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	items, _ := rows["items"].([]interface{})
+	return items
+}
+
 // SetBody assigns the dataset body. Future calls to GetBody will return this newly mutated body,
 // even if assigned value is the same as what was already there.
 func (d *Dataset) SetBody(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
 	var (
-		data    starlark.Value
-		parseAs starlark.String
+		data         starlark.Value
+		parseAs      starlark.String
+		format       starlark.String
+		formatConfig *starlark.Dict
+		compression  string
+		member       string
+		sheet        string
 	)
 
-	if err := starlark.UnpackArgs("set_body", args, kwargs, "data", &data, "parse_as?", &parseAs); err != nil {
+	if err := starlark.UnpackArgs("set_body", args, kwargs, "data", &data, "parse_as?", &parseAs, "format?", &format, "format_config?", &formatConfig, "compression?", &compression, "member?", &member, "sheet?", &sheet); err != nil {
 		return starlark.None, err
 	}
 
@@ -298,9 +480,16 @@ func (d *Dataset) SetBody(thread *starlark.Thread, _ *starlark.Builtin, args sta
 		err = fmt.Errorf("cannot use a transform to set the body of a dataset and manually adjust structure at the same time")
 		return starlark.None, err
 	}
+	defer d.since("set_body", time.Now())
 
 	df := parseAs.GoString()
+	if df == "" && (compression != "" || member != "" || sheet != "") {
+		return starlark.None, fmt.Errorf("set_body: compression, member & sheet require parse_as")
+	}
 	if df != "" {
+		if format != "" || formatConfig != nil {
+			return starlark.None, fmt.Errorf("set_body: format & format_config can't be combined with parse_as")
+		}
 		if _, err := dataset.ParseDataFormatString(df); err != nil {
 			return starlark.None, fmt.Errorf("invalid parse_as format: '%s'", df)
 		}
@@ -310,61 +499,338 @@ func (d *Dataset) SetBody(thread *starlark.Thread, _ *starlark.Builtin, args sta
 			return starlark.None, fmt.Errorf("expected data for '%s' format to be a string", df)
 		}
 
-		d.write.SetBodyFile(qfs.NewMemfileBytes(fmt.Sprintf("body.%s", df), []byte(string(str))))
+		raw, err := decompress([]byte(string(str)), compression, member)
+		if err != nil {
+			return starlark.None, fmt.Errorf("set_body: %s", err)
+		}
+
+		prev := d.formatStructure()
+		if sheet != "" {
+			if df != "xlsx" {
+				return starlark.None, fmt.Errorf("set_body: sheet can only be used when parsing xlsx")
+			}
+			prev = withSheet(prev, sheet)
+		}
+
+		st, err := DetectStructure(df, raw, prev)
+		if err != nil {
+			return starlark.None, fmt.Errorf("set_body: parsing %s: %s", df, err)
+		}
+
+		d.write.Structure = st
+		d.write.SetBodyFile(newBodyFile(fmt.Sprintf("body.%s", df), raw))
 		d.modBody = true
 		d.bodyCache = nil
 		return starlark.None, nil
 	}
 
+	// the structure to write with, converted to the requested format
+	base := d.formatStructure()
+	if format != "" || formatConfig != nil {
+		var cfg map[string]interface{}
+		if formatConfig != nil {
+			v, err := util.Unmarshal(formatConfig)
+			if err != nil {
+				return starlark.None, fmt.Errorf("set_body: format_config: %s", err)
+			}
+			cfg, _ = v.(map[string]interface{})
+		}
+		var err error
+		if base, err = withFormat(base, format.GoString(), cfg); err != nil {
+			return starlark.None, fmt.Errorf("set_body: %s", err)
+		}
+	}
+
+	// tabular bodies can be set from rows of dicts, ordering columns by the
+	// existing schema
+	if rows, ok := data.(*starlark.List); ok && isDictRows(rows) && isTabular(base) {
+		t, err := tableFromRows(rows, nil, nil)
+		if err != nil {
+			return starlark.None, fmt.Errorf("set_body: %s", err)
+		}
+		data = t.ordered(schemaItems(base.Schema))
+	}
+
+	// structs are object bodies of their fields
+	if s, ok := data.(*starlarkstruct.Struct); ok {
+		data = structDict(s)
+	}
+
 	iter, ok := data.(starlark.Iterable)
 	if !ok {
 		return starlark.None, fmt.Errorf("expected body data to be iterable")
 	}
 
-	d.write.Structure = d.writeStructure(data)
+	// infer a schema from body entries when there's no structure to write with
+	infer := base == nil || base.Schema == nil
+	st := writeStructure(base, data)
+	r := NewEntryReader(st, iter)
+
+	var entries []dsio.Entry
+	if infer {
+		var err error
+		if entries, err = readEntries(r); err != nil {
+			return starlark.None, err
+		}
+		var titles []string
+		t, isTable := data.(*Table)
+		if isTable {
+			titles = t.columns
+		}
+		st.Schema = InferSchema(entries, st.Schema["type"] == "object", titles)
+		if isTable {
+			st.Schema = overlayItems(st.Schema, t.Schema())
+		}
+	}
+	d.write.Structure = st
 
-	w, err := dsio.NewEntryBuffer(d.write.Structure)
+	w, err := dsio.NewEntryBuffer(st)
 	if err != nil {
 		return starlark.None, err
 	}
-
-	r := NewEntryReader(d.write.Structure, iter)
-	if err := dsio.Copy(r, w); err != nil {
+	if infer {
+		for _, e := range entries {
+			if err := w.WriteEntry(e); err != nil {
+				return starlark.None, err
+			}
+		}
+	} else if err := dsio.Copy(r, w); err != nil {
 		return starlark.None, err
 	}
 	if err := w.Close(); err != nil {
 		return starlark.None, err
 	}
 
-	d.write.SetBodyFile(qfs.NewMemfileBytes(fmt.Sprintf("body.%s", d.write.Structure.Format), w.Bytes()))
+	d.write.SetBodyFile(newBodyFile(fmt.Sprintf("body.%s", d.write.Structure.Format), w.Bytes()))
 	d.modBody = true
 	d.bodyCache = nil
 
 	return starlark.None, nil
 }
 
-// writeStructure determines the destination data structure for writing a
-// dataset body, falling back to a default json structure based on input values
-// if no prior structure exists
-func (d *Dataset) writeStructure(data starlark.Value) *dataset.Structure {
-	// if the write structure has been set, use that
-	if d.write != nil && d.write.Structure != nil {
-		return d.write.Structure
+// InferSchema infers a json schema from data, or the dataset body if no data is
+// given. Scripts can inspect or adjust the schema & set it with set_structure
+func (d *Dataset) InferSchema(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		data   starlark.Value
+		titles []string
+	)
+	if err := starlark.UnpackArgs("infer_schema", args, kwargs, "data?", &data); err != nil {
+		return starlark.None, err
 	}
 
-	// fall back to inheriting from read structure
-	if d.read != nil && d.read.Structure != nil {
-		return d.read.Structure
+	if data == nil {
+		var err error
+		if data, err = d.body(nil); err != nil {
+			return starlark.None, err
+		}
+		// keep the column titles of the body's schema
+		if st := d.bodyStructure(); st != nil {
+			for _, item := range schemaItems(st.Schema) {
+				sch, _ := item.(map[string]interface{})
+				title, _ := sch["title"].(string)
+				titles = append(titles, title)
+			}
+		}
+	}
+	if data == starlark.None {
+		return starlark.None, nil
+	}
+	iter, ok := data.(starlark.Iterable)
+	if !ok {
+		return starlark.None, fmt.Errorf("infer_schema: expected body data to be iterable, got %s", data.Type())
 	}
 
-	// use a default of json as a last resort
 	sch := dataset.BaseSchemaArray
-	if data.Type() == "dict" {
+	if isObject(data) {
 		sch = dataset.BaseSchemaObject
 	}
+	entries, err := readEntries(NewEntryReader(&dataset.Structure{Format: "json", Schema: sch}, iter))
+	if err != nil {
+		return starlark.None, err
+	}
 
-	return &dataset.Structure{
-		Format: "json",
-		Schema: sch,
+	t, isTable := data.(*Table)
+	if isTable {
+		titles = t.columns
+	}
+	inferred := InferSchema(entries, isObject(data), titles)
+	if isTable {
+		inferred = overlayItems(inferred, t.Schema())
+	}
+	return util.Marshal(inferred)
+}
+
+// overlayItems replaces the fields of inferred column schemas with fields from
+// the columns of a tabular schema, keeping inferred fields the tabular schema
+// doesn't set
+func overlayItems(inferred, tabular map[string]interface{}) map[string]interface{} {
+	items, cols := schemaItems(inferred), schemaItems(tabular)
+	if items == nil {
+		// nothing was inferred for an empty table
+		return tabular
+	}
+	for i, item := range items {
+		if i >= len(cols) {
+			break
+		}
+		sch, _ := item.(map[string]interface{})
+		col, _ := cols[i].(map[string]interface{})
+		for k, v := range col {
+			sch[k] = v
+		}
+	}
+	return inferred
+}
+
+// GetHistory returns up to n prior versions of the dataset as a list of read-only
+// datasets, starting with the most recent version and walking backward in time
+func (d *Dataset) GetHistory(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	n := 10
+	if err := starlark.UnpackArgs("get_history", args, kwargs, "n?", &n); err != nil {
+		return starlark.None, err
+	}
+	if n < 0 {
+		return starlark.None, fmt.Errorf("get_history: n cannot be negative")
+	}
+
+	versions, err := d.versions(n)
+	if err != nil {
+		return starlark.None, err
+	}
+
+	l := &starlark.List{}
+	for _, v := range versions {
+		l.Append(NewDataset(v, nil).Methods())
+	}
+	return l, nil
+}
+
+// versions loads up to n versions of the read dataset, caching results for
+// subsequent calls
+func (d *Dataset) versions(n int) ([]*dataset.Dataset, error) {
+	if d.read == nil {
+		return nil, nil
+	}
+	if len(d.history) == 0 {
+		d.history = []*dataset.Dataset{d.read}
+	}
+
+	for len(d.history) < n {
+		last := d.history[len(d.history)-1]
+		if last.PreviousPath == "" {
+			break
+		}
+		if d.loadVersion == nil {
+			return nil, fmt.Errorf("no loader available to load dataset version: %s", last.PreviousPath)
+		}
+		v, err := d.loadVersion(last.PreviousPath)
+		if err != nil {
+			return nil, fmt.Errorf("loading dataset version %s: %s", last.PreviousPath, err)
+		}
+		d.history = append(d.history, v)
+	}
+
+	if len(d.history) > n {
+		return d.history[:n], nil
+	}
+	return d.history, nil
+}
+
+// writeStructure determines the structure set_body writes data with, starting
+// from base, the write or read structure converted to any requested format
+func writeStructure(base *dataset.Structure, data starlark.Value) *dataset.Structure {
+	// tables describe their own schema, keeping the format of an existing structure
+	if t, ok := data.(*Table); ok {
+		st := &dataset.Structure{Format: "json"}
+		if base != nil {
+			st.Format, st.FormatConfig = base.Format, base.FormatConfig
+		}
+		st.Schema = t.Schema()
+		return st
+	}
+
+	if base != nil && base.Schema != nil {
+		return base
+	}
+
+	// use a default of json & a base schema as a last resort
+	sch := dataset.BaseSchemaArray
+	if isObject(data) {
+		sch = dataset.BaseSchemaObject
+	}
+	st := &dataset.Structure{Format: "json", Schema: sch}
+	if base != nil {
+		st.Format, st.FormatConfig = base.Format, base.FormatConfig
+	}
+	return st
+}
+
+// bodyFormats are the formats set_body can write
+var bodyFormats = []string{"csv", "json", "cbor", "ndjson", "xlsx"}
+
+// formatConfigKeys maps the format config keys set_body accepts for each format
+// to the keys structures use. snake_case keys are accepted for convenience
+var formatConfigKeys = map[string]map[string]string{
+	"csv": {
+		"headerRow": "headerRow", "header_row": "headerRow",
+		"lazyQuotes": "lazyQuotes", "lazy_quotes": "lazyQuotes",
+		"separator": "separator", "delimiter": "separator",
+		"variadicFields": "variadicFields", "variadic_fields": "variadicFields",
+	},
+	"json":   {"pretty": "pretty"},
+	"ndjson": {},
+	"cbor":   {},
+	"xlsx":   {"sheetName": "sheetName", "sheet_name": "sheetName"},
+}
+
+// withFormat copies a structure, setting its format & format config. Config is
+// merged into the existing config when the format is unchanged, and replaces it
+// otherwise, as configuration is specific to a format
+func withFormat(st *dataset.Structure, format string, config map[string]interface{}) (*dataset.Structure, error) {
+	out := &dataset.Structure{Format: "json"}
+	if st != nil {
+		cp := *st
+		out = &cp
+	}
+
+	if format != "" && format != out.Format {
+		if _, ok := formatConfigKeys[format]; !ok {
+			return nil, fmt.Errorf("invalid format: '%s', expected one of: %s", format, strings.Join(bodyFormats, ", "))
+		}
+		out.Format = format
+		out.FormatConfig = nil
+	}
+	if config == nil {
+		return out, nil
+	}
+
+	cfg := map[string]interface{}{}
+	for k, v := range out.FormatConfig {
+		cfg[k] = v
+	}
+	keys := formatConfigKeys[out.Format]
+	for k, v := range config {
+		key, ok := keys[k]
+		if !ok {
+			return nil, fmt.Errorf("invalid format_config option for %s: '%s'", out.Format, k)
+		}
+		switch key {
+		case "separator":
+			if sep, ok := v.(string); !ok || len([]rune(sep)) != 1 {
+				return nil, fmt.Errorf("format_config %s must be a single character string", k)
+			}
+		case "sheetName":
+			if _, ok := v.(string); !ok {
+				return nil, fmt.Errorf("format_config %s must be a string", k)
+			}
+		default:
+			if _, ok := v.(bool); !ok {
+				return nil, fmt.Errorf("format_config %s must be a boolean", k)
+			}
+		}
+		cfg[key] = v
 	}
+	out.FormatConfig = cfg
+	return out, nil
 }
@@ -2,12 +2,15 @@ package ds
 
 import (
 	"fmt"
+	"io/ioutil"
 	"testing"
+	"time"
 
 	"github.com/qri-io/dataset"
 	"github.com/qri-io/qfs"
 	"go.starlark.net/resolve"
 	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
 	"go.starlark.net/starlarktest"
 )
 
@@ -125,6 +128,183 @@ func TestChangeBody(t *testing.T) {
 	}
 }
 
+func TestTimingFunc(t *testing.T) {
+	prev := &dataset.Dataset{
+		Structure: &dataset.Structure{
+			Format: "json",
+			Schema: dataset.BaseSchemaArray,
+		},
+	}
+	prev.SetBodyFile(qfs.NewMemfileBytes("body.json", []byte("[\"b\"]")))
+	ds := NewDataset(prev, nil)
+	ds.SetMutable(&dataset.Dataset{})
+
+	calls := map[string]int{}
+	ds.SetTimingFunc(func(name string, d time.Duration) {
+		calls[name]++
+	})
+	thread := &starlark.Thread{}
+
+	// the second get_body is served from cache & shouldn't be timed
+	for i := 0; i < 2; i++ {
+		if _, err := ds.GetBody(thread, nil, starlark.Tuple{}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := ds.SetBody(thread, nil, starlark.Tuple{starlark.NewList([]starlark.Value{starlark.String("a")})}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if calls["get_body"] != 1 || calls["set_body"] != 1 {
+		t.Errorf("expected one get_body & one set_body timing, got: %v", calls)
+	}
+}
+
+func TestSetBodyDictRows(t *testing.T) {
+	// without a tabular structure, lists of dicts are written as arrays of objects
+	ds := NewDataset(nil, nil)
+	ds.SetMutable(&dataset.Dataset{})
+	thread := &starlark.Thread{}
+
+	row := starlark.NewDict(1)
+	row.SetKey(starlark.String("a"), starlark.MakeInt(1))
+	if _, err := ds.SetBody(thread, nil, starlark.Tuple{starlark.NewList([]starlark.Value{row})}, nil); err != nil {
+		t.Fatal(err)
+	}
+	body, err := ds.GetBody(thread, nil, starlark.Tuple{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := `[{"a": 1}]`; body.String() != expect {
+		t.Errorf("expected body: %s, got: %s", expect, body)
+	}
+	if isTabular(ds.write.Structure) {
+		t.Errorf("expected an array of objects schema, got: %v", ds.write.Structure.Schema)
+	}
+}
+
+func TestSetBodyStruct(t *testing.T) {
+	// structs are written as objects of their fields, including nested structs
+	ds := NewDataset(nil, nil)
+	ds.SetMutable(&dataset.Dataset{})
+	thread := &starlark.Thread{}
+
+	inner := starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{"x": starlark.MakeInt(1)})
+	body := starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"b":     starlark.String("two"),
+		"a":     starlark.NewList([]starlark.Value{inner}),
+		"inner": inner,
+	})
+	if _, err := ds.SetBody(thread, nil, starlark.Tuple{body}, nil); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ds.GetBody(thread, nil, starlark.Tuple{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := `{"a": [{"x": 1}], "b": "two", "inner": {"x": 1}}`; got.String() != expect {
+		t.Errorf("expected body: %s, got: %s", expect, got)
+	}
+	if ds.write.Structure.Schema["type"] != "object" {
+		t.Errorf("expected an object schema, got: %v", ds.write.Structure.Schema)
+	}
+}
+
+func TestSetBodyFormat(t *testing.T) {
+	thread := &starlark.Thread{}
+	call := func(ds *Dataset, data starlark.Value, kwargs ...starlark.Tuple) error {
+		_, err := ds.SetBody(thread, nil, starlark.Tuple{data}, kwargs)
+		return err
+	}
+	kw := func(k string, v starlark.Value) starlark.Tuple {
+		return starlark.Tuple{starlark.String(k), v}
+	}
+	config := func(k string, v starlark.Value) starlark.Tuple {
+		d := starlark.NewDict(1)
+		d.SetKey(starlark.String(k), v)
+		return kw("format_config", d)
+	}
+	bodyText := func(ds *Dataset) string {
+		data, err := ioutil.ReadAll(ds.write.BodyFile())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	// convert an inherited json structure to csv, keeping the schema
+	prev := &dataset.Dataset{Structure: &dataset.Structure{
+		Format: "json",
+		Schema: map[string]interface{}{
+			"type": "array",
+			"items": map[string]interface{}{
+				"type": "array",
+				"items": []interface{}{
+					map[string]interface{}{"title": "name", "type": "string"},
+					map[string]interface{}{"title": "count", "type": "integer"},
+				},
+			},
+		},
+	}}
+	ds := NewDataset(prev, nil)
+	ds.SetMutable(&dataset.Dataset{})
+	rows := starlark.NewList([]starlark.Value{
+		starlark.NewList([]starlark.Value{starlark.String("a"), starlark.MakeInt(1)}),
+	})
+	if err := call(ds, rows, kw("format", starlark.String("csv")), config("header_row", starlark.True)); err != nil {
+		t.Fatal(err)
+	}
+	if st := ds.write.Structure; st.Format != "csv" || st.FormatConfig["headerRow"] != true || len(schemaItems(st.Schema)) != 2 {
+		t.Errorf("expected a csv structure with a header row & the inherited schema, got: %#v", st)
+	}
+	if prev.Structure.Format != "json" || prev.Structure.FormatConfig != nil {
+		t.Errorf("expected the read structure to be unchanged, got: %#v", prev.Structure)
+	}
+	if got := bodyText(ds); got != "name,count\na,1\n" {
+		t.Errorf("body mismatch, got: %q", got)
+	}
+
+	// config for the same format is merged
+	if err := call(ds, rows, config("lazy_quotes", starlark.True)); err != nil {
+		t.Fatal(err)
+	}
+	if cfg := ds.write.Structure.FormatConfig; cfg["headerRow"] != true || cfg["lazyQuotes"] != true {
+		t.Errorf("expected merged format config, got: %v", cfg)
+	}
+
+	// dict rows without a structure become csv rows with an inferred schema
+	ds = NewDataset(nil, nil)
+	ds.SetMutable(&dataset.Dataset{})
+	row := starlark.NewDict(2)
+	row.SetKey(starlark.String("a"), starlark.MakeInt(1))
+	row.SetKey(starlark.String("b"), starlark.String("x"))
+	if err := call(ds, starlark.NewList([]starlark.Value{row}), kw("format", starlark.String("csv")), config("headerRow", starlark.True)); err != nil {
+		t.Fatal(err)
+	}
+	if got := bodyText(ds); got != "a,b\n1,x\n" {
+		t.Errorf("body mismatch, got: %q", got)
+	}
+	if items := schemaItems(ds.write.Structure.Schema); len(items) != 2 || items[0].(map[string]interface{})["type"] != "integer" {
+		t.Errorf("expected an inferred tabular schema, got: %v", ds.write.Structure.Schema)
+	}
+
+	errs := []struct {
+		kwargs []starlark.Tuple
+		expect string
+	}{
+		{[]starlark.Tuple{kw("format", starlark.String("tsv"))}, "set_body: invalid format: 'tsv', expected one of: csv, json, cbor, ndjson, xlsx"},
+		{[]starlark.Tuple{kw("format", starlark.String("json")), config("header_row", starlark.True)}, "set_body: invalid format_config option for json: 'header_row'"},
+		{[]starlark.Tuple{config("delimiter", starlark.String("||"))}, "set_body: format_config delimiter must be a single character string"},
+		{[]starlark.Tuple{config("header_row", starlark.String("yes"))}, "set_body: format_config header_row must be a boolean"},
+		{[]starlark.Tuple{kw("parse_as", starlark.String("json")), kw("format", starlark.String("csv"))}, "set_body: format & format_config can't be combined with parse_as"},
+	}
+	for _, c := range errs {
+		if err := call(ds, rows, c.kwargs...); err == nil || err.Error() != c.expect {
+			t.Errorf("expected error: %q, got: %v", c.expect, err)
+		}
+	}
+}
+
 func TestChangeBodyEvenIfTheSame(t *testing.T) {
 	// Create the previous version with the body ["a"]
 	prev := &dataset.Dataset{
@@ -171,8 +351,71 @@ func TestChangeBodyEvenIfTheSame(t *testing.T) {
 	}
 }
 
+func TestGetHistory(t *testing.T) {
+	versions := map[string]*dataset.Dataset{
+		"/map/v1": {Meta: &dataset.Meta{Title: "v1"}},
+		"/map/v2": {Meta: &dataset.Meta{Title: "v2"}, PreviousPath: "/map/v1"},
+	}
+	loader := func(path string) (*dataset.Dataset, error) {
+		if ds, ok := versions[path]; ok {
+			return ds, nil
+		}
+		return nil, fmt.Errorf("not found")
+	}
+
+	prev := &dataset.Dataset{Meta: &dataset.Meta{Title: "v3"}, PreviousPath: "/map/v2"}
+	ds := NewDataset(prev, nil)
+	ds.SetVersionLoader(loader)
+	thread := &starlark.Thread{}
+
+	cases := []struct {
+		n      int
+		titles []string
+	}{
+		{0, []string{}},
+		{2, []string{"v3", "v2"}},
+		{10, []string{"v3", "v2", "v1"}},
+	}
+
+	for i, c := range cases {
+		res, err := ds.GetHistory(thread, nil, starlark.Tuple{starlark.MakeInt(c.n)}, nil)
+		if err != nil {
+			t.Errorf("case %d unexpected error: %s", i, err)
+			continue
+		}
+		l := res.(*starlark.List)
+		if l.Len() != len(c.titles) {
+			t.Errorf("case %d length mismatch. expected: %d, got: %d", i, len(c.titles), l.Len())
+			continue
+		}
+		for j, title := range c.titles {
+			get, err := l.Index(j).(*starlarkstruct.Struct).Attr("get_meta")
+			if err != nil {
+				t.Fatal(err)
+			}
+			meta, err := starlark.Call(thread, get, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, _, _ := meta.(*starlark.Dict).Get(starlark.String("title"))
+			if got != starlark.String(title) {
+				t.Errorf("case %d version %d title mismatch. expected: %s, got: %s", i, j, title, got)
+			}
+		}
+	}
+
+	prev.PreviousPath = "/map/missing"
+	ds = NewDataset(prev, nil)
+	ds.SetVersionLoader(loader)
+	expect := "loading dataset version /map/missing: not found"
+	if _, err := ds.GetHistory(thread, nil, starlark.Tuple{}, nil); err == nil || err.Error() != expect {
+		t.Errorf("expected error: %s, got: %v", expect, err)
+	}
+}
+
 func TestFile(t *testing.T) {
 	resolve.AllowFloat = true
+	resolve.AllowLambda = true
 	thread := &starlark.Thread{Load: newLoader()}
 	starlarktest.SetReporter(thread, t)
 
@@ -0,0 +1,320 @@
+package ds
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// divisionScale is the number of digits after the decimal point kept when
+// dividing decimals that don't divide exactly
+const divisionScale = 16
+
+// Decimal is an exact base 10 number, for values like currency amounts that
+// floats can't represent without rounding errors. Decimals support arithmetic
+// with other decimals & ints, and comparison with other decimals
+type Decimal struct {
+	// unscaled is the value multiplied by 10^scale
+	unscaled *big.Int
+	// scale is the number of digits after the decimal point
+	scale int
+}
+
+var (
+	_ starlark.Value      = Decimal{}
+	_ starlark.HasBinary  = Decimal{}
+	_ starlark.HasUnary   = Decimal{}
+	_ starlark.HasAttrs   = Decimal{}
+	_ starlark.Comparable = Decimal{}
+)
+
+// maxDecimalExponent bounds the exponent a decimal can be written with, as
+// decimals hold every digit the exponent implies
+const maxDecimalExponent = 4096
+
+// ParseDecimal parses a decimal number, like "-12.30" or "1.5e3"
+func ParseDecimal(s string) (Decimal, error) {
+	num := strings.TrimSpace(s)
+	exp := 0
+	if i := strings.IndexAny(num, "eE"); i >= 0 {
+		e, err := strconv.Atoi(num[i+1:])
+		if err != nil {
+			return Decimal{}, fmt.Errorf("invalid decimal: %q", s)
+		}
+		if e > maxDecimalExponent || e < -maxDecimalExponent {
+			return Decimal{}, fmt.Errorf("invalid decimal: %q, exponent must be between -%d and %d", s, maxDecimalExponent, maxDecimalExponent)
+		}
+		num, exp = num[:i], e
+	}
+
+	digits, frac := num, ""
+	if i := strings.IndexByte(num, '.'); i >= 0 {
+		digits, frac = num[:i], num[i+1:]
+	}
+	unscaled, ok := new(big.Int).SetString(digits+frac, 10)
+	if !ok || strings.ContainsAny(frac, "+-") {
+		return Decimal{}, fmt.Errorf("invalid decimal: %q", s)
+	}
+
+	d := Decimal{unscaled: unscaled, scale: len(frac) - exp}
+	if d.scale < 0 {
+		d.unscaled.Mul(d.unscaled, pow10(-d.scale))
+		d.scale = 0
+	}
+	return d, nil
+}
+
+// MakeDecimal creates a decimal from a starlark string, int, float or decimal.
+// floats are converted using the shortest representation that reads back as
+// the same float
+func MakeDecimal(v starlark.Value) (Decimal, error) {
+	switch x := v.(type) {
+	case Decimal:
+		return x, nil
+	case starlark.String:
+		return ParseDecimal(string(x))
+	case starlark.Int:
+		return ParseDecimal(x.String())
+	case starlark.Float:
+		return ParseDecimal(strconv.FormatFloat(float64(x), 'f', -1, 64))
+	}
+	return Decimal{}, fmt.Errorf("can't convert %s to decimal", v.Type())
+}
+
+// decimalBuiltin is the starlark decimal(x) constructor
+func decimalBuiltin(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var x starlark.Value
+	if err := starlark.UnpackPositionalArgs("decimal", args, kwargs, 1, &x); err != nil {
+		return nil, err
+	}
+	d, err := MakeDecimal(x)
+	if err != nil {
+		return nil, fmt.Errorf("decimal: %s", err)
+	}
+	return d, nil
+}
+
+// String formats the decimal with its scale, eg: "1.50"
+func (d Decimal) String() string {
+	s := new(big.Int).Abs(d.unscaled).String()
+	if d.scale > 0 {
+		if len(s) <= d.scale {
+			s = strings.Repeat("0", d.scale-len(s)+1) + s
+		}
+		s = s[:len(s)-d.scale] + "." + s[len(s)-d.scale:]
+	}
+	if d.unscaled.Sign() < 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+// Type implements the starlark.Value interface
+func (d Decimal) Type() string { return "decimal" }
+
+// Freeze implements the starlark.Value interface, decimals are immutable
+func (d Decimal) Freeze() {}
+
+// Truth implements the starlark.Value interface
+func (d Decimal) Truth() starlark.Bool { return d.unscaled.Sign() != 0 }
+
+// Hash implements the starlark.Value interface. equal decimals with different
+// scales hash the same
+func (d Decimal) Hash() (uint32, error) {
+	return starlark.String(d.normalize().String()).Hash()
+}
+
+// Float converts the decimal to the nearest float
+func (d Decimal) Float() float64 {
+	f, _ := d.rat().Float64()
+	return f
+}
+
+// CompareSameType implements the starlark.Comparable interface
+func (d Decimal) CompareSameType(op syntax.Token, y starlark.Value, depth int) (bool, error) {
+	cmp := d.rat().Cmp(y.(Decimal).rat())
+	switch op {
+	case syntax.EQL:
+		return cmp == 0, nil
+	case syntax.NEQ:
+		return cmp != 0, nil
+	case syntax.LT:
+		return cmp < 0, nil
+	case syntax.LE:
+		return cmp <= 0, nil
+	case syntax.GT:
+		return cmp > 0, nil
+	case syntax.GE:
+		return cmp >= 0, nil
+	}
+	return false, fmt.Errorf("unsupported comparison %s for decimal", op)
+}
+
+// Unary implements the starlark.HasUnary interface
+func (d Decimal) Unary(op syntax.Token) (starlark.Value, error) {
+	switch op {
+	case syntax.MINUS:
+		return Decimal{unscaled: new(big.Int).Neg(d.unscaled), scale: d.scale}, nil
+	case syntax.PLUS:
+		return d, nil
+	}
+	return nil, nil
+}
+
+// Binary implements the starlark.HasBinary interface. the other operand must be
+// a decimal or an int
+func (d Decimal) Binary(op syntax.Token, y starlark.Value, side starlark.Side) (starlark.Value, error) {
+	var other Decimal
+	switch v := y.(type) {
+	case Decimal:
+		other = v
+	case starlark.Int:
+		other, _ = MakeDecimal(v)
+	default:
+		return nil, nil
+	}
+	x := d
+	if side == starlark.Right {
+		x, other = other, x
+	}
+
+	switch op {
+	case syntax.PLUS, syntax.MINUS:
+		scale := maxInt(x.scale, other.scale)
+		a, b := x.rescale(scale), other.rescale(scale)
+		if op == syntax.PLUS {
+			return Decimal{unscaled: a.Add(a, b), scale: scale}, nil
+		}
+		return Decimal{unscaled: a.Sub(a, b), scale: scale}, nil
+	case syntax.STAR:
+		return Decimal{unscaled: new(big.Int).Mul(x.unscaled, other.unscaled), scale: x.scale + other.scale}, nil
+	case syntax.SLASH, syntax.SLASHSLASH, syntax.PERCENT:
+		if other.unscaled.Sign() == 0 {
+			return nil, fmt.Errorf("decimal division by zero")
+		}
+		q := new(big.Rat).Quo(x.rat(), other.rat())
+		if op == syntax.SLASH {
+			minScale := maxInt(x.scale, other.scale)
+			return roundRat(q, minScale+divisionScale).trim(minScale), nil
+		}
+		floor := floorRat(q)
+		if op == syntax.SLASHSLASH {
+			return Decimal{unscaled: floor, scale: 0}, nil
+		}
+		// x % y == x - y * (x // y), which has the sign of y
+		scale := maxInt(x.scale, other.scale)
+		rem := x.rescale(scale)
+		return Decimal{unscaled: rem.Sub(rem, floor.Mul(floor, other.rescale(scale))), scale: scale}, nil
+	}
+	return nil, nil
+}
+
+// Attr implements the starlark.HasAttrs interface
+func (d Decimal) Attr(name string) (starlark.Value, error) {
+	if fn, ok := decimalMethods[name]; ok {
+		return fn.BindReceiver(d), nil
+	}
+	return nil, nil
+}
+
+// AttrNames implements the starlark.HasAttrs interface
+func (d Decimal) AttrNames() []string {
+	return []string{"float", "round"}
+}
+
+var decimalMethods = map[string]*starlark.Builtin{
+	"float": starlark.NewBuiltin("float", decimalFloat),
+	"round": starlark.NewBuiltin("round", decimalRound),
+}
+
+// decimalFloat converts a decimal to the nearest float
+func decimalFloat(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 0); err != nil {
+		return nil, err
+	}
+	return starlark.Float(b.Receiver().(Decimal).Float()), nil
+}
+
+// decimalRound rounds a decimal to a number of digits after the decimal point,
+// rounding halves to even
+func decimalRound(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	places := 0
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "places?", &places); err != nil {
+		return nil, err
+	}
+	if places < 0 {
+		return nil, fmt.Errorf("round: places must be zero or more")
+	}
+	return roundRat(b.Receiver().(Decimal).rat(), places), nil
+}
+
+func (d Decimal) rat() *big.Rat {
+	return new(big.Rat).SetFrac(d.unscaled, pow10(d.scale))
+}
+
+// rescale returns the unscaled value of d at a larger scale
+func (d Decimal) rescale(scale int) *big.Int {
+	return new(big.Int).Mul(d.unscaled, pow10(scale-d.scale))
+}
+
+// trim drops trailing zeros after the decimal point, keeping at least minScale digits
+func (d Decimal) trim(minScale int) Decimal {
+	ten, m := big.NewInt(10), new(big.Int)
+	u := new(big.Int).Set(d.unscaled)
+	scale := d.scale
+	for scale > minScale {
+		q, r := new(big.Int).QuoRem(u, ten, m)
+		if r.Sign() != 0 {
+			break
+		}
+		u, scale = q, scale-1
+	}
+	return Decimal{unscaled: u, scale: scale}
+}
+
+// normalize drops all trailing zeros after the decimal point
+func (d Decimal) normalize() Decimal {
+	return d.trim(0)
+}
+
+// roundRat rounds a rational to a decimal with scale digits after the decimal
+// point, rounding halves to even
+func roundRat(r *big.Rat, scale int) Decimal {
+	n := new(big.Int).Mul(r.Num(), pow10(scale))
+	q, m := new(big.Int).QuoRem(n, r.Denom(), new(big.Int))
+	// compare twice the remainder to the denominator to find which way to round
+	half := new(big.Int).Abs(m)
+	half.Lsh(half, 1)
+	if c := half.Cmp(r.Denom()); c > 0 || (c == 0 && q.Bit(0) == 1) {
+		if n.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return Decimal{unscaled: q, scale: scale}
+}
+
+// floorRat finds the largest integer less than or equal to r
+func floorRat(r *big.Rat) *big.Int {
+	q, m := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+	if m.Sign() < 0 {
+		q.Sub(q, big.NewInt(1))
+	}
+	return q
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
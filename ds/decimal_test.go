@@ -0,0 +1,65 @@
+package ds
+
+import (
+	"strings"
+	"testing"
+
+	"go.starlark.net/resolve"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarktest"
+)
+
+func TestDecimalFile(t *testing.T) {
+	resolve.AllowFloat = true
+	resolve.AllowLambda = true
+	thread := &starlark.Thread{Load: newLoader()}
+	starlarktest.SetReporter(thread, t)
+
+	if _, err := starlark.ExecFile(thread, "testdata/decimal.star", nil, nil); err != nil {
+		if ee, ok := err.(*starlark.EvalError); ok {
+			t.Error(ee.Backtrace())
+		} else {
+			t.Error(err)
+		}
+	}
+}
+
+func TestParseDecimal(t *testing.T) {
+	cases := []struct {
+		in, expect string
+	}{
+		{"0", "0"},
+		{"-0.001", "-0.001"},
+		{"+12.50", "12.50"},
+		{" 3.14 ", "3.14"},
+		{"1E2", "100"},
+		{"1.5e-3", "0.0015"},
+		{"123456789012345678901234567890.1", "123456789012345678901234567890.1"},
+	}
+	for i, c := range cases {
+		d, err := ParseDecimal(c.in)
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %s", i, err)
+			continue
+		}
+		if d.String() != c.expect {
+			t.Errorf("case %d: expected: %s, got: %s", i, c.expect, d)
+		}
+	}
+
+	for _, s := range []string{"", "-", ".", "1.-2", "abc", "1e", "1,000"} {
+		if _, err := ParseDecimal(s); err == nil {
+			t.Errorf("expected an error parsing %q", s)
+		}
+	}
+
+	// huge exponents are rejected instead of building numbers with that many digits
+	for _, s := range []string{"1e999999999", "1e-999999999", "1e4097"} {
+		if _, err := ParseDecimal(s); err == nil || !strings.HasPrefix(err.Error(), "invalid decimal") {
+			t.Errorf("expected an invalid decimal error parsing %q, got: %v", s, err)
+		}
+	}
+	if d, err := ParseDecimal("1e4096"); err != nil || len(d.String()) != 4097 {
+		t.Errorf("expected the largest exponent to parse, got: %v", err)
+	}
+}
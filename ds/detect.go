@@ -0,0 +1,273 @@
+package ds
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/qri-io/dataset"
+	"github.com/qri-io/dataset/dsio"
+)
+
+// DetectStructure parses raw body data in a format, returning a structure that
+// describes it with a format config, inferred schema & entry count. Data must
+// parse completely, errors in text formats report the line the error is on.
+// prev is an existing structure, its format config is kept when the format
+// matches
+func DetectStructure(format string, data []byte, prev *dataset.Structure) (*dataset.Structure, error) {
+	st := &dataset.Structure{Format: format}
+	if prev != nil && prev.Format == format {
+		st.FormatConfig = map[string]interface{}{}
+		for k, v := range prev.FormatConfig {
+			st.FormatConfig[k] = v
+		}
+	}
+
+	var (
+		entries []dsio.Entry
+		object  bool
+		err     error
+	)
+	switch format {
+	case "csv":
+		return detectCSV(st, data)
+	case "json":
+		var v interface{}
+		if v, err = decodeJSON(data, 1); err != nil {
+			return nil, err
+		}
+		switch body := v.(type) {
+		case []interface{}:
+			for i, e := range body {
+				entries = append(entries, dsio.Entry{Index: i, Value: e})
+			}
+		case map[string]interface{}:
+			object = true
+			for k, e := range body {
+				entries = append(entries, dsio.Entry{Key: k, Value: e})
+			}
+		default:
+			return nil, fmt.Errorf("json body must be an array or object")
+		}
+	case "ndjson":
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(nil, len(data)+1)
+		for line := 1; scanner.Scan(); line++ {
+			if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+				continue
+			}
+			v, err := decodeJSON(scanner.Bytes(), line)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, dsio.Entry{Index: len(entries), Value: v})
+		}
+	default:
+		// binary formats are validated by reading them as an array of entries
+		st.Schema = dataset.BaseSchemaArray
+		r, err := dsio.NewEntryReader(st, bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		if entries, err = readEntries(r); err != nil {
+			return nil, fmt.Errorf("entry %d: %s", len(entries), err)
+		}
+	}
+
+	st.Schema = InferSchema(entries, object, nil)
+	st.Entries = len(entries)
+	return st, nil
+}
+
+// decodeJSON decodes a single json value, converting numbers to int64 or float64.
+// line is the line data starts on, for error messages
+func decodeJSON(data []byte, line int) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		offset := dec.InputOffset()
+		switch e := err.(type) {
+		case *json.SyntaxError:
+			offset = e.Offset
+		case *json.UnmarshalTypeError:
+			offset = e.Offset
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			offset = int64(len(data))
+			err = fmt.Errorf("unexpected end of data")
+		}
+		return nil, fmt.Errorf("line %d: %s", lineAt(data, offset, line), err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("line %d: unexpected data after json value", lineAt(data, dec.InputOffset(), line))
+	}
+	return jsonNumbers(v), nil
+}
+
+// lineAt gives the line number of a byte offset, counting from start
+func lineAt(data []byte, offset int64, start int) int {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	return start + bytes.Count(data[:offset], []byte("\n"))
+}
+
+// jsonNumbers replaces json.Number values with int64 or float64
+func jsonNumbers(v interface{}) interface{} {
+	switch x := v.(type) {
+	case json.Number:
+		if n, err := x.Int64(); err == nil {
+			return n
+		}
+		f, _ := x.Float64()
+		return f
+	case []interface{}:
+		for i := range x {
+			x[i] = jsonNumbers(x[i])
+		}
+	case map[string]interface{}:
+		for k := range x {
+			x[k] = jsonNumbers(x[k])
+		}
+	}
+	return v
+}
+
+// detectCSV validates csv data, detecting a header row & column types. The first
+// row is a header when its values are unique, non-empty and not numbers, unless
+// the existing config says otherwise
+func detectCSV(st *dataset.Structure, data []byte) (*dataset.Structure, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	if lazy, ok := st.FormatConfig["lazyQuotes"].(bool); ok {
+		r.LazyQuotes = lazy
+	}
+	if sep, ok := st.FormatConfig["separator"].(string); ok && sep != "" {
+		r.Comma = []rune(sep)[0]
+	}
+	if v, ok := st.FormatConfig["variadicFields"].(bool); ok && v {
+		r.FieldsPerRecord = -1
+	}
+
+	rows, err := r.ReadAll()
+	if err != nil {
+		if pe, ok := err.(*csv.ParseError); ok {
+			return nil, fmt.Errorf("line %d: %s", pe.Line, pe.Err)
+		}
+		return nil, err
+	}
+
+	header, ok := st.FormatConfig["headerRow"].(bool)
+	if !ok {
+		header = len(rows) > 0 && isHeader(rows[0])
+	}
+	if st.FormatConfig == nil {
+		st.FormatConfig = map[string]interface{}{}
+	}
+	st.FormatConfig["headerRow"] = header
+
+	var titles []string
+	if header && len(rows) > 0 {
+		titles, rows = rows[0], rows[1:]
+	}
+
+	width := len(titles)
+	for _, row := range rows {
+		if len(row) > width {
+			width = len(row)
+		}
+	}
+	items := make([]interface{}, width)
+	for i := range items {
+		title := fmt.Sprintf("field_%d", i+1)
+		if i < len(titles) && titles[i] != "" {
+			title = titles[i]
+		}
+		item := map[string]interface{}{"title": title, "type": columnType(rows, i)}
+		if item["type"] == "string" && isDateTimes(rows, i) {
+			item["format"] = "date-time"
+		}
+		items[i] = item
+	}
+
+	st.Schema = map[string]interface{}{
+		"type": "array",
+		"items": map[string]interface{}{
+			"type":  "array",
+			"items": items,
+		},
+	}
+	st.Entries = len(rows)
+	return st, nil
+}
+
+// isHeader reports whether a csv row looks like column titles
+func isHeader(row []string) bool {
+	seen := map[string]bool{}
+	for _, s := range row {
+		if s == "" || seen[s] || isNumber(s) {
+			return false
+		}
+		seen[s] = true
+	}
+	return true
+}
+
+func isNumber(s string) bool {
+	_, err := strconv.ParseFloat(s, 64)
+	return err == nil
+}
+
+// columnType finds the narrowest json schema type that fits every non-empty
+// value of a csv column
+func columnType(rows [][]string, col int) string {
+	integer, number, boolean, found := true, true, true, false
+	for _, row := range rows {
+		if col >= len(row) || row[col] == "" {
+			continue
+		}
+		found = true
+		s := row[col]
+		if _, err := strconv.ParseInt(s, 10, 64); err != nil {
+			integer = false
+		}
+		if !isNumber(s) {
+			number = false
+		}
+		if _, err := strconv.ParseBool(s); err != nil {
+			boolean = false
+		}
+	}
+	switch {
+	case !found:
+		return "string"
+	case integer:
+		return "integer"
+	case number:
+		return "number"
+	case boolean:
+		return "boolean"
+	}
+	return "string"
+}
+
+// isDateTimes reports whether the non-empty values of a csv column are all
+// RFC3339 date-times
+func isDateTimes(rows [][]string, col int) bool {
+	found := false
+	for _, row := range rows {
+		if col >= len(row) || row[col] == "" {
+			continue
+		}
+		if _, err := time.Parse(time.RFC3339Nano, row[col]); err != nil {
+			return false
+		}
+		found = true
+	}
+	return found
+}
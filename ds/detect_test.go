@@ -0,0 +1,130 @@
+package ds
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/qri-io/dataset"
+	"go.starlark.net/starlark"
+)
+
+func TestDetectStructure(t *testing.T) {
+	cases := []struct {
+		format  string
+		data    string
+		prev    *dataset.Structure
+		header  interface{}
+		items   []interface{}
+		entries int
+	}{
+		{"csv", "name,count,ok\na,1,true\nb,2.5,false\n", nil, true, []interface{}{
+			map[string]interface{}{"title": "name", "type": "string"},
+			map[string]interface{}{"title": "count", "type": "number"},
+			map[string]interface{}{"title": "ok", "type": "boolean"},
+		}, 2},
+		{"csv", "a,1\nb,2\n", nil, false, []interface{}{
+			map[string]interface{}{"title": "field_1", "type": "string"},
+			map[string]interface{}{"title": "field_2", "type": "integer"},
+		}, 2},
+		// an existing config decides the header row
+		{"csv", "a,b\nc,d\n", &dataset.Structure{Format: "csv", FormatConfig: map[string]interface{}{"headerRow": false}}, false, []interface{}{
+			map[string]interface{}{"title": "field_1", "type": "string"},
+			map[string]interface{}{"title": "field_2", "type": "string"},
+		}, 2},
+		{"json", "[[1, \"a\"],\n [2, \"b\"],\n [3, \"c\"]]", nil, nil, []interface{}{
+			map[string]interface{}{"title": "field_1", "type": "integer"},
+			map[string]interface{}{"title": "field_2", "type": "string"},
+		}, 3},
+		{"ndjson", "[1]\n\n[2]\n", nil, nil, []interface{}{
+			map[string]interface{}{"title": "field_1", "type": "integer"},
+		}, 2},
+	}
+
+	for i, c := range cases {
+		st, err := DetectStructure(c.format, []byte(c.data), c.prev)
+		if err != nil {
+			t.Errorf("case %d: unexpected error: %s", i, err)
+			continue
+		}
+		if st.Format != c.format {
+			t.Errorf("case %d: expected format %s, got: %s", i, c.format, st.Format)
+		}
+		if got := st.FormatConfig["headerRow"]; got != c.header {
+			t.Errorf("case %d: expected headerRow %v, got: %v", i, c.header, got)
+		}
+		if items := schemaItems(st.Schema); !reflect.DeepEqual(items, c.items) {
+			t.Errorf("case %d: schema items mismatch, expected: %v, got: %v", i, c.items, items)
+		}
+		if st.Entries != c.entries {
+			t.Errorf("case %d: expected %d entries, got: %d", i, c.entries, st.Entries)
+		}
+	}
+
+	st, err := DetectStructure("json", []byte(`{"a": 1, "b": "x"}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Schema["type"] != "object" || st.Entries != 2 {
+		t.Errorf("expected an object schema with 2 entries, got: %v, %d", st.Schema, st.Entries)
+	}
+}
+
+func TestDetectStructureErrors(t *testing.T) {
+	cases := []struct {
+		format, data, expect string
+	}{
+		{"csv", "a,b\n1,2\n3\n", "line 3: wrong number of fields"},
+		{"csv", "a,b\n\"1,2\n", "line 2: extraneous or missing \" in quoted-field"},
+		{"json", "[\n  1,\n  2,,\n]", "line 3: invalid character ',' looking for beginning of value"},
+		{"json", "[1,\n2", "line 2: unexpected end of data"},
+		{"json", "[1]\n[2]", "line 2: unexpected data after json value"},
+		{"json", "\"a\"", "json body must be an array or object"},
+		{"ndjson", "[1]\n[2\n[3]\n", "line 2: unexpected end of data"},
+	}
+
+	for i, c := range cases {
+		_, err := DetectStructure(c.format, []byte(c.data), nil)
+		if err == nil || err.Error() != c.expect {
+			t.Errorf("case %d: expected error: %q, got: %v", i, c.expect, err)
+		}
+	}
+}
+
+func TestDetectStructureEntryError(t *testing.T) {
+	// a cbor array of 3 entries where the third uses a reserved initial byte
+	data := []byte{0x83, 0x01, 0x02, 0x1c}
+	_, err := DetectStructure("cbor", data, nil)
+	if err == nil || !strings.HasPrefix(err.Error(), "entry 2: ") {
+		t.Errorf("expected an error for entry 2, got: %v", err)
+	}
+}
+
+func TestSetBodyParseAs(t *testing.T) {
+	thread := &starlark.Thread{}
+	prev := &dataset.Dataset{Structure: &dataset.Structure{Format: "json", Schema: dataset.BaseSchemaArray}}
+	ds := NewDataset(prev, nil)
+	ds.SetMutable(&dataset.Dataset{})
+
+	kwargs := []starlark.Tuple{{starlark.String("parse_as"), starlark.String("csv")}}
+	if _, err := ds.SetBody(thread, nil, starlark.Tuple{starlark.String("a,b\n1,2\n3,4\n")}, kwargs); err != nil {
+		t.Fatal(err)
+	}
+	st := ds.write.Structure
+	if st.Format != "csv" || st.FormatConfig["headerRow"] != true || st.Entries != 2 || len(schemaItems(st.Schema)) != 2 {
+		t.Errorf("expected a detected csv structure, got: %#v", st)
+	}
+
+	body, err := ds.GetBody(thread, nil, starlark.Tuple{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := "[[1, 2], [3, 4]]"; body.String() != expect {
+		t.Errorf("expected body: %s, got: %s", expect, body)
+	}
+
+	expect := "set_body: parsing json: line 2: invalid character ']' looking for beginning of value"
+	if _, err := ds.SetBody(thread, nil, starlark.Tuple{starlark.String("[1,\n]")}, []starlark.Tuple{{starlark.String("parse_as"), starlark.String("json")}}); err == nil || err.Error() != expect {
+		t.Errorf("expected error: %q, got: %v", expect, err)
+	}
+}
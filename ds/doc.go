@@ -16,13 +16,85 @@
             get dataset structure component if one is defined
           set_structure(structure) structure
             set dataset structure component
-          get_body() dict|list|None
-            get dataset body component if one is defined
-          set_body(data dict|list, parse_as? string) body
-            set dataset body component. set_body has only one optional argument: 'parse_as', which defaults to the
-            empty string. By default qri assumes the data value provided to set_body is an iterable starlark data
-            structure (tuple, set, list, dict). When parse_as is set, set_body assumes the provided body value will
-            be a string of serialized structured data in the given format. valid parse_as values are "json", "csv",
-            "cbor", "xlsx".
+          get_body(default?, as_dicts? bool, offset? int, limit? int) dict|list|None
+            get dataset body component if one is defined, returning default otherwise. when as_dicts is True, rows
+            of an array body are returned as dicts keyed by the column titles of the structure's schema. offset &
+            limit read limit entries starting at offset, without loading the whole body. offset defaults to 0 &
+            limit to all entries
+          get_entry(index_or_key int|string) value
+            get a single body entry by index for array bodies or by key for object bodies, reading the body only
+            as far as the entry. missing entries are an error
+          get_table() table|None
+            get dataset body component as a table, naming columns with the titles of the structure's schema. the
+            body must be an array of rows
+          get_stats(columns? bool) dict|None
+            summarize the body without loading it: "entries" is the entry count, "length" the body size in bytes
+            & "columns" maps each column (or object key) to its "count" of values, "nulls", "min", "max" &
+            "distinct", an estimate of the number of distinct values that's exact below 256. stats are read in one
+            pass over the body file. with columns=False only entries & length are given, read from the structure
+            when it records them
+          set_body(data dict|list|table, parse_as? string, format? string, format_config? dict, compression? string, member? string, sheet? string) body
+            set dataset body component. 'parse_as' defaults to the empty string. By default qri assumes the data
+            value provided to set_body is an iterable starlark data structure (tuple, set, list, dict). Object
+            bodies can be a dict, a struct of fields or any other mapping that can be iterated, and object keys
+            must be strings, at any depth. When parse_as is set, set_body assumes the provided body value will be a string of serialized
+            structured data in the given format. valid parse_as values are "json", "csv", "cbor", "xlsx". parse_as
+            data must parse completely, errors report the line they occur on, and the structure is detected from it:
+            the format, a csv header row, an inferred schema & the entry count. When data is a table, the body
+            schema is set to describe the table's columns, keeping the existing structure format. Lists of dicts set
+            the body of a tabular dataset (csv, xlsx, or a schema of arrays) as rows, ordering columns by the
+            existing schema & adding new keys as columns at the end. Otherwise lists of dicts are written as an
+            array of objects. When the dataset has no structure, one is inferred from data, see infer_schema. format
+            sets the format the body is written in, one of "csv", "json", "cbor", "ndjson", "xlsx", converting from
+            the inherited structure's format, which is json by default. format_config sets options for the format:
+            header_row, lazy_quotes, delimiter & variadic_fields for csv, pretty for json, and sheet_name for xlsx.
+            format_config is merged with the existing config when the format doesn't change. format & format_config
+            can't be combined with parse_as. compression decodes parse_as data that is compressed, one of "gzip",
+            "zip", "bz2". data may hold the raw bytes of a file, such as the body of an http response, and can
+            decompress to at most 256MB. member names the file to read from a zip archive, and may be omitted when
+            the archive holds a single file. sheet selects the sheet to read when parsing xlsx.
+          infer_schema(data?) dict|None
+            infer a json schema from data, or the dataset body if data isn't given. schemas record value types,
+            nullability, & the shape of nested objects and arrays. bodies that are arrays of arrays are described as
+            tables with a titled schema for each column. adjust the result & pass it to set_structure to override
+            the schema set_body infers
+          get_history(n? int) list
+            get up to n previous versions of the dataset as a list of read-only datasets, starting with the most
+            recent version. n defaults to 10. Useful for building time series across versions
+      Table
+        tabular data: rows of values with named columns, created with ds.get_table() or
+        dataset.table(rows, columns?). rows can be lists named by columns, or dicts. Tables are immutable,
+        methods return new tables. t["name"] gives a column's values as a list, t[0] gives a row, iterating a
+        table gives rows as lists & len(t) is the number of rows. t.columns lists column names
+        methods:
+          filter(fn) table
+            keep rows for which fn(row) is true, passing each row as a dict keyed by column name
+          select(*columns string) table
+            pick columns by name, in the order given
+          sort(by string|list, reverse? bool) table
+            order rows by one or more columns. the sort is stable & None sorts first
+          group_by(*columns string) grouped_table
+            group rows by the values of one or more columns. iterating a grouped table gives group keys, indexing
+            it with a key gives the group's rows as a table. grouped_table.aggregate(**aggregates) gives a table
+            with the key columns followed by a column for each aggregate
+          join(other table, on string|list, how? string) table
+            combine rows with equal values in the "on" columns. how is "inner" (default) or "left". columns of
+            other that share a name with a column of this table are suffixed with "_right"
+          aggregate(**aggregates) table
+            reduce the table to a single row. each aggregate is a (column, function) pair, eg:
+            total=("amount", "sum"). function is one of "count", "sum", "mean", "min", "max", "first", "last",
+            or a function that accepts a list of the column's values. all but count ignore None values
+      Decimal
+        an exact base 10 number, for values like currency amounts that floats can't represent without rounding
+        errors, created with dataset.decimal(x) from a string, int, float or decimal. decimals support +, -, *,
+        /, // & % with other decimals & ints, and comparison with other decimals. / keeps 16 more digits than
+        its operands when a result doesn't divide exactly. get_body reads values the structure's schema gives
+        format "decimal" as decimals, and values with format "date-time" as times from the time module.
+        set_body writes them back exactly, and infers those formats when it infers a schema
+        methods:
+          round(places? int) decimal
+            round to a number of digits after the decimal point, rounding halves to even. places defaults to 0
+          float() float
+            convert to the nearest float
 */
 package ds
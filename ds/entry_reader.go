@@ -6,7 +6,6 @@ import (
 
 	"github.com/qri-io/dataset"
 	"github.com/qri-io/dataset/dsio"
-	"github.com/qri-io/starlib/util"
 	"go.starlark.net/starlark"
 )
 
@@ -34,7 +33,8 @@ func (r *EntryReader) Structure() *dataset.Structure {
 	return r.st
 }
 
-// ReadEntry reads one entry from the reader
+// ReadEntry reads one entry from the reader. object bodies must be an
+// IterableMapping with string keys
 func (r *EntryReader) ReadEntry() (e dsio.Entry, err error) {
 	// Read next element (key for object, value for array).
 	var next starlark.Value
@@ -52,28 +52,30 @@ func (r *EntryReader) ReadEntry() (e dsio.Entry, err error) {
 	if tlt == "array" {
 		e.Index = r.i
 		r.i++
-		e.Value, err = util.Unmarshal(next)
-		if err != nil {
-			fmt.Printf("reading error: %s\n", err.Error())
+		if e.Value, err = unmarshalTyped(next); err != nil {
+			err = fmt.Errorf("entry %d: %s", e.Index, err)
 		}
 		return
 	}
 
-	// Handle object entry. Assume key is a string.
-	var ok bool
-	e.Key, ok = starlark.AsString(next)
+	// Handle object entry.
+	mapping, ok := r.data.(starlark.Mapping)
 	if !ok {
-		fmt.Printf("key error: %s\n", next)
+		return e, fmt.Errorf("object body must be a mapping, got %s", r.data.Type())
+	}
+	if e.Key, ok = starlark.AsString(next); !ok {
+		return e, fmt.Errorf("object body keys must be strings, got %s: %s", next.Type(), next)
 	}
 	// Lookup the corresponding value for the key.
-	dict := r.data.(*starlark.Dict)
-	value, ok, err := dict.Get(next)
+	value, found, err := mapping.Get(next)
 	if err != nil {
-		fmt.Printf("reading error: %s\n", err.Error())
+		return e, fmt.Errorf("key %q: %s", e.Key, err)
 	}
-	e.Value, err = util.Unmarshal(value)
-	if err != nil {
-		fmt.Printf("reading error: %s\n", err.Error())
+	if !found {
+		return e, fmt.Errorf("key %q: not found in %s", e.Key, r.data.Type())
+	}
+	if e.Value, err = unmarshalTyped(value); err != nil {
+		err = fmt.Errorf("key %q: %s", e.Key, err)
 	}
 	return
 }
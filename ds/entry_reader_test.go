@@ -92,3 +92,52 @@ func TestEntryReaderSimpleDict(t *testing.T) {
 		}
 	}
 }
+
+// orderedMapping is an IterableMapping that isn't a *starlark.Dict
+type orderedMapping struct {
+	*starlark.Dict
+}
+
+func (m orderedMapping) Type() string { return "ordered_mapping" }
+
+func TestEntryReaderMapping(t *testing.T) {
+	nested := starlark.NewDict(1)
+	nested.SetKey(starlark.String("z"), starlark.MakeInt(26))
+	d := starlark.NewDict(2)
+	d.SetKey(starlark.String("b"), orderedMapping{nested})
+	d.SetKey(starlark.String("a"), starlark.NewList([]starlark.Value{orderedMapping{nested}}))
+	st := &dataset.Structure{Schema: dataset.BaseSchemaObject}
+
+	entries, err := readEntries(NewEntryReader(st, orderedMapping{d}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := fmt.Sprintf("%v", entries)
+	if expect := "[{0 b map[z:26]} {0 a [map[z:26]]}]"; got != expect {
+		t.Errorf("entries mismatch, expected: %s, got: %s", expect, got)
+	}
+}
+
+func TestEntryReaderErrors(t *testing.T) {
+	intKeys := starlark.NewDict(1)
+	intKeys.SetKey(starlark.MakeInt(1), starlark.String("a"))
+	nestedIntKeys := starlark.NewDict(1)
+	nestedIntKeys.SetKey(starlark.String("a"), intKeys)
+
+	cases := []struct {
+		schema map[string]interface{}
+		data   starlark.Iterable
+		expect string
+	}{
+		{dataset.BaseSchemaObject, intKeys, "object body keys must be strings, got int: 1"},
+		{dataset.BaseSchemaObject, nestedIntKeys, `key "a": dict keys must be strings, got int: 1`},
+		{dataset.BaseSchemaObject, starlark.NewList([]starlark.Value{starlark.String("a")}), "object body must be a mapping, got list"},
+		{dataset.BaseSchemaArray, starlark.NewList([]starlark.Value{intKeys}), "entry 0: dict keys must be strings, got int: 1"},
+	}
+	for i, c := range cases {
+		_, err := readEntries(NewEntryReader(&dataset.Structure{Schema: c.schema}, c.data))
+		if err == nil || err.Error() != c.expect {
+			t.Errorf("case %d: expected error: %q, got: %v", i, c.expect, err)
+		}
+	}
+}
@@ -12,6 +12,8 @@ type StarlarkEntryWriter struct {
 	IsDict bool
 	Struct *dataset.Structure
 	Object starlark.Value
+	// types marks schema values that convert to times & decimals
+	types *typedSchema
 }
 
 // WriteEntry adds an entry to the underlying starlark.Value
@@ -22,14 +24,14 @@ func (w *StarlarkEntryWriter) WriteEntry(ent dsio.Entry) error {
 		if err != nil {
 			return err
 		}
-		val, err := util.Marshal(ent.Value)
+		val, err := marshalTyped(ent.Value, w.types.prop(ent.Key))
 		if err != nil {
 			return err
 		}
 		dict.SetKey(key, val)
 	} else {
 		list := w.Object.(*starlark.List)
-		val, err := util.Marshal(ent.Value)
+		val, err := marshalTyped(ent.Value, w.types.item(ent.Index))
 		if err != nil {
 			return err
 		}
@@ -59,10 +61,11 @@ func NewStarlarkEntryWriter(st *dataset.Structure) (*StarlarkEntryWriter, error)
 	if err != nil {
 		return nil, err
 	}
+	types := newTypedSchema(st.Schema)
 	if mode == smObject {
-		return &StarlarkEntryWriter{IsDict: true, Struct: st, Object: &starlark.Dict{}}, nil
+		return &StarlarkEntryWriter{IsDict: true, Struct: st, Object: &starlark.Dict{}, types: types}, nil
 	}
-	return &StarlarkEntryWriter{IsDict: false, Struct: st, Object: &starlark.List{}}, nil
+	return &StarlarkEntryWriter{IsDict: false, Struct: st, Object: &starlark.List{}, types: types}, nil
 }
 
 // TODO: Refactor everything below this so that jsonschema returns this in a simple way
@@ -0,0 +1,227 @@
+package ds
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/qri-io/dataset/dsio"
+)
+
+// InferSchema builds a json schema describing body entries, recording the types
+// of values, nullability & the shape of nested objects & arrays. When every
+// entry of an array body is an array, the body is treated as a table and each
+// column is described by position, titled with the matching name from titles or
+// "field_N" if titles doesn't have one
+func InferSchema(entries []dsio.Entry, object bool, titles []string) map[string]interface{} {
+	if object {
+		root := newSchemaNode()
+		for _, e := range entries {
+			root.observeProperty(e.Key, e.Value)
+		}
+		root.types["object"] = true
+		return root.schema()
+	}
+
+	tabular := len(entries) > 0
+	for _, e := range entries {
+		if _, ok := e.Value.([]interface{}); !ok {
+			tabular = false
+			break
+		}
+	}
+
+	if !tabular {
+		items := newSchemaNode()
+		for _, e := range entries {
+			items.observe(e.Value)
+		}
+		sch := map[string]interface{}{"type": "array"}
+		if len(items.types) > 0 {
+			sch["items"] = items.schema()
+		}
+		return sch
+	}
+
+	var cols []*schemaNode
+	for i, e := range entries {
+		row := e.Value.([]interface{})
+		for len(cols) < len(row) {
+			col := newSchemaNode()
+			// a column first seen in a later row was missing from earlier rows
+			if i > 0 {
+				col.types["null"] = true
+			}
+			cols = append(cols, col)
+		}
+		for j, col := range cols {
+			if j < len(row) {
+				col.observe(row[j])
+			} else {
+				col.types["null"] = true
+			}
+		}
+	}
+
+	items := make([]interface{}, len(cols))
+	for i, col := range cols {
+		sch := col.schema()
+		if i < len(titles) && titles[i] != "" {
+			sch["title"] = titles[i]
+		} else {
+			sch["title"] = fmt.Sprintf("field_%d", i+1)
+		}
+		items[i] = sch
+	}
+	return map[string]interface{}{
+		"type": "array",
+		"items": map[string]interface{}{
+			"type":  "array",
+			"items": items,
+		},
+	}
+}
+
+// readEntries reads all entries from a reader. On error it returns the entries
+// read before the one that failed
+func readEntries(r dsio.EntryReader) ([]dsio.Entry, error) {
+	var entries []dsio.Entry
+	for {
+		e, err := r.ReadEntry()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, e)
+	}
+}
+
+// schemaNode accumulates observations of values at one position in a body
+type schemaNode struct {
+	types map[string]bool
+	// counts of values that set a format: strings that are all date-times get
+	// format "date-time", numbers that are all decimals get format "decimal"
+	strings, dateTimes int
+	numbers, decimals  int
+	// objects counts observed objects, to find properties missing from some
+	objects int
+	props   map[string]*schemaNode
+	// seen counts the objects each property was found in
+	seen  map[string]int
+	items *schemaNode
+}
+
+func newSchemaNode() *schemaNode {
+	return &schemaNode{types: map[string]bool{}}
+}
+
+func (n *schemaNode) observe(v interface{}) {
+	switch x := v.(type) {
+	case nil:
+		n.types["null"] = true
+	case bool:
+		n.types["boolean"] = true
+	case int, int64:
+		n.types["integer"] = true
+	case float64:
+		n.types["number"] = true
+		n.numbers++
+	case json.Number:
+		n.types["number"] = true
+		n.numbers++
+		n.decimals++
+	case string:
+		n.types["string"] = true
+		n.strings++
+		if _, err := time.Parse(time.RFC3339Nano, x); err == nil {
+			n.dateTimes++
+		}
+	case []interface{}:
+		n.types["array"] = true
+		if n.items == nil {
+			n.items = newSchemaNode()
+		}
+		for _, e := range x {
+			n.items.observe(e)
+		}
+	case map[string]interface{}:
+		n.types["object"] = true
+		n.objects++
+		for k, e := range x {
+			n.observeProperty(k, e)
+		}
+	}
+}
+
+func (n *schemaNode) observeProperty(key string, v interface{}) {
+	if n.props == nil {
+		n.props = map[string]*schemaNode{}
+		n.seen = map[string]int{}
+	}
+	p, ok := n.props[key]
+	if !ok {
+		p = newSchemaNode()
+		n.props[key] = p
+	}
+	n.seen[key]++
+	p.observe(v)
+}
+
+// schema converts observations to json schema. integers are folded into number
+// when both are seen, and nullable values list "null" as a type. properties
+// missing from some objects are nullable. decimals & date-time strings set the
+// format of values that are only of that kind
+func (n *schemaNode) schema() map[string]interface{} {
+	sch := map[string]interface{}{}
+
+	var types []string
+	for t := range n.types {
+		if t == "null" || (t == "integer" && n.types["number"]) {
+			continue
+		}
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	if n.types["null"] {
+		types = append(types, "null")
+	}
+	switch len(types) {
+	case 0:
+	case 1:
+		sch["type"] = types[0]
+	default:
+		list := make([]interface{}, len(types))
+		for i, t := range types {
+			list[i] = t
+		}
+		sch["type"] = list
+	}
+
+	if len(types) == 1 || (len(types) == 2 && n.types["null"]) {
+		switch {
+		case types[0] == "string" && n.dateTimes == n.strings:
+			sch["format"] = "date-time"
+		case types[0] == "number" && n.decimals > 0 && n.decimals == n.numbers:
+			sch["format"] = "decimal"
+		}
+	}
+
+	if n.items != nil && len(n.items.types) > 0 {
+		sch["items"] = n.items.schema()
+	}
+	if n.props != nil {
+		props := map[string]interface{}{}
+		for k, p := range n.props {
+			if n.objects > 0 && n.seen[k] < n.objects {
+				p.types["null"] = true
+			}
+			props[k] = p.schema()
+		}
+		sch["properties"] = props
+	}
+	return sch
+}
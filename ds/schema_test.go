@@ -0,0 +1,110 @@
+package ds
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/qri-io/dataset"
+	"github.com/qri-io/dataset/dsio"
+	"go.starlark.net/starlark"
+)
+
+func TestInferSchema(t *testing.T) {
+	cases := []struct {
+		description string
+		entries     []dsio.Entry
+		object      bool
+		titles      []string
+		expect      string
+	}{
+		{"empty array", nil, false, nil, `{"type":"array"}`},
+		{"array of scalars", []dsio.Entry{{Value: 1}, {Value: 2.5}, {Value: nil}}, false, nil,
+			`{"items":{"type":["number","null"]},"type":"array"}`},
+		{"table", []dsio.Entry{
+			{Value: []interface{}{"a", 1, true}},
+			{Value: []interface{}{"b", nil}},
+		}, false, []string{"name"},
+			`{"items":{"items":[{"title":"name","type":"string"},{"title":"field_2","type":["integer","null"]},{"title":"field_3","type":["boolean","null"]}],"type":"array"},"type":"array"}`},
+		{"array of objects", []dsio.Entry{
+			{Value: map[string]interface{}{"a": 1, "b": map[string]interface{}{"c": "x"}}},
+			{Value: map[string]interface{}{"a": 2, "d": []interface{}{1, "y"}}},
+		}, false, nil,
+			`{"items":{"properties":{"a":{"type":"integer"},"b":{"properties":{"c":{"type":"string"}},"type":["object","null"]},"d":{"items":{"type":["integer","string"]},"type":["array","null"]}},"type":"object"},"type":"array"}`},
+		{"object", []dsio.Entry{{Key: "a", Value: "x"}, {Key: "b", Value: []interface{}{1.5}}}, true, nil,
+			`{"properties":{"a":{"type":"string"},"b":{"items":{"type":"number"},"type":"array"}},"type":"object"}`},
+	}
+
+	for _, c := range cases {
+		data, err := json.Marshal(InferSchema(c.entries, c.object, c.titles))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != c.expect {
+			t.Errorf("%s: schema mismatch.\nexpected: %s\ngot:      %s", c.description, c.expect, string(data))
+		}
+	}
+}
+
+func TestSetBodyInfersSchema(t *testing.T) {
+	ds := NewDataset(nil, nil)
+	ds.SetMutable(&dataset.Dataset{})
+	thread := &starlark.Thread{}
+
+	rows := starlark.NewList([]starlark.Value{
+		starlark.NewList([]starlark.Value{starlark.String("a"), starlark.MakeInt(1)}),
+		starlark.NewList([]starlark.Value{starlark.String("b"), starlark.None}),
+	})
+	tbl, err := tableFromRows(rows, []string{"letter", "count"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ds.SetBody(thread, nil, starlark.Tuple{tbl}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(ds.write.Structure.Schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `{"items":{"items":[{"title":"letter","type":"string"},{"title":"count","type":["integer","null"]}],"type":"array"},"type":"array"}`
+	if string(data) != expect {
+		t.Errorf("schema mismatch.\nexpected: %s\ngot:      %s", expect, string(data))
+	}
+
+	// an existing structure is kept as-is
+	prev := &dataset.Dataset{Structure: &dataset.Structure{Format: "json", Schema: dataset.BaseSchemaArray}}
+	ds = NewDataset(prev, nil)
+	ds.SetMutable(&dataset.Dataset{})
+	if _, err := ds.SetBody(thread, nil, starlark.Tuple{rows}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(ds.write.Structure.Schema) != 1 {
+		t.Errorf("expected the inherited schema, got: %v", ds.write.Structure.Schema)
+	}
+}
+
+// failingReader reads n entries, then fails
+type failingReader struct {
+	n, i int
+}
+
+func (r *failingReader) Structure() *dataset.Structure { return nil }
+func (r *failingReader) Close() error                  { return nil }
+func (r *failingReader) ReadEntry() (dsio.Entry, error) {
+	if r.i == r.n {
+		return dsio.Entry{}, fmt.Errorf("bad entry")
+	}
+	r.i++
+	return dsio.Entry{Index: r.i - 1, Value: r.i}, nil
+}
+
+func TestReadEntriesError(t *testing.T) {
+	entries, err := readEntries(&failingReader{n: 3})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if len(entries) != 3 {
+		t.Errorf("expected the 3 entries read before the error, got: %v", entries)
+	}
+}
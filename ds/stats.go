@@ -0,0 +1,354 @@
+package ds
+
+import (
+	"container/heap"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/qri-io/dataset"
+	"github.com/qri-io/dataset/dsio"
+	"go.starlark.net/starlark"
+)
+
+// kmvSize is the number of hashes distinct estimates keep. columns with fewer
+// distinct values than this are counted exactly
+const kmvSize = 256
+
+// GetStats summarizes the dataset body without converting it to starlark values:
+// the entry count, byte length & per-column counts, min, max & distinct value
+// estimates, read in one pass over the body file. With columns=False the entry
+// count & length are read from the structure when it records them. When the body
+// is read the counted values are reported, so they agree with column counts
+func (d *Dataset) GetStats(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	columns := true
+	if err := starlark.UnpackArgs("get_stats", args, kwargs, "columns?", &columns); err != nil {
+		return starlark.None, err
+	}
+
+	provider := d.bodyProvider()
+	if provider == nil || provider.BodyFile() == nil {
+		return starlark.None, nil
+	}
+	st := provider.Structure
+	if st == nil {
+		return starlark.None, fmt.Errorf("get_stats: no structure for dataset")
+	}
+	defer d.since("get_stats", time.Now())
+
+	if !columns && st.Entries > 0 && st.Length > 0 {
+		return statsDict(st.Entries, int64(st.Length), nil), nil
+	}
+
+	s := newBodyStats(st)
+	var length int64
+	err := d.streamBody(provider, func(r io.Reader) error {
+		data := &countingReader{r: r}
+		var err error
+		if columns {
+			err = s.read(st, data)
+		} else {
+			err = s.count(st, data)
+		}
+		if err != nil {
+			return err
+		}
+		// count the bytes after the last entry
+		_, err = io.Copy(ioutil.Discard, data)
+		length = data.n
+		return err
+	})
+	if err != nil {
+		return starlark.None, fmt.Errorf("get_stats: %s", err)
+	}
+
+	var cols *starlark.Dict
+	if columns {
+		if cols, err = s.columnsDict(); err != nil {
+			return starlark.None, fmt.Errorf("get_stats: %s", err)
+		}
+	}
+	return statsDict(s.entries, length, cols), nil
+}
+
+func statsDict(entries int, length int64, columns *starlark.Dict) *starlark.Dict {
+	d := starlark.NewDict(3)
+	d.SetKey(starlark.String("entries"), starlark.MakeInt(entries))
+	d.SetKey(starlark.String("length"), starlark.MakeInt64(length))
+	if columns != nil {
+		d.SetKey(starlark.String("columns"), columns)
+	}
+	return d
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// bodyStats accumulates stats for the columns of a body. rows of arrays have a
+// column for each position, rows of objects a column for each key & other
+// values a single column named "value"
+type bodyStats struct {
+	entries int
+	columns []*columnStats
+	index   map[string]int
+	titles  []string
+	types   *typedSchema
+}
+
+func newBodyStats(st *dataset.Structure) *bodyStats {
+	s := &bodyStats{index: map[string]int{}}
+	for _, item := range schemaItems(st.Schema) {
+		sch, _ := item.(map[string]interface{})
+		title, _ := sch["title"].(string)
+		s.titles = append(s.titles, title)
+	}
+	if tlt, err := dsio.GetTopLevelType(st); err == nil && tlt == "array" {
+		s.types = newTypedSchema(st.Schema).item(0)
+	}
+	return s
+}
+
+// count reads entries, counting them without recording column stats
+func (s *bodyStats) count(st *dataset.Structure, data io.Reader) error {
+	r, err := newBodyReader(st, data)
+	if err != nil {
+		return err
+	}
+	for {
+		if _, err := r.ReadEntry(); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("entry %d: %s", s.entries, err)
+		}
+		s.entries++
+	}
+}
+
+// read reads entries, recording stats for each column
+func (s *bodyStats) read(st *dataset.Structure, data io.Reader) error {
+	r, err := newBodyReader(st, data)
+	if err != nil {
+		return err
+	}
+	for {
+		e, err := r.ReadEntry()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("entry %d: %s", s.entries, err)
+		}
+		s.entries++
+
+		switch row := e.Value.(type) {
+		case []interface{}:
+			for i, v := range row {
+				title := fmt.Sprintf("field_%d", i+1)
+				if i < len(s.titles) && s.titles[i] != "" {
+					title = s.titles[i]
+				}
+				s.column(title, s.types.item(i)).observe(v)
+			}
+		case map[string]interface{}:
+			keys := make([]string, 0, len(row))
+			for k := range row {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				s.column(k, s.types.prop(k)).observe(row[k])
+			}
+		default:
+			s.column("value", s.types).observe(row)
+		}
+	}
+}
+
+// column finds or adds the stats of a column
+func (s *bodyStats) column(name string, types *typedSchema) *columnStats {
+	if i, ok := s.index[name]; ok {
+		return s.columns[i]
+	}
+	c := &columnStats{name: name, types: types, distinct: &kmv{seen: map[uint64]bool{}}}
+	s.index[name] = len(s.columns)
+	s.columns = append(s.columns, c)
+	return c
+}
+
+func (s *bodyStats) columnsDict() (*starlark.Dict, error) {
+	cols := starlark.NewDict(len(s.columns))
+	for _, c := range s.columns {
+		col := starlark.NewDict(5)
+		col.SetKey(starlark.String("count"), starlark.MakeInt(c.count))
+		// values missing from a row count as nulls
+		col.SetKey(starlark.String("nulls"), starlark.MakeInt(s.entries-c.count))
+		for _, ext := range []struct {
+			key string
+			val interface{}
+		}{{"min", c.min}, {"max", c.max}} {
+			v, err := marshalTyped(ext.val, c.types)
+			if err != nil {
+				return nil, err
+			}
+			col.SetKey(starlark.String(ext.key), v)
+		}
+		col.SetKey(starlark.String("distinct"), starlark.MakeInt(c.distinct.estimate()))
+		cols.SetKey(starlark.String(c.name), col)
+	}
+	return cols, nil
+}
+
+// columnStats accumulates the stats of one column. min & max compare numbers
+// when a column has any, and strings otherwise
+type columnStats struct {
+	name  string
+	types *typedSchema
+	// count is the number of non-null values
+	count    int
+	min, max interface{}
+	minNum   float64
+	maxNum   float64
+	numbers  bool
+	distinct *kmv
+}
+
+func (c *columnStats) observe(v interface{}) {
+	if v == nil {
+		return
+	}
+	c.count++
+
+	switch x := v.(type) {
+	case string:
+		c.distinct.add("s" + x)
+		if !c.numbers && (c.min == nil || x < c.min.(string)) {
+			c.min = x
+		}
+		if !c.numbers && (c.max == nil || x > c.max.(string)) {
+			c.max = x
+		}
+		return
+	case bool:
+		c.distinct.add(strconv.FormatBool(x))
+		return
+	case []interface{}, map[string]interface{}:
+		data, _ := json.Marshal(x)
+		c.distinct.add("j" + string(data))
+		return
+	}
+
+	f, ok := number(v)
+	if !ok {
+		return
+	}
+	c.distinct.add("n" + strconv.FormatFloat(f, 'g', -1, 64))
+	if !c.numbers {
+		// numbers take precedence over strings
+		c.numbers = true
+		c.min, c.max, c.minNum, c.maxNum = v, v, f, f
+		return
+	}
+	if f < c.minNum {
+		c.min, c.minNum = v, f
+	}
+	if f > c.maxNum {
+		c.max, c.maxNum = v, f
+	}
+}
+
+// number converts a decoded numeric value to a float
+func number(v interface{}) (float64, bool) {
+	switch x := v.(type) {
+	case int:
+		return float64(x), true
+	case int64:
+		return float64(x), true
+	case float64:
+		return x, true
+	case json.Number:
+		f, err := x.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// kmv estimates the number of distinct values with a "k minimum values" sketch:
+// it keeps the smallest kmvSize hashes of the values it sees. if the hashes
+// are spread evenly, the k-th smallest hash h estimates the count as
+// (k-1) / (h / max hash)
+type kmv struct {
+	hashes hashHeap
+	seen   map[uint64]bool
+	// full is set once there are more distinct hashes than the sketch keeps
+	full bool
+}
+
+func (k *kmv) add(v string) {
+	h := fnv.New64a()
+	h.Write([]byte(v))
+	// mix the bits so similar values hash far apart
+	sum := mix64(h.Sum64())
+	if k.seen[sum] {
+		return
+	}
+	if len(k.hashes) < kmvSize {
+		k.seen[sum] = true
+		heap.Push(&k.hashes, sum)
+		return
+	}
+	k.full = true
+	if sum < k.hashes[0] {
+		delete(k.seen, k.hashes[0])
+		k.hashes[0] = sum
+		k.seen[sum] = true
+		heap.Fix(&k.hashes, 0)
+	}
+}
+
+func (k *kmv) estimate() int {
+	if !k.full {
+		return len(k.hashes)
+	}
+	frac := float64(k.hashes[0]) / float64(math.MaxUint64)
+	return int(math.Round(float64(kmvSize-1) / frac))
+}
+
+// mix64 is the finalizer of the splitmix64 generator
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// hashHeap is a max-heap of hashes, so the largest kept hash is at index 0
+type hashHeap []uint64
+
+func (h hashHeap) Len() int            { return len(h) }
+func (h hashHeap) Less(i, j int) bool  { return h[i] > h[j] }
+func (h hashHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *hashHeap) Push(x interface{}) { *h = append(*h, x.(uint64)) }
+func (h *hashHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,110 @@
+package ds
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/qri-io/dataset"
+	"github.com/qri-io/qfs"
+	"go.starlark.net/starlark"
+)
+
+func TestGetStats(t *testing.T) {
+	ds := csvDataset()
+	thread := &starlark.Thread{}
+
+	stats, err := ds.GetStats(thread, nil, starlark.Tuple{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `{"entries": 3, "length": 54, "columns": {` +
+		`"title": {"count": 3, "nulls": 0, "min": "bar", "max": "foo", "distinct": 3}, ` +
+		`"count": {"count": 3, "nulls": 0, "min": 1, "max": 3, "distinct": 3}, ` +
+		`"is great": {"count": 3, "nulls": 0, "min": "false", "max": "true", "distinct": 3}}}`
+	if stats.String() != expect {
+		t.Errorf("stats mismatch.\nexpected: %s\ngot:      %s", expect, stats)
+	}
+
+	// the body can still be read after stats are taken
+	body, err := ds.GetBody(thread, nil, starlark.Tuple{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := body.(*starlark.List).Len(); n != 3 {
+		t.Errorf("expected 3 body rows after get_stats, got: %d", n)
+	}
+}
+
+func TestGetStatsObjects(t *testing.T) {
+	prev := &dataset.Dataset{Structure: &dataset.Structure{Format: "json", Schema: dataset.BaseSchemaArray}}
+	prev.SetBodyFile(qfs.NewMemfileBytes("body.json", []byte(`[{"a": 1, "b": "x"}, {"a": 2.5}, {"a": null, "b": "y"}]`)))
+	ds := NewDataset(prev, nil)
+
+	stats, err := ds.GetStats(&starlark.Thread{}, nil, starlark.Tuple{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cols, _, _ := stats.(*starlark.Dict).Get(starlark.String("columns"))
+	expect := `{"a": {"count": 2, "nulls": 1, "min": 1, "max": 2.5, "distinct": 2}, ` +
+		`"b": {"count": 2, "nulls": 1, "min": "x", "max": "y", "distinct": 2}}`
+	if cols.String() != expect {
+		t.Errorf("columns mismatch.\nexpected: %s\ngot:      %s", expect, cols)
+	}
+}
+
+func TestGetStatsFromStructure(t *testing.T) {
+	prev := &dataset.Dataset{Structure: &dataset.Structure{Format: "json", Schema: dataset.BaseSchemaArray, Entries: 100, Length: 2048}}
+	prev.SetBodyFile(qfs.NewMemfileBytes("body.json", []byte(`[1,2,3]`)))
+	ds := NewDataset(prev, nil)
+	kwargs := []starlark.Tuple{{starlark.String("columns"), starlark.False}}
+
+	stats, err := ds.GetStats(&starlark.Thread{}, nil, starlark.Tuple{}, kwargs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expect := `{"entries": 100, "length": 2048}`; stats.String() != expect {
+		t.Errorf("expected stats from the structure: %s, got: %s", expect, stats)
+	}
+
+	// column stats read the body, reporting counts that agree with the columns
+	// even when the recorded counts are stale
+	if stats, err = ds.GetStats(&starlark.Thread{}, nil, starlark.Tuple{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := stats.String(); !strings.HasPrefix(got, `{"entries": 3, "length": 7, "columns": {"value": {"count": 3, "nulls": 0,`) {
+		t.Errorf("expected counted stats with column stats, got: %s", got)
+	}
+
+	// without recorded counts the body is counted
+	prev.Structure.Entries, prev.Structure.Length = 0, 0
+	if stats, err = ds.GetStats(&starlark.Thread{}, nil, starlark.Tuple{}, kwargs); err != nil {
+		t.Fatal(err)
+	}
+	if expect := `{"entries": 3, "length": 7}`; stats.String() != expect {
+		t.Errorf("expected counted stats: %s, got: %s", expect, stats)
+	}
+
+	if stats, err = NewDataset(nil, nil).GetStats(&starlark.Thread{}, nil, starlark.Tuple{}, nil); err != nil || stats != starlark.None {
+		t.Errorf("expected None stats for a dataset without a body, got: %v, %v", stats, err)
+	}
+}
+
+func TestKMVEstimate(t *testing.T) {
+	for _, n := range []int{10, kmvSize, 10000, 100000} {
+		k := &kmv{seen: map[uint64]bool{}}
+		for i := 0; i < n; i++ {
+			k.add(fmt.Sprintf("value %d", i))
+			// repeats don't change the estimate
+			k.add(fmt.Sprintf("value %d", i/2))
+		}
+		got := k.estimate()
+		if n <= kmvSize && got != n {
+			t.Errorf("expected an exact count of %d, got: %d", n, got)
+		}
+		if err := math.Abs(float64(got-n)) / float64(n); err > 0.15 {
+			t.Errorf("estimate of %d distinct values is off by %.0f%%: %d", n, err*100, got)
+		}
+	}
+}
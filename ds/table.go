@@ -0,0 +1,943 @@
+package ds
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// Table is a starlark type for tabular data: rows of values with named columns.
+// Tables are immutable, methods like filter & sort return new tables. Indexing
+// a table with a column name gives the column's values as a list, indexing with
+// an int gives a row
+type Table struct {
+	columns []string
+	// schemas holds the json schema of each column, as found in a structure's
+	// items schema
+	schemas []map[string]interface{}
+	rows    [][]starlark.Value
+	frozen  bool
+}
+
+var (
+	_ starlark.Sequence = (*Table)(nil)
+	_ starlark.Mapping  = (*Table)(nil)
+	_ starlark.HasAttrs = (*Table)(nil)
+)
+
+// NewTable creates a table from column names & rows of values. Rows shorter than
+// columns are padded with None
+func NewTable(columns []string, rows [][]starlark.Value) *Table {
+	t := &Table{columns: columns, schemas: make([]map[string]interface{}, len(columns))}
+	for i, name := range columns {
+		t.schemas[i] = map[string]interface{}{"title": name}
+	}
+	for _, row := range rows {
+		t.rows = append(t.rows, pad(row, len(columns)))
+	}
+	return t
+}
+
+// MakeTable creates a table from starlark: table(rows, columns=None). rows can be
+// a list of lists, in which case columns names them, or a list of dicts, in which
+// case columns default to the keys of the dicts in the order they're first seen
+func MakeTable(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		rows    starlark.Iterable
+		columns starlark.Iterable
+	)
+	if err := starlark.UnpackArgs("table", args, kwargs, "rows", &rows, "columns?", &columns); err != nil {
+		return starlark.None, err
+	}
+
+	var names []string
+	if columns != nil {
+		var err error
+		if names, err = stringList("table", columns); err != nil {
+			return starlark.None, err
+		}
+	}
+	return tableFromRows(rows, names, nil)
+}
+
+// tableFromRows builds a table from an iterable of rows. schema items, if any,
+// name & describe the columns of list rows
+func tableFromRows(rows starlark.Iterable, columns []string, items []interface{}) (*Table, error) {
+	t := &Table{}
+	for i, item := range items {
+		sch, _ := item.(map[string]interface{})
+		name := ""
+		if sch != nil {
+			name, _ = sch["title"].(string)
+		}
+		if name == "" {
+			name = fmt.Sprintf("field_%d", i+1)
+		}
+		t.addColumn(name, sch)
+	}
+	for _, name := range columns {
+		t.addColumn(name, nil)
+	}
+	named := len(t.columns) > 0
+
+	iter := rows.Iterate()
+	defer iter.Done()
+	var row starlark.Value
+	for i := 0; iter.Next(&row); i++ {
+		switch r := row.(type) {
+		case *starlark.Dict:
+			vals := make([]starlark.Value, len(t.columns))
+			for _, item := range r.Items() {
+				key, ok := starlark.AsString(item[0])
+				if !ok {
+					return nil, fmt.Errorf("row %d: column names must be strings, got %s", i, item[0].Type())
+				}
+				col := t.column(key)
+				if col < 0 {
+					if named {
+						continue
+					}
+					col = t.addColumn(key, nil)
+					vals = append(vals, nil)
+				}
+				vals[col] = item[1]
+			}
+			t.rows = append(t.rows, vals)
+		case starlark.String:
+			return nil, fmt.Errorf("row %d: expected a list or dict, got string", i)
+		case starlark.Indexable:
+			vals := make([]starlark.Value, r.Len())
+			for j := range vals {
+				vals[j] = r.Index(j)
+			}
+			for j := len(t.columns); j < len(vals); j++ {
+				t.addColumn(fmt.Sprintf("field_%d", j+1), nil)
+			}
+			t.rows = append(t.rows, vals)
+		default:
+			return nil, fmt.Errorf("row %d: expected a list or dict, got %s", i, row.Type())
+		}
+	}
+
+	// pad rows read before later rows added columns
+	for i, row := range t.rows {
+		t.rows[i] = pad(row, len(t.columns))
+	}
+	return t, nil
+}
+
+func (t *Table) addColumn(name string, schema map[string]interface{}) int {
+	sch := map[string]interface{}{}
+	for k, v := range schema {
+		sch[k] = v
+	}
+	sch["title"] = name
+	t.columns = append(t.columns, name)
+	t.schemas = append(t.schemas, sch)
+	return len(t.columns) - 1
+}
+
+// pad extends row to n values with None, replacing nil values with None
+func pad(row []starlark.Value, n int) []starlark.Value {
+	if len(row) < n {
+		row = append(row, make([]starlark.Value, n-len(row))...)
+	}
+	for i, v := range row {
+		if v == nil {
+			row[i] = starlark.None
+		}
+	}
+	return row
+}
+
+// Columns returns the table's column names
+func (t *Table) Columns() []string {
+	return t.columns
+}
+
+// Schema returns a json schema describing the table as an array of rows
+func (t *Table) Schema() map[string]interface{} {
+	items := make([]interface{}, len(t.schemas))
+	for i, sch := range t.schemas {
+		items[i] = sch
+	}
+	return map[string]interface{}{
+		"type": "array",
+		"items": map[string]interface{}{
+			"type":  "array",
+			"items": items,
+		},
+	}
+}
+
+// column returns the index of a named column, or -1 if the table doesn't have it
+func (t *Table) column(name string) int {
+	for i, c := range t.columns {
+		if c == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// columnIndexes looks up the indexes of named columns
+func (t *Table) columnIndexes(fn string, names []string) ([]int, error) {
+	idxs := make([]int, len(names))
+	for i, name := range names {
+		if idxs[i] = t.column(name); idxs[i] < 0 {
+			return nil, fmt.Errorf("%s: table has no column '%s'", fn, name)
+		}
+	}
+	return idxs, nil
+}
+
+// derive creates an empty table with the columns of t at idxs
+func (t *Table) derive(idxs []int) *Table {
+	d := &Table{}
+	for _, i := range idxs {
+		d.addColumn(t.columns[i], t.schemas[i])
+	}
+	return d
+}
+
+// ordered reorders columns to follow the titles of schema items, keeping the
+// item schemas. columns the schema doesn't list follow in their existing order
+func (t *Table) ordered(items []interface{}) *Table {
+	var idxs []int
+	for _, item := range items {
+		sch, _ := item.(map[string]interface{})
+		title, _ := sch["title"].(string)
+		if i := t.column(title); i >= 0 && !contains(idxs, i) {
+			idxs = append(idxs, i)
+			t.schemas[i] = sch
+		}
+	}
+	for i := range t.columns {
+		if !contains(idxs, i) {
+			idxs = append(idxs, i)
+		}
+	}
+
+	o := t.derive(idxs)
+	for _, row := range t.rows {
+		vals := make([]starlark.Value, len(idxs))
+		for i, j := range idxs {
+			vals[i] = row[j]
+		}
+		o.rows = append(o.rows, vals)
+	}
+	return o
+}
+
+// String implements the starlark.Value interface
+func (t *Table) String() string {
+	cols := make([]string, len(t.columns))
+	for i, c := range t.columns {
+		cols[i] = starlark.String(c).String()
+	}
+	return fmt.Sprintf("table(rows=%d, columns=[%s])", len(t.rows), strings.Join(cols, ", "))
+}
+
+// Type implements the starlark.Value interface
+func (t *Table) Type() string { return "table" }
+
+// Freeze implements the starlark.Value interface
+func (t *Table) Freeze() {
+	if t.frozen {
+		return
+	}
+	t.frozen = true
+	for _, row := range t.rows {
+		for _, v := range row {
+			v.Freeze()
+		}
+	}
+}
+
+// Truth implements the starlark.Value interface. Tables with rows are true
+func (t *Table) Truth() starlark.Bool { return len(t.rows) > 0 }
+
+// Hash implements the starlark.Value interface. Tables aren't hashable
+func (t *Table) Hash() (uint32, error) { return 0, fmt.Errorf("unhashable type: table") }
+
+// Len implements the starlark.Sequence interface, giving the number of rows
+func (t *Table) Len() int { return len(t.rows) }
+
+// Iterate implements the starlark.Iterable interface, iterating rows as lists
+func (t *Table) Iterate() starlark.Iterator { return &tableIterator{t: t} }
+
+type tableIterator struct {
+	t *Table
+	i int
+}
+
+func (it *tableIterator) Next(p *starlark.Value) bool {
+	if it.i >= len(it.t.rows) {
+		return false
+	}
+	*p = it.t.row(it.i)
+	it.i++
+	return true
+}
+
+func (it *tableIterator) Done() {}
+
+// row returns a copy of the row at i as a list
+func (t *Table) row(i int) *starlark.List {
+	vals := make([]starlark.Value, len(t.rows[i]))
+	copy(vals, t.rows[i])
+	return starlark.NewList(vals)
+}
+
+// rowDict returns a row as a dict keyed by column name
+func (t *Table) rowDict(i int) *starlark.Dict {
+	d := starlark.NewDict(len(t.columns))
+	for j, c := range t.columns {
+		d.SetKey(starlark.String(c), t.rows[i][j])
+	}
+	return d
+}
+
+// Get implements the starlark.Mapping interface. String keys select a column's
+// values, int keys select a row
+func (t *Table) Get(k starlark.Value) (v starlark.Value, found bool, err error) {
+	switch key := k.(type) {
+	case starlark.String:
+		i := t.column(string(key))
+		if i < 0 {
+			return nil, false, fmt.Errorf("table has no column %s", key)
+		}
+		vals := make([]starlark.Value, len(t.rows))
+		for j, row := range t.rows {
+			vals[j] = row[i]
+		}
+		return starlark.NewList(vals), true, nil
+	case starlark.Int:
+		i, err := starlark.AsInt32(key)
+		if err != nil {
+			return nil, false, err
+		}
+		if i < 0 {
+			i += len(t.rows)
+		}
+		if i < 0 || i >= len(t.rows) {
+			return nil, false, fmt.Errorf("table index %s out of range [%d:%d]", key, -len(t.rows), len(t.rows))
+		}
+		return t.row(i), true, nil
+	}
+	return nil, false, fmt.Errorf("table index must be a column name or row number, got %s", k.Type())
+}
+
+// Attr implements the starlark.HasAttrs interface
+func (t *Table) Attr(name string) (starlark.Value, error) {
+	if name == "columns" {
+		cols := make([]starlark.Value, len(t.columns))
+		for i, c := range t.columns {
+			cols[i] = starlark.String(c)
+		}
+		return starlark.NewList(cols), nil
+	}
+	if fn, ok := tableMethods[name]; ok {
+		return fn.BindReceiver(t), nil
+	}
+	return nil, nil
+}
+
+// AttrNames implements the starlark.HasAttrs interface
+func (t *Table) AttrNames() []string {
+	names := []string{"columns"}
+	for name := range tableMethods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var tableMethods = map[string]*starlark.Builtin{
+	"filter":    starlark.NewBuiltin("filter", tableFilter),
+	"select":    starlark.NewBuiltin("select", tableSelect),
+	"sort":      starlark.NewBuiltin("sort", tableSort),
+	"group_by":  starlark.NewBuiltin("group_by", tableGroupBy),
+	"join":      starlark.NewBuiltin("join", tableJoin),
+	"aggregate": starlark.NewBuiltin("aggregate", tableAggregate),
+}
+
+// tableFilter keeps rows for which fn(row) is true. rows are passed as dicts
+// keyed by column name
+func tableFilter(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	t := b.Receiver().(*Table)
+	var fn starlark.Callable
+	if err := starlark.UnpackArgs("filter", args, kwargs, "fn", &fn); err != nil {
+		return starlark.None, err
+	}
+
+	f := &Table{columns: t.columns, schemas: t.schemas}
+	for i, row := range t.rows {
+		keep, err := starlark.Call(thread, fn, starlark.Tuple{t.rowDict(i)}, nil)
+		if err != nil {
+			return starlark.None, err
+		}
+		if keep.Truth() {
+			f.rows = append(f.rows, row)
+		}
+	}
+	return f, nil
+}
+
+// tableSelect picks columns by name, in the order given
+func tableSelect(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	t := b.Receiver().(*Table)
+	if len(kwargs) > 0 {
+		return starlark.None, fmt.Errorf("select: unexpected keyword arguments")
+	}
+	names, err := stringList("select", args)
+	if err != nil {
+		return starlark.None, err
+	}
+	idxs, err := t.columnIndexes("select", names)
+	if err != nil {
+		return starlark.None, err
+	}
+
+	s := t.derive(idxs)
+	for _, row := range t.rows {
+		vals := make([]starlark.Value, len(idxs))
+		for i, j := range idxs {
+			vals[i] = row[j]
+		}
+		s.rows = append(s.rows, vals)
+	}
+	return s, nil
+}
+
+// tableSort orders rows by one or more columns. the sort is stable, and None
+// sorts before other values
+func tableSort(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	t := b.Receiver().(*Table)
+	var (
+		by      starlark.Value
+		reverse bool
+	)
+	if err := starlark.UnpackArgs("sort", args, kwargs, "by", &by, "reverse?", &reverse); err != nil {
+		return starlark.None, err
+	}
+	names, err := columnNames("sort", by)
+	if err != nil {
+		return starlark.None, err
+	}
+	idxs, err := t.columnIndexes("sort", names)
+	if err != nil {
+		return starlark.None, err
+	}
+
+	s := &Table{columns: t.columns, schemas: t.schemas, rows: make([][]starlark.Value, len(t.rows))}
+	copy(s.rows, t.rows)
+	var cmpErr error
+	sort.SliceStable(s.rows, func(i, j int) bool {
+		a, b := s.rows[i], s.rows[j]
+		if reverse {
+			a, b = b, a
+		}
+		for _, c := range idxs {
+			less, err := lessValue(a[c], b[c])
+			if err != nil && cmpErr == nil {
+				cmpErr = fmt.Errorf("sort: column '%s': %s", t.columns[c], err)
+			}
+			if less {
+				return true
+			}
+			if greater, _ := lessValue(b[c], a[c]); greater {
+				return false
+			}
+		}
+		return false
+	})
+	if cmpErr != nil {
+		return starlark.None, cmpErr
+	}
+	return s, nil
+}
+
+// lessValue compares starlark values, sorting None first
+func lessValue(a, b starlark.Value) (bool, error) {
+	if a == starlark.None || b == starlark.None {
+		return a == starlark.None && b != starlark.None, nil
+	}
+	return starlark.Compare(syntax.LT, a, b)
+}
+
+// tableGroupBy groups rows by the values of one or more columns
+func tableGroupBy(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	t := b.Receiver().(*Table)
+	if len(kwargs) > 0 {
+		return starlark.None, fmt.Errorf("group_by: unexpected keyword arguments")
+	}
+	names, err := stringList("group_by", args)
+	if err != nil {
+		return starlark.None, err
+	}
+	if len(names) == 0 {
+		return starlark.None, fmt.Errorf("group_by: at least one column is required")
+	}
+	idxs, err := t.columnIndexes("group_by", names)
+	if err != nil {
+		return starlark.None, err
+	}
+
+	g := &GroupedTable{table: t, keyCols: idxs, index: starlark.NewDict(0)}
+	for i, row := range t.rows {
+		key := g.key(row)
+		n, found, err := g.index.Get(key)
+		if err != nil {
+			return starlark.None, fmt.Errorf("group_by: %s", err)
+		}
+		if !found {
+			n = starlark.MakeInt(len(g.groups))
+			g.index.SetKey(key, n)
+			g.keys = append(g.keys, key)
+			g.groups = append(g.groups, nil)
+		}
+		gi, _ := starlark.AsInt32(n)
+		g.groups[gi] = append(g.groups[gi], i)
+	}
+	return g, nil
+}
+
+// tableJoin combines rows of two tables with equal values in the "on" columns.
+// how is "inner" to keep only matched rows or "left" to keep every row of the
+// left table. right table columns that share a name with a left column are
+// suffixed with "_right"
+func tableJoin(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	left := b.Receiver().(*Table)
+	var (
+		right *Table
+		on    starlark.Value
+		how   = "inner"
+	)
+	if err := starlark.UnpackArgs("join", args, kwargs, "other", &right, "on", &on, "how?", &how); err != nil {
+		return starlark.None, err
+	}
+	if how != "inner" && how != "left" {
+		return starlark.None, fmt.Errorf("join: how must be 'inner' or 'left', got '%s'", how)
+	}
+	names, err := columnNames("join", on)
+	if err != nil {
+		return starlark.None, err
+	}
+	lidx, err := left.columnIndexes("join", names)
+	if err != nil {
+		return starlark.None, err
+	}
+	ridx, err := right.columnIndexes("join", names)
+	if err != nil {
+		return starlark.None, err
+	}
+
+	// index right rows by key
+	index := starlark.NewDict(len(right.rows))
+	var matches [][]int
+	for i, row := range right.rows {
+		key := keyTuple(row, ridx)
+		n, found, err := index.Get(key)
+		if err != nil {
+			return starlark.None, fmt.Errorf("join: %s", err)
+		}
+		if !found {
+			n = starlark.MakeInt(len(matches))
+			index.SetKey(key, n)
+			matches = append(matches, nil)
+		}
+		mi, _ := starlark.AsInt32(n)
+		matches[mi] = append(matches[mi], i)
+	}
+
+	j := &Table{}
+	for i, name := range left.columns {
+		j.addColumn(name, left.schemas[i])
+	}
+	var rcols []int
+	for i, name := range right.columns {
+		if contains(ridx, i) {
+			continue
+		}
+		if j.column(name) >= 0 {
+			name += "_right"
+		}
+		j.addColumn(name, right.schemas[i])
+		rcols = append(rcols, i)
+	}
+
+	for _, row := range left.rows {
+		n, found, err := index.Get(keyTuple(row, lidx))
+		if err != nil {
+			return starlark.None, fmt.Errorf("join: %s", err)
+		}
+		if !found {
+			if how == "left" {
+				j.rows = append(j.rows, pad(append(append([]starlark.Value{}, row...), make([]starlark.Value, len(rcols))...), len(j.columns)))
+			}
+			continue
+		}
+		mi, _ := starlark.AsInt32(n)
+		for _, ri := range matches[mi] {
+			vals := append([]starlark.Value{}, row...)
+			for _, c := range rcols {
+				vals = append(vals, right.rows[ri][c])
+			}
+			j.rows = append(j.rows, vals)
+		}
+	}
+	return j, nil
+}
+
+// tableAggregate reduces a table to a single row of aggregates
+func tableAggregate(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	t := b.Receiver().(*Table)
+	aggs, err := parseAggregates(t, args, kwargs)
+	if err != nil {
+		return starlark.None, err
+	}
+	rows := make([]int, len(t.rows))
+	for i := range rows {
+		rows[i] = i
+	}
+
+	a := &Table{}
+	for _, agg := range aggs {
+		a.addColumn(agg.name, nil)
+	}
+	vals, err := aggregateRows(thread, t, rows, aggs)
+	if err != nil {
+		return starlark.None, err
+	}
+	a.rows = [][]starlark.Value{vals}
+	return a, nil
+}
+
+// aggregate is a named reduction of a column's values
+type aggregate struct {
+	name string
+	col  int
+	fn   string
+	call starlark.Callable
+}
+
+// parseAggregates reads aggregates from keyword arguments like
+// total=("amount", "sum"), where the function is the name of a built-in
+// aggregate or a callable that accepts a list of column values
+func parseAggregates(t *Table, args starlark.Tuple, kwargs []starlark.Tuple) ([]aggregate, error) {
+	if len(args) > 0 {
+		return nil, fmt.Errorf("aggregate: aggregates must be keyword arguments, eg: total=(\"amount\", \"sum\")")
+	}
+	if len(kwargs) == 0 {
+		return nil, fmt.Errorf("aggregate: at least one aggregate is required")
+	}
+
+	aggs := make([]aggregate, len(kwargs))
+	for i, kw := range kwargs {
+		name := string(kw[0].(starlark.String))
+		spec, ok := kw[1].(starlark.Indexable)
+		if !ok || spec.Len() != 2 {
+			return nil, fmt.Errorf("aggregate: %s must be a (column, function) pair", name)
+		}
+		col, ok := starlark.AsString(spec.Index(0))
+		if !ok {
+			return nil, fmt.Errorf("aggregate: %s column must be a string", name)
+		}
+		agg := aggregate{name: name, col: t.column(col)}
+		if agg.col < 0 {
+			return nil, fmt.Errorf("aggregate: table has no column '%s'", col)
+		}
+		switch fn := spec.Index(1).(type) {
+		case starlark.String:
+			if _, ok := aggregateFuncs[string(fn)]; !ok {
+				return nil, fmt.Errorf("aggregate: unknown function '%s' for %s, expected one of: %s", string(fn), name, strings.Join(aggregateFuncNames(), ", "))
+			}
+			agg.fn = string(fn)
+		case starlark.Callable:
+			agg.call = fn
+		default:
+			return nil, fmt.Errorf("aggregate: %s function must be a string or callable, got %s", name, fn.Type())
+		}
+		aggs[i] = agg
+	}
+	return aggs, nil
+}
+
+// aggregateRows computes aggregates over a subset of rows
+func aggregateRows(thread *starlark.Thread, t *Table, rows []int, aggs []aggregate) ([]starlark.Value, error) {
+	vals := make([]starlark.Value, len(aggs))
+	for i, agg := range aggs {
+		col := make([]starlark.Value, len(rows))
+		for j, r := range rows {
+			col[j] = t.rows[r][agg.col]
+		}
+
+		var err error
+		if agg.call != nil {
+			vals[i], err = starlark.Call(thread, agg.call, starlark.Tuple{starlark.NewList(col)}, nil)
+		} else {
+			vals[i], err = aggregateFuncs[agg.fn](col)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("aggregate: %s: %s", agg.name, err)
+		}
+	}
+	return vals, nil
+}
+
+// aggregateFuncs are the built-in aggregates. all but count ignore None values
+var aggregateFuncs = map[string]func(vals []starlark.Value) (starlark.Value, error){
+	"count": func(vals []starlark.Value) (starlark.Value, error) {
+		return starlark.MakeInt(len(vals)), nil
+	},
+	"sum": func(vals []starlark.Value) (starlark.Value, error) {
+		var sum starlark.Value = starlark.MakeInt(0)
+		for _, v := range vals {
+			if v == starlark.None {
+				continue
+			}
+			var err error
+			if sum, err = starlark.Binary(syntax.PLUS, sum, v); err != nil {
+				return nil, err
+			}
+		}
+		return sum, nil
+	},
+	"mean": func(vals []starlark.Value) (starlark.Value, error) {
+		var sum starlark.Value = starlark.MakeInt(0)
+		n := 0
+		for _, v := range vals {
+			switch v.(type) {
+			case starlark.NoneType:
+				continue
+			case starlark.Int, starlark.Float, Decimal:
+			default:
+				return nil, fmt.Errorf("mean: expected a number, got %s", v.Type())
+			}
+			var err error
+			if sum, err = starlark.Binary(syntax.PLUS, sum, v); err != nil {
+				return nil, fmt.Errorf("mean: %s", err)
+			}
+			n++
+		}
+		if n == 0 {
+			return starlark.None, nil
+		}
+		// decimals divide exactly, other numbers give a float
+		return starlark.Binary(syntax.SLASH, sum, starlark.MakeInt(n))
+	},
+	"min": func(vals []starlark.Value) (starlark.Value, error) {
+		return extreme(vals, syntax.LT)
+	},
+	"max": func(vals []starlark.Value) (starlark.Value, error) {
+		return extreme(vals, syntax.GT)
+	},
+	"first": func(vals []starlark.Value) (starlark.Value, error) {
+		for _, v := range vals {
+			if v != starlark.None {
+				return v, nil
+			}
+		}
+		return starlark.None, nil
+	},
+	"last": func(vals []starlark.Value) (starlark.Value, error) {
+		for i := len(vals) - 1; i >= 0; i-- {
+			if vals[i] != starlark.None {
+				return vals[i], nil
+			}
+		}
+		return starlark.None, nil
+	},
+}
+
+func aggregateFuncNames() []string {
+	names := make([]string, 0, len(aggregateFuncs))
+	for name := range aggregateFuncs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// extreme finds the value that compares op against all others
+func extreme(vals []starlark.Value, op syntax.Token) (starlark.Value, error) {
+	var x starlark.Value = starlark.None
+	for _, v := range vals {
+		if v == starlark.None {
+			continue
+		}
+		if x == starlark.None {
+			x = v
+			continue
+		}
+		ok, err := starlark.Compare(op, v, x)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			x = v
+		}
+	}
+	return x, nil
+}
+
+// GroupedTable is the result of table.group_by, rows of a table grouped by the
+// values of key columns. Iterating a grouped table gives group keys, indexing it
+// with a key gives the group's rows as a table. Keys are single values when
+// grouping by one column, and tuples when grouping by more
+type GroupedTable struct {
+	table   *Table
+	keyCols []int
+	keys    []starlark.Value
+	groups  [][]int
+	// index maps keys to their position in keys & groups
+	index *starlark.Dict
+}
+
+var (
+	_ starlark.Sequence = (*GroupedTable)(nil)
+	_ starlark.Mapping  = (*GroupedTable)(nil)
+	_ starlark.HasAttrs = (*GroupedTable)(nil)
+)
+
+func (g *GroupedTable) key(row []starlark.Value) starlark.Value {
+	if len(g.keyCols) == 1 {
+		return row[g.keyCols[0]]
+	}
+	return keyTuple(row, g.keyCols)
+}
+
+// String implements the starlark.Value interface
+func (g *GroupedTable) String() string {
+	names := make([]string, len(g.keyCols))
+	for i, c := range g.keyCols {
+		names[i] = starlark.String(g.table.columns[c]).String()
+	}
+	return fmt.Sprintf("grouped_table(groups=%d, by=[%s])", len(g.groups), strings.Join(names, ", "))
+}
+
+// Type implements the starlark.Value interface
+func (g *GroupedTable) Type() string { return "grouped_table" }
+
+// Freeze implements the starlark.Value interface
+func (g *GroupedTable) Freeze() {
+	g.table.Freeze()
+	g.index.Freeze()
+}
+
+// Truth implements the starlark.Value interface
+func (g *GroupedTable) Truth() starlark.Bool { return len(g.groups) > 0 }
+
+// Hash implements the starlark.Value interface. Grouped tables aren't hashable
+func (g *GroupedTable) Hash() (uint32, error) {
+	return 0, fmt.Errorf("unhashable type: grouped_table")
+}
+
+// Len implements the starlark.Sequence interface, giving the number of groups
+func (g *GroupedTable) Len() int { return len(g.groups) }
+
+// Iterate implements the starlark.Iterable interface, iterating group keys
+func (g *GroupedTable) Iterate() starlark.Iterator {
+	return starlark.Tuple(g.keys).Iterate()
+}
+
+// Get implements the starlark.Mapping interface, giving the rows of a group
+func (g *GroupedTable) Get(k starlark.Value) (starlark.Value, bool, error) {
+	n, found, err := g.index.Get(k)
+	if err != nil || !found {
+		return nil, found, err
+	}
+	gi, _ := starlark.AsInt32(n)
+	t := &Table{columns: g.table.columns, schemas: g.table.schemas}
+	for _, r := range g.groups[gi] {
+		t.rows = append(t.rows, g.table.rows[r])
+	}
+	return t, true, nil
+}
+
+// Attr implements the starlark.HasAttrs interface
+func (g *GroupedTable) Attr(name string) (starlark.Value, error) {
+	if name == "aggregate" {
+		return starlark.NewBuiltin("aggregate", groupedAggregate).BindReceiver(g), nil
+	}
+	return nil, nil
+}
+
+// AttrNames implements the starlark.HasAttrs interface
+func (g *GroupedTable) AttrNames() []string { return []string{"aggregate"} }
+
+// groupedAggregate computes aggregates for each group, giving a table with the
+// key columns followed by a column for each aggregate
+func groupedAggregate(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	g := b.Receiver().(*GroupedTable)
+	aggs, err := parseAggregates(g.table, args, kwargs)
+	if err != nil {
+		return starlark.None, err
+	}
+
+	a := g.table.derive(g.keyCols)
+	for _, agg := range aggs {
+		a.addColumn(agg.name, nil)
+	}
+	for _, rows := range g.groups {
+		vals, err := aggregateRows(thread, g.table, rows, aggs)
+		if err != nil {
+			return starlark.None, err
+		}
+		key := make([]starlark.Value, 0, len(a.columns))
+		for _, c := range g.keyCols {
+			key = append(key, g.table.rows[rows[0]][c])
+		}
+		a.rows = append(a.rows, append(key, vals...))
+	}
+	return a, nil
+}
+
+// keyTuple collects the values of columns in a row as a hashable tuple
+func keyTuple(row []starlark.Value, cols []int) starlark.Tuple {
+	key := make(starlark.Tuple, len(cols))
+	for i, c := range cols {
+		key[i] = row[c]
+	}
+	return key
+}
+
+func contains(idxs []int, i int) bool {
+	for _, j := range idxs {
+		if i == j {
+			return true
+		}
+	}
+	return false
+}
+
+// columnNames reads a column name or list of column names
+func columnNames(fn string, v starlark.Value) ([]string, error) {
+	if s, ok := v.(starlark.String); ok {
+		return []string{string(s)}, nil
+	}
+	if iter, ok := v.(starlark.Iterable); ok {
+		return stringList(fn, iter)
+	}
+	return nil, fmt.Errorf("%s: expected a column name or list of column names, got %s", fn, v.Type())
+}
+
+// stringList reads an iterable of strings
+func stringList(fn string, iter starlark.Iterable) ([]string, error) {
+	var strs []string
+	it := iter.Iterate()
+	defer it.Done()
+	var v starlark.Value
+	for it.Next(&v) {
+		s, ok := starlark.AsString(v)
+		if !ok {
+			return nil, fmt.Errorf("%s: expected column names to be strings, got %s", fn, v.Type())
+		}
+		strs = append(strs, s)
+	}
+	return strs, nil
+}
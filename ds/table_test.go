@@ -0,0 +1,87 @@
+package ds
+
+import (
+	"testing"
+
+	"github.com/qri-io/dataset"
+	"github.com/qri-io/dataset/dsio"
+	"go.starlark.net/resolve"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarktest"
+)
+
+func TestTableFile(t *testing.T) {
+	resolve.AllowFloat = true
+	resolve.AllowSet = true
+	resolve.AllowLambda = true
+	thread := &starlark.Thread{Load: newLoader()}
+	starlarktest.SetReporter(thread, t)
+
+	if _, err := starlark.ExecFile(thread, "testdata/table.star", nil, nil); err != nil {
+		if ee, ok := err.(*starlark.EvalError); ok {
+			t.Error(ee.Backtrace())
+		} else {
+			t.Error(err)
+		}
+	}
+}
+
+func TestGetTable(t *testing.T) {
+	ds := csvDataset()
+	thread := &starlark.Thread{}
+
+	v, err := ds.GetTable(thread, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tbl := v.(*Table)
+	if expect := `table(rows=3, columns=["title", "count", "is great"])`; tbl.String() != expect {
+		t.Errorf("expected: %s, got: %s", expect, tbl)
+	}
+	if tbl.schemas[1]["type"] != "integer" {
+		t.Errorf("expected column schemas to come from the structure, got: %v", tbl.schemas[1])
+	}
+
+	sel, err := starlark.Call(thread, mustAttr(t, tbl, "select"), starlark.Tuple{starlark.String("count"), starlark.String("title")}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ds.SetBody(thread, nil, starlark.Tuple{sel}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	st := ds.write.Structure
+	if st.Format != "csv" {
+		t.Errorf("expected set_body to keep the csv format, got: %s", st.Format)
+	}
+	items := schemaItems(st.Schema)
+	if len(items) != 2 || items[0].(map[string]interface{})["title"] != "count" || items[0].(map[string]interface{})["type"] != "integer" {
+		t.Errorf("expected the written schema to describe the table, got: %v", st.Schema)
+	}
+
+	r, err := dsio.NewEntryReader(st, ds.write.BodyFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ent, err := r.ReadEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	row := ent.Value.([]interface{})
+	if len(row) != 2 || row[1] != "foo" {
+		t.Errorf("expected the first row to be [1, foo], got: %v", row)
+	}
+
+	obj := NewDataset(&dataset.Dataset{Structure: &dataset.Structure{Format: "json", Schema: dataset.BaseSchemaObject}}, nil)
+	if v, err := obj.GetTable(thread, nil, nil, nil); err != nil || v != starlark.None {
+		t.Errorf("expected None for a dataset without a body, got: %v, %v", v, err)
+	}
+}
+
+func mustAttr(t *testing.T, v starlark.HasAttrs, name string) starlark.Value {
+	attr, err := v.Attr(name)
+	if err != nil || attr == nil {
+		t.Fatalf("missing attribute %s: %v", name, err)
+	}
+	return attr
+}
@@ -0,0 +1,114 @@
+package startf
+
+import (
+	"go.starlark.net/resolve"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// raisedKey is the thread-local key the error builtin sets to the last error a script
+// raised. errors can be caught (eg: by assert.fails), so an error only counts as raised
+// if it's the error the builtin returned
+const raisedKey = "startf.raised"
+
+// TransformError is an error that occurred while executing a transform script. It
+// records where in the script the error happened, so the failing line can be shown
+// alongside the error
+type TransformError struct {
+	// Step is the name of the function ExecScript was calling when the error occurred,
+	// eg: "download" or "transform". Step is empty for errors in the top level of a script
+	Step string
+	// Message is the error message, without location details
+	Message string
+	// File, Line & Col locate the error in the script. Line & Col are zero when the
+	// error has no known location
+	File string
+	Line int
+	Col  int
+	// Frames is the starlark call stack at the time of the error, outermost call first
+	Frames []StackFrame
+	// Raised is true when the script raised the error by calling error(), and false
+	// for runtime failures
+	Raised bool
+	// Cause is the original error
+	Cause error
+
+	backtrace string
+}
+
+// StackFrame is a single function call in a script call stack
+type StackFrame struct {
+	Name string
+	File string
+	Line int
+	Col  int
+}
+
+// Error implements the error interface. For errors with a call stack the message
+// includes a backtrace
+func (e *TransformError) Error() string {
+	if e.backtrace != "" {
+		return e.backtrace
+	}
+	return e.Cause.Error()
+}
+
+// newTransformError wraps an error returned by starlark in a TransformError, returning
+// nil if err is nil
+func newTransformError(thread *starlark.Thread, step string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*TransformError); ok {
+		return err
+	}
+
+	te := &TransformError{
+		Step:    step,
+		Message: err.Error(),
+		Cause:   err,
+	}
+	switch e := err.(type) {
+	case *starlark.EvalError:
+		if thread != nil {
+			raised, _ := thread.Local(raisedKey).(error)
+			te.Raised = raised != nil && raised.Error() == e.Msg
+			thread.SetLocal(raisedKey, nil)
+		}
+		te.Message = e.Msg
+		te.backtrace = e.Backtrace()
+		te.Frames = stackFrames(e.CallStack)
+		// locate the error at the innermost call with a position in a script,
+		// skipping calls to builtins
+		for i := len(te.Frames) - 1; i >= 0; i-- {
+			if te.Frames[i].Line > 0 {
+				te.File, te.Line, te.Col = te.Frames[i].File, te.Frames[i].Line, te.Frames[i].Col
+				break
+			}
+		}
+	case syntax.Error:
+		te.Message = e.Msg
+		te.File, te.Line, te.Col = position(e.Pos)
+	case resolve.ErrorList:
+		if len(e) > 0 {
+			te.Message = e[0].Msg
+			te.File, te.Line, te.Col = position(e[0].Pos)
+		}
+	}
+
+	return te
+}
+
+func position(pos syntax.Position) (file string, line, col int) {
+	return pos.Filename(), int(pos.Line), int(pos.Col)
+}
+
+// stackFrames converts a starlark call stack, outermost call first
+func stackFrames(stack starlark.CallStack) []StackFrame {
+	frames := make([]StackFrame, len(stack))
+	for i, fr := range stack {
+		frames[i].Name = fr.Name
+		frames[i].File, frames[i].Line, frames[i].Col = position(fr.Pos)
+	}
+	return frames
+}
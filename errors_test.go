@@ -0,0 +1,103 @@
+package startf
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/qri-io/dataset"
+	"github.com/qri-io/qfs"
+	"go.starlark.net/starlark"
+)
+
+func TestTransformError(t *testing.T) {
+	cases := []struct {
+		config map[string]interface{}
+		step   string
+		line   int
+		raised bool
+		frames []string
+	}{
+		{map[string]interface{}{"fail_download": true}, "download", 2, false, []string{"download", "add_one"}},
+		{map[string]interface{}{"fail_download": false}, "transform", 10, true, []string{"transform", "error"}},
+	}
+
+	for i, c := range cases {
+		ds := &dataset.Dataset{Transform: &dataset.Transform{Config: c.config}}
+		ds.Transform.SetScriptFile(scriptFile(t, "testdata/errors.star"))
+		err := ExecScript(ds, nil)
+		te, ok := err.(*TransformError)
+		if !ok {
+			t.Errorf("case %d expected a *TransformError, got: %#v", i, err)
+			continue
+		}
+		if te.Step != c.step {
+			t.Errorf("case %d step mismatch. expected: %q, got: %q", i, c.step, te.Step)
+		}
+		if te.File != "testdata/errors.star" || te.Line != c.line {
+			t.Errorf("case %d location mismatch. expected: testdata/errors.star:%d, got: %s:%d", i, c.line, te.File, te.Line)
+		}
+		if te.Raised != c.raised {
+			t.Errorf("case %d raised mismatch. expected: %t, got: %t", i, c.raised, te.Raised)
+		}
+		names := make([]string, len(te.Frames))
+		for j, fr := range te.Frames {
+			names[j] = fr.Name
+		}
+		if strings.Join(names, ",") != strings.Join(c.frames, ",") {
+			t.Errorf("case %d frames mismatch. expected: %v, got: %v", i, c.frames, names)
+		}
+		if !strings.Contains(te.Error(), "Traceback") {
+			t.Errorf("case %d expected error to include a backtrace, got: %s", i, te.Error())
+		}
+		if te.Cause == nil {
+			t.Errorf("case %d expected error to have a cause", i)
+		}
+	}
+}
+
+func TestTransformErrorSyntax(t *testing.T) {
+	ds := &dataset.Dataset{Transform: &dataset.Transform{}}
+	ds.Transform.SetScriptFile(qfs.NewMemfileBytes("transform.star", []byte("def transform(ds, ctx)\n")))
+	err := ExecScript(ds, nil)
+	te, ok := err.(*TransformError)
+	if !ok {
+		t.Fatalf("expected a *TransformError, got: %#v", err)
+	}
+	if te.Step != "" || te.File != "transform.star" || te.Line != 2 {
+		t.Errorf("location mismatch. expected step '' at transform.star:2, got step %q at %s:%d", te.Step, te.File, te.Line)
+	}
+	if te.Raised {
+		t.Errorf("expected syntax error not to be marked as raised")
+	}
+}
+
+func TestTransformErrorRaisedCaught(t *testing.T) {
+	// catch calls a function & discards its error, the way assert.fails does
+	catch := starlark.NewBuiltin("catch", func(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		starlark.Call(thread, args[0], nil, nil)
+		return starlark.None, nil
+	})
+	predeclared := starlark.StringDict{
+		"error": starlark.NewBuiltin("error", Error),
+		"catch": catch,
+	}
+
+	cases := []struct {
+		script string
+		raised bool
+	}{
+		{"def f():\n  error('caught')\ncatch(f)\nx = 1 + 'a'\n", false},
+		{"def f():\n  error('caught')\ncatch(f)\nerror('uncaught')\n", true},
+	}
+	for i, c := range cases {
+		thread := &starlark.Thread{}
+		_, err := starlark.ExecFile(thread, "raised.star", c.script, predeclared)
+		te, ok := newTransformError(thread, "", err).(*TransformError)
+		if !ok {
+			t.Fatalf("case %d expected a *TransformError, got: %#v", i, err)
+		}
+		if te.Raised != c.raised {
+			t.Errorf("case %d raised mismatch. expected: %t, got: %t", i, c.raised, te.Raised)
+		}
+	}
+}
@@ -0,0 +1,413 @@
+// Package fetch provides http helpers for download functions: paginated requests,
+// retries with exponential backoff, per-host rate limits and conditional requests
+package fetch
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/qri-io/starlib/util"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// ModuleName defines the expected name for this module when used
+// in starlark's load() function, eg: load('fetch.star', 'fetch')
+const ModuleName = "fetch.star"
+
+// RequestGuard controls access to http by checking before making requests.
+// if Allowed returns an error the request will be denied
+type RequestGuard interface {
+	Allowed(req *http.Request) error
+}
+
+// Module encapsulates state for a fetch starlark module
+type Module struct {
+	// Client performs http requests, defaults to http.DefaultClient
+	Client *http.Client
+	// Guard is checked before every request, including retries
+	Guard RequestGuard
+	// Retries is the default number of times a failed request will be retried
+	Retries int
+	// Backoff is the delay before the first retry, doubling with each attempt
+	Backoff time.Duration
+	// MaxRetryWait caps the delay before a retry, including delays requested by a
+	// Retry-After header. zero means no cap
+	MaxRetryWait time.Duration
+
+	lock       sync.Mutex
+	limits     map[string]*limiter
+	validators map[string]*validator
+}
+
+// NewModule creates a new fetch module instance
+func NewModule(cli *http.Client, guard RequestGuard) *Module {
+	if cli == nil {
+		cli = http.DefaultClient
+	}
+	return &Module{
+		Client:       cli,
+		Guard:        guard,
+		Retries:      3,
+		Backoff:      500 * time.Millisecond,
+		MaxRetryWait: 30 * time.Second,
+		limits:       map[string]*limiter{},
+		validators:   map[string]*validator{},
+	}
+}
+
+// Namespace produces this module's exported namespace
+func (m *Module) Namespace() starlark.StringDict {
+	return starlark.StringDict{
+		"fetch": m.Struct(),
+	}
+}
+
+// Struct returns this module's methods as a starlark Struct
+func (m *Module) Struct() *starlarkstruct.Struct {
+	return starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"get":        starlark.NewBuiltin("get", m.Get),
+		"paginate":   starlark.NewBuiltin("paginate", m.Paginate),
+		"rate_limit": starlark.NewBuiltin("rate_limit", m.RateLimit),
+	})
+}
+
+// SetRateLimit caps requests to host at perSecond requests per second. a value
+// of zero removes the limit. limits apply to a host name on any port
+func (m *Module) SetRateLimit(host string, perSecond float64) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if perSecond <= 0 {
+		delete(m.limits, host)
+		return
+	}
+	m.limits[host] = &limiter{interval: time.Duration(float64(time.Second) / perSecond)}
+}
+
+// Get performs a GET request
+func (m *Module) Get(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		urlstr  string
+		params  = &starlark.Dict{}
+		headers = &starlark.Dict{}
+		retries = m.Retries
+	)
+	if err := starlark.UnpackArgs("get", args, kwargs, "url", &urlstr, "params?", &params, "headers?", &headers, "retries?", &retries); err != nil {
+		return starlark.None, err
+	}
+
+	req, err := newRequest(urlstr, params, headers)
+	if err != nil {
+		return starlark.None, err
+	}
+	res, err := m.do(req, retries)
+	if err != nil {
+		return starlark.None, err
+	}
+	return res.Struct(), nil
+}
+
+// Paginate performs a sequence of GET requests, starting with url. After each response
+// the next function is called with the response and must return the url of the next
+// page, or None to stop. Paginate returns a list of all responses
+func (m *Module) Paginate(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		urlstr   string
+		next     starlark.Callable
+		headers  = &starlark.Dict{}
+		retries  = m.Retries
+		maxPages = 100
+	)
+	if err := starlark.UnpackArgs("paginate", args, kwargs, "url", &urlstr, "next", &next, "headers?", &headers, "retries?", &retries, "max_pages?", &maxPages); err != nil {
+		return starlark.None, err
+	}
+
+	pages := &starlark.List{}
+	for urlstr != "" {
+		if pages.Len() >= maxPages {
+			return starlark.None, fmt.Errorf("paginate: exceeded max_pages (%d)", maxPages)
+		}
+
+		req, err := newRequest(urlstr, nil, headers)
+		if err != nil {
+			return starlark.None, err
+		}
+		res, err := m.do(req, retries)
+		if err != nil {
+			return starlark.None, err
+		}
+		page := res.Struct()
+		pages.Append(page)
+
+		v, err := starlark.Call(thread, next, starlark.Tuple{page}, nil)
+		if err != nil {
+			return starlark.None, err
+		}
+		switch x := v.(type) {
+		case starlark.NoneType:
+			urlstr = ""
+		case starlark.String:
+			urlstr = string(x)
+		default:
+			return starlark.None, fmt.Errorf("paginate: next must return a url string or None, got %s", v.Type())
+		}
+	}
+
+	return pages, nil
+}
+
+// RateLimit sets the maximum number of requests per second for a host
+func (m *Module) RateLimit(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		host      string
+		perSecond starlark.Value
+	)
+	if err := starlark.UnpackArgs("rate_limit", args, kwargs, "host", &host, "per_second", &perSecond); err != nil {
+		return starlark.None, err
+	}
+	rate, ok := starlark.AsFloat(perSecond)
+	if !ok {
+		return starlark.None, fmt.Errorf("rate_limit: per_second must be a number")
+	}
+	m.SetRateLimit(host, rate)
+	return starlark.None, nil
+}
+
+func newRequest(urlstr string, params, headers *starlark.Dict) (*http.Request, error) {
+	u, err := url.Parse(urlstr)
+	if err != nil {
+		return nil, err
+	}
+	if params != nil && params.Len() > 0 {
+		q := u.Query()
+		for _, kv := range params.Items() {
+			k, ok := starlark.AsString(kv[0])
+			if !ok {
+				return nil, fmt.Errorf("param keys must be strings")
+			}
+			v, ok := starlark.AsString(kv[1])
+			if !ok {
+				v = kv[1].String()
+			}
+			q.Set(k, v)
+		}
+		u.RawQuery = q.Encode()
+	}
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if headers == nil {
+		return req, nil
+	}
+	for _, kv := range headers.Items() {
+		k, ok := starlark.AsString(kv[0])
+		if !ok {
+			return nil, fmt.Errorf("header keys must be strings")
+		}
+		v, ok := starlark.AsString(kv[1])
+		if !ok {
+			return nil, fmt.Errorf("header '%s' value must be a string", k)
+		}
+		req.Header.Set(k, v)
+	}
+	return req, nil
+}
+
+// do performs a request, waiting on rate limits, adding conditional request headers
+// and retrying with exponential backoff on network errors, 429 and 5xx responses
+func (m *Module) do(req *http.Request, retries int) (*Response, error) {
+	key := req.URL.String()
+	if v := m.validator(key); v != nil {
+		if v.etag != "" {
+			req.Header.Set("If-None-Match", v.etag)
+		}
+		if v.lastModified != "" {
+			req.Header.Set("If-Modified-Since", v.lastModified)
+		}
+	}
+
+	delay := m.Backoff
+	for attempt := 0; ; attempt++ {
+		if m.Guard != nil {
+			if err := m.Guard.Allowed(req); err != nil {
+				return nil, err
+			}
+		}
+		m.wait(req.URL.Hostname())
+
+		res, err := m.Client.Do(req)
+		if err == nil && !retryable(res.StatusCode) {
+			return m.readResponse(key, res)
+		}
+		if attempt >= retries {
+			if err != nil {
+				return nil, err
+			}
+			return m.readResponse(key, res)
+		}
+
+		wait := delay
+		if err == nil {
+			if ra, ok := retryAfter(res.Header.Get("Retry-After"), time.Now()); ok {
+				wait = ra
+			}
+			res.Body.Close()
+		}
+		if m.MaxRetryWait > 0 && wait > m.MaxRetryWait {
+			wait = m.MaxRetryWait
+		}
+		time.Sleep(wait)
+		delay *= 2
+	}
+}
+
+// retryAfter parses a Retry-After header, which is either a number of seconds or
+// an http date
+func retryAfter(header string, now time.Time) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(header); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+	t, err := http.ParseTime(header)
+	if err != nil {
+		return 0, false
+	}
+	if d := t.Sub(now); d > 0 {
+		return d, true
+	}
+	return 0, true
+}
+
+func retryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+func (m *Module) readResponse(key string, res *http.Response) (*Response, error) {
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Response{
+		URL:        res.Request.URL.String(),
+		StatusCode: res.StatusCode,
+		Header:     res.Header,
+		Body:       body,
+	}
+
+	if res.StatusCode == http.StatusNotModified {
+		if v := m.validator(key); v != nil {
+			r.StatusCode = v.res.StatusCode
+			r.Header = v.res.Header
+			r.Body = v.res.Body
+			r.NotModified = true
+		}
+		return r, nil
+	}
+
+	if res.StatusCode == http.StatusOK {
+		etag, lastMod := res.Header.Get("ETag"), res.Header.Get("Last-Modified")
+		if etag != "" || lastMod != "" {
+			m.lock.Lock()
+			m.validators[key] = &validator{etag: etag, lastModified: lastMod, res: r}
+			m.lock.Unlock()
+		}
+	}
+	return r, nil
+}
+
+func (m *Module) validator(key string) *validator {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.validators[key]
+}
+
+// wait blocks until a request to host is permitted by its rate limit
+func (m *Module) wait(host string) {
+	m.lock.Lock()
+	l, ok := m.limits[host]
+	m.lock.Unlock()
+	if ok {
+		l.wait()
+	}
+}
+
+// validator holds the details required to make a conditional request for
+// a previously-fetched url
+type validator struct {
+	etag         string
+	lastModified string
+	res          *Response
+}
+
+// limiter spaces calls to wait by a minimum interval
+type limiter struct {
+	lock     sync.Mutex
+	interval time.Duration
+	last     time.Time
+}
+
+func (l *limiter) wait() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if d := l.interval - time.Since(l.last); d > 0 {
+		time.Sleep(d)
+	}
+	l.last = time.Now()
+}
+
+// Response is the result of a fetch request
+type Response struct {
+	URL         string
+	StatusCode  int
+	Header      http.Header
+	Body        []byte
+	NotModified bool // response body was served from a previous response after a 304
+}
+
+// Struct exposes a response as a starlark struct
+func (r *Response) Struct() *starlarkstruct.Struct {
+	headers := &starlark.Dict{}
+	for k := range r.Header {
+		headers.SetKey(starlark.String(k), starlark.String(r.Header.Get(k)))
+	}
+
+	return starlarkstruct.FromStringDict(starlark.String("response"), starlark.StringDict{
+		"url":          starlark.String(r.URL),
+		"status_code":  starlark.MakeInt(r.StatusCode),
+		"headers":      headers,
+		"not_modified": starlark.Bool(r.NotModified),
+		"text":         starlark.NewBuiltin("text", r.text),
+		"json":         starlark.NewBuiltin("json", r.json),
+	})
+}
+
+func (r *Response) text(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	return starlark.String(r.Body), nil
+}
+
+func (r *Response) json(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var data interface{}
+	if err := json.Unmarshal(r.Body, &data); err != nil {
+		return starlark.None, err
+	}
+	return util.Marshal(data)
+}
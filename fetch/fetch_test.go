@@ -0,0 +1,216 @@
+package fetch
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.starlark.net/resolve"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarktest"
+)
+
+func TestFile(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var page int
+		fmt.Sscanf(r.URL.Path, "/pages/%d", &page)
+		next := "null"
+		if page < 3 {
+			next = fmt.Sprintf(`"http://%s/pages/%d"`, r.Host, page+1)
+		}
+		w.Write([]byte(fmt.Sprintf(`{"page":%d,"next":%s,"query":"%s"}`, page, next, r.URL.RawQuery)))
+	}))
+	defer s.Close()
+
+	resolve.AllowLambda = true
+	mod := NewModule(nil, nil)
+	thread := &starlark.Thread{Load: newLoader(mod)}
+	starlarktest.SetReporter(thread, t)
+
+	_, err := starlark.ExecFile(thread, "testdata/test.star", nil, starlark.StringDict{
+		"server_url": starlark.String(s.URL),
+	})
+	if err != nil {
+		if ee, ok := err.(*starlark.EvalError); ok {
+			t.Error(ee.Backtrace())
+		} else {
+			t.Error(err)
+		}
+	}
+}
+
+func TestRetries(t *testing.T) {
+	calls := 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer s.Close()
+
+	mod := NewModule(nil, nil)
+	mod.Backoff = time.Millisecond
+	req, _ := http.NewRequest("GET", s.URL, nil)
+
+	res, err := mod.do(req, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected retries to be exhausted with status 503, got: %d", res.StatusCode)
+	}
+
+	res, err = mod.do(req, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK || string(res.Body) != "ok" {
+		t.Errorf("expected successful response after retry, got: %d %s", res.StatusCode, string(res.Body))
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 calls, got: %d", calls)
+	}
+}
+
+type denyGuard struct{}
+
+func (denyGuard) Allowed(req *http.Request) error {
+	return fmt.Errorf("denied")
+}
+
+func TestGuard(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("guarded request should not reach server")
+	}))
+	defer s.Close()
+
+	mod := NewModule(nil, denyGuard{})
+	req, _ := http.NewRequest("GET", s.URL, nil)
+	if _, err := mod.do(req, 3); err == nil || err.Error() != "denied" {
+		t.Errorf("expected guard error, got: %v", err)
+	}
+}
+
+func TestConditionalRequests(t *testing.T) {
+	fresh := 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fresh++
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("body"))
+	}))
+	defer s.Close()
+
+	mod := NewModule(nil, nil)
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("GET", s.URL, nil)
+		res, err := mod.do(req, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(res.Body) != "body" {
+			t.Errorf("request %d body mismatch. expected: 'body', got: '%s'", i, string(res.Body))
+		}
+		if res.NotModified != (i == 1) {
+			t.Errorf("request %d not_modified mismatch. expected: %t", i, i == 1)
+		}
+	}
+	if fresh != 1 {
+		t.Errorf("expected 1 full response, got: %d", fresh)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer s.Close()
+
+	mod := NewModule(nil, nil)
+	// limits are keyed by host name, so a limit set with a port applies to any port
+	mod.SetRateLimit(strings.TrimPrefix(s.URL, "http://"), 20)
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		req, _ := http.NewRequest("GET", s.URL, nil)
+		if _, err := mod.do(req, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("expected rate limit to space requests by 50ms, 3 requests took %s", elapsed)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2019, 7, 2, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		header string
+		wait   time.Duration
+		ok     bool
+	}{
+		{"", 0, false},
+		{"120", 2 * time.Minute, true},
+		{"-1", 0, false},
+		{"Tue, 02 Jul 2019 12:01:30 GMT", 90 * time.Second, true},
+		{"Tue, 02 Jul 2019 11:00:00 GMT", 0, true},
+		{"soon", 0, false},
+	}
+	for i, c := range cases {
+		wait, ok := retryAfter(c.header, now)
+		if wait != c.wait || ok != c.ok {
+			t.Errorf("case %d %q mismatch. expected: %s %t, got: %s %t", i, c.header, c.wait, c.ok, wait, ok)
+		}
+	}
+}
+
+func TestMaxRetryWait(t *testing.T) {
+	calls := 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer s.Close()
+
+	mod := NewModule(nil, nil)
+	mod.MaxRetryWait = 10 * time.Millisecond
+	req, _ := http.NewRequest("GET", s.URL, nil)
+
+	start := time.Now()
+	res, err := mod.do(req, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("expected a successful retry, got: %d", res.StatusCode)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected Retry-After to be capped by MaxRetryWait, retry took %s", elapsed)
+	}
+}
+
+// load implements the 'load' operation as used in the evaluator tests.
+func newLoader(mod *Module) func(thread *starlark.Thread, module string) (starlark.StringDict, error) {
+	return func(thread *starlark.Thread, module string) (starlark.StringDict, error) {
+		switch module {
+		case ModuleName:
+			return mod.Namespace(), nil
+		case "assert.star":
+			return starlarktest.LoadAssertModule()
+		}
+
+		return nil, fmt.Errorf("invalid module")
+	}
+}
@@ -0,0 +1,345 @@
+// Package golden compares the output of transform scripts to checked-in golden
+// files. Set Case.Update to regenerate golden files, usually from a test's own
+// -update flag
+package golden
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/qri-io/dataset"
+	"github.com/qri-io/dataset/dsio"
+	"github.com/qri-io/qfs"
+	"github.com/qri-io/startf"
+)
+
+// TB is the subset of testing.TB used by Check
+type TB interface {
+	Errorf(format string, args ...interface{})
+	Fatalf(format string, args ...interface{})
+	Helper()
+}
+
+// Case is a transform script run against fixture inputs
+type Case struct {
+	// Name of the case, golden files are named after the case
+	Name string
+	// Script is the path to the transform script
+	Script string
+	// Prev is the previous version of the dataset, may be nil
+	Prev *dataset.Dataset
+	// Config is the transform configuration
+	Config map[string]interface{}
+	// Opts are passed to ExecScript
+	Opts []func(o *startf.ExecOpts)
+	// Update writes golden files instead of comparing against them
+	Update bool
+}
+
+// Run executes the case's transform script, returning the resulting dataset
+func (c Case) Run() (*dataset.Dataset, error) {
+	script, err := ioutil.ReadFile(c.Script)
+	if err != nil {
+		return nil, err
+	}
+
+	ds := &dataset.Dataset{
+		Transform: &dataset.Transform{Config: c.Config},
+	}
+	ds.Transform.SetScriptFile(qfs.NewMemfileBytes(filepath.Base(c.Script), script))
+	if err := startf.ExecScript(ds, c.Prev, c.Opts...); err != nil {
+		return nil, err
+	}
+	return ds, nil
+}
+
+// Check runs a case and compares the resulting meta, structure and body to golden
+// files in dir, failing the test on mismatch. When c.Update is set golden files
+// are written instead
+func Check(t TB, dir string, c Case) {
+	t.Helper()
+	ds, err := c.Run()
+	if err != nil {
+		t.Fatalf("%s: running transform: %s", c.Name, err)
+		return
+	}
+
+	diffs, err := Compare(dir, c.Name, ds, c.Update)
+	if err != nil {
+		t.Fatalf("%s: %s", c.Name, err)
+		return
+	}
+	for _, d := range diffs {
+		t.Errorf("%s: %s", c.Name, d)
+	}
+}
+
+// Snapshot is the comparable output of a transform
+type Snapshot struct {
+	Meta      interface{}
+	Structure interface{}
+	Body      interface{}
+}
+
+// NewSnapshot creates a snapshot from a dataset, reading the dataset body
+func NewSnapshot(ds *dataset.Dataset) (*Snapshot, error) {
+	s := &Snapshot{}
+	var err error
+	if s.Meta, err = normalize(ds.Meta); err != nil {
+		return nil, err
+	}
+	if s.Structure, err = normalize(ds.Structure); err != nil {
+		return nil, err
+	}
+
+	if ds.BodyFile() != nil && ds.Structure != nil {
+		data, err := ioutil.ReadAll(ds.BodyFile())
+		if err != nil {
+			return nil, err
+		}
+		// replace the consumed body file
+		ds.SetBodyFile(qfs.NewMemfileBytes(ds.BodyFile().FileName(), data))
+
+		r, err := dsio.NewEntryReader(ds.Structure, bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		body, err := readBody(r)
+		if err != nil {
+			return nil, err
+		}
+		if s.Body, err = normalize(body); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+func readBody(r dsio.EntryReader) (interface{}, error) {
+	tlt, err := dsio.GetTopLevelType(r.Structure())
+	if err != nil {
+		return nil, err
+	}
+
+	if tlt == "object" {
+		obj := map[string]interface{}{}
+		err = dsio.EachEntry(r, func(_ int, ent dsio.Entry, err error) error {
+			if err != nil {
+				return err
+			}
+			obj[ent.Key] = ent.Value
+			return nil
+		})
+		return obj, err
+	}
+
+	arr := []interface{}{}
+	err = dsio.EachEntry(r, func(_ int, ent dsio.Entry, err error) error {
+		if err != nil {
+			return err
+		}
+		arr = append(arr, ent.Value)
+		return nil
+	})
+	return arr, err
+}
+
+// normalize round-trips a value through json so values compare the same
+// regardless of their original go types
+func normalize(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var n interface{}
+	err = json.Unmarshal(data, &n)
+	return n, err
+}
+
+// Compare checks a dataset against golden files named for name in dir, returning
+// a human-readable description of each difference. If update is true golden files
+// are written from ds instead
+func Compare(dir, name string, ds *dataset.Dataset, update bool) ([]string, error) {
+	actual, err := NewSnapshot(ds)
+	if err != nil {
+		return nil, err
+	}
+
+	components := []struct {
+		name string
+		val  interface{}
+	}{
+		{"meta", actual.Meta},
+		{"structure", actual.Structure},
+		{"body", actual.Body},
+	}
+
+	if update {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return nil, err
+		}
+		for _, c := range components {
+			if err := writeGolden(filepath.Join(dir, goldenName(name, c.name)), c.name, c.val); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+	}
+
+	var diffs []string
+	for _, c := range components {
+		path := filepath.Join(dir, goldenName(name, c.name))
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, fmt.Errorf("missing golden file %s, run with -update to create it", path)
+			}
+			return nil, err
+		}
+		var expect interface{}
+		if err := json.Unmarshal(data, &expect); err != nil {
+			return nil, fmt.Errorf("reading golden file %s: %s", path, err)
+		}
+
+		if c.name == "body" {
+			diffs = append(diffs, diffBody(expect, c.val)...)
+		} else {
+			diffs = append(diffs, diffFields(c.name, expect, c.val)...)
+		}
+	}
+	return diffs, nil
+}
+
+func goldenName(name, component string) string {
+	return fmt.Sprintf("%s.%s.json", name, component)
+}
+
+// writeGolden writes a golden file. body arrays are written one row per line
+// to keep golden file diffs in code review readable
+func writeGolden(path, component string, v interface{}) error {
+	var (
+		data []byte
+		err  error
+	)
+	if rows, ok := v.([]interface{}); ok && component == "body" {
+		buf := &bytes.Buffer{}
+		buf.WriteString("[")
+		for i, row := range rows {
+			if i > 0 {
+				buf.WriteString(",")
+			}
+			rd, err := json.Marshal(row)
+			if err != nil {
+				return err
+			}
+			buf.WriteString("\n  ")
+			buf.Write(rd)
+		}
+		if len(rows) > 0 {
+			buf.WriteString("\n")
+		}
+		buf.WriteString("]")
+		data = buf.Bytes()
+	} else if data, err = json.MarshalIndent(v, "", "  "); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// diffBody compares bodies row-by-row for arrays & key-by-key for objects
+func diffBody(expect, actual interface{}) (diffs []string) {
+	switch e := expect.(type) {
+	case []interface{}:
+		a, ok := actual.([]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("body: expected an array, got %s", compact(actual))}
+		}
+		for i := 0; i < len(e) || i < len(a); i++ {
+			switch {
+			case i >= len(a):
+				diffs = append(diffs, fmt.Sprintf("body row %d:\n  - %s", i, compact(e[i])))
+			case i >= len(e):
+				diffs = append(diffs, fmt.Sprintf("body row %d:\n  + %s", i, compact(a[i])))
+			case compact(e[i]) != compact(a[i]):
+				diffs = append(diffs, fmt.Sprintf("body row %d:\n  - %s\n  + %s", i, compact(e[i]), compact(a[i])))
+			}
+		}
+		if len(e) != len(a) {
+			diffs = append(diffs, fmt.Sprintf("body: expected %d rows, got %d", len(e), len(a)))
+		}
+	case map[string]interface{}:
+		a, ok := actual.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("body: expected an object, got %s", compact(actual))}
+		}
+		for _, key := range unionKeys(e, a) {
+			diffs = append(diffs, diffValue(fmt.Sprintf("body key %q", key), e, a, key)...)
+		}
+	default:
+		if compact(expect) != compact(actual) {
+			diffs = append(diffs, fmt.Sprintf("body:\n  - %s\n  + %s", compact(expect), compact(actual)))
+		}
+	}
+	return diffs
+}
+
+// diffFields compares two components field-by-field
+func diffFields(component string, expect, actual interface{}) (diffs []string) {
+	e, eok := expect.(map[string]interface{})
+	a, aok := actual.(map[string]interface{})
+	if !eok || !aok {
+		if compact(expect) != compact(actual) {
+			return []string{fmt.Sprintf("%s:\n  - %s\n  + %s", component, compact(expect), compact(actual))}
+		}
+		return nil
+	}
+	for _, key := range unionKeys(e, a) {
+		diffs = append(diffs, diffValue(fmt.Sprintf("%s.%s", component, key), e, a, key)...)
+	}
+	return diffs
+}
+
+func diffValue(label string, expect, actual map[string]interface{}, key string) []string {
+	ev, eok := expect[key]
+	av, aok := actual[key]
+	switch {
+	case !aok:
+		return []string{fmt.Sprintf("%s:\n  - %s", label, compact(ev))}
+	case !eok:
+		return []string{fmt.Sprintf("%s:\n  + %s", label, compact(av))}
+	case compact(ev) != compact(av):
+		return []string{fmt.Sprintf("%s:\n  - %s\n  + %s", label, compact(ev), compact(av))}
+	}
+	return nil
+}
+
+func unionKeys(a, b map[string]interface{}) []string {
+	set := map[string]bool{}
+	for k := range a {
+		set[k] = true
+	}
+	for k := range b {
+		set[k] = true
+	}
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// compact encodes a value as single-line json
+func compact(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(data)
+}
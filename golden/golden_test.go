@@ -0,0 +1,97 @@
+package golden
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/qri-io/dataset"
+	"github.com/qri-io/qfs"
+	"github.com/qri-io/startf"
+)
+
+var update = flag.Bool("update", false, "update golden files instead of comparing against them")
+
+func TestCheck(t *testing.T) {
+	prev, err := startf.LoadDatasetFile("testdata/prev.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Check(t, "testdata/golden", Case{
+		Name:   "doubled",
+		Script: "testdata/transform.star",
+		Prev:   prev,
+		Config: map[string]interface{}{"name": "numbers"},
+		Update: *update,
+	})
+}
+
+func TestCompareUpdate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "golden_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ds := &dataset.Dataset{
+		Meta:      &dataset.Meta{Title: "a"},
+		Structure: &dataset.Structure{Format: "json", Schema: dataset.BaseSchemaArray},
+	}
+	ds.SetBodyFile(qfs.NewMemfileBytes("body.json", []byte(`[1,2,3]`)))
+
+	if _, err := Compare(dir, "case", ds, false); err == nil || !strings.Contains(err.Error(), "run with -update") {
+		t.Errorf("expected missing golden file error, got: %v", err)
+	}
+
+	if _, err := Compare(dir, "case", ds, true); err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadFile(dir + "/case.body.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "[\n  1,\n  2,\n  3\n]\n" {
+		t.Errorf("expected body golden file to have one row per line, got:\n%s", string(body))
+	}
+
+	diffs, err := Compare(dir, "case", ds, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("expected no differences, got: %v", diffs)
+	}
+
+	ds.Meta.Title = "b"
+	ds.SetBodyFile(qfs.NewMemfileBytes("body.json", []byte(`[1,5]`)))
+	diffs, err = Compare(dir, "case", ds, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{
+		"meta.title:\n  - \"a\"\n  + \"b\"",
+		"body row 1:\n  - 2\n  + 5",
+		"body row 2:\n  - 3",
+		"body: expected 3 rows, got 2",
+	}
+	if fmt.Sprintf("%q", diffs) != fmt.Sprintf("%q", expect) {
+		t.Errorf("diff mismatch.\nexpected: %q\ngot:      %q", expect, diffs)
+	}
+}
+
+func TestDiffBodyObject(t *testing.T) {
+	expect := map[string]interface{}{"a": 1.0, "b": 2.0}
+	actual := map[string]interface{}{"a": 1.0, "c": 3.0}
+	got := diffBody(expect, actual)
+	want := []string{
+		"body key \"b\":\n  - 2",
+		"body key \"c\":\n  + 3",
+	}
+	if fmt.Sprintf("%q", got) != fmt.Sprintf("%q", want) {
+		t.Errorf("diff mismatch.\nexpected: %q\ngot:      %q", want, got)
+	}
+}
@@ -0,0 +1,305 @@
+// Package httpcache implements an on-disk cache of http responses, intended to
+// speed up repeated transform runs during development
+package httpcache
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrOffline is returned for requests that miss the cache when the cache is offline
+var ErrOffline = fmt.Errorf("httpcache: request is not cached and the cache is offline")
+
+// Cache stores http responses as files in a directory. Responses are keyed by
+// request method, url, headers and body
+type Cache struct {
+	// Dir is the directory cached responses are written to
+	Dir string
+	// Offline serves all requests from the cache regardless of freshness, failing
+	// any request that isn't cached with ErrOffline
+	Offline bool
+	// DefaultTTL is how long responses without explicit freshness information
+	// (Cache-Control max-age or Expires headers) are considered fresh. with a
+	// zero DefaultTTL those responses are revalidated on every request
+	DefaultTTL time.Duration
+}
+
+// defaultTTL keeps responses without freshness information for long enough that
+// repeated runs while developing a script are served from the cache
+const defaultTTL = time.Hour
+
+// NewCache creates a cache that writes to dir. responses without freshness
+// information are fresh for an hour
+func NewCache(dir string) *Cache {
+	return &Cache{Dir: dir, DefaultTTL: defaultTTL}
+}
+
+// entry is a cached response
+type entry struct {
+	res    *http.Response
+	body   []byte
+	stored time.Time
+}
+
+// Key calculates the cache key for a request. Key consumes & replaces the
+// request body
+func Key(req *http.Request) (string, error) {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n", req.Method, req.URL.String())
+
+	names := make([]string, 0, len(req.Header))
+	for name := range req.Header {
+		// conditional headers are added by the cache itself
+		if name == "If-None-Match" || name == "If-Modified-Since" {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(h, "%s: %s\n", name, strings.Join(req.Header[name], ","))
+	}
+
+	if req.Body != nil {
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return "", err
+		}
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		h.Write(body)
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.Dir, key)
+}
+
+// get reads a cached entry, returning nil if no entry exists
+func (c *Cache) get(key string, req *http.Request) (*entry, error) {
+	f, err := os.Open(c.path(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := http.ReadResponse(bufio.NewReader(f), req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+
+	return &entry{res: res, body: body, stored: fi.ModTime()}, nil
+}
+
+// put writes a response to the cache. DumpResponse replaces the consumed response
+// body, so it can still be read by the caller
+func (c *Cache) put(key string, res *http.Response) error {
+	if err := os.MkdirAll(c.Dir, os.ModePerm); err != nil {
+		return err
+	}
+	data, err := httputil.DumpResponse(res, true)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(c.path(key), data, 0644)
+}
+
+// touch marks a cached entry as freshly stored
+func (c *Cache) touch(key string) error {
+	now := time.Now()
+	return os.Chtimes(c.path(key), now, now)
+}
+
+// fresh reports whether a cached entry can be used without contacting the server
+func (c *Cache) fresh(e *entry) bool {
+	cc := cacheControl(e.res.Header)
+	if _, ok := cc["no-cache"]; ok {
+		return false
+	}
+
+	age := time.Since(e.stored)
+	if v, ok := cc["max-age"]; ok {
+		if secs, err := strconv.Atoi(v); err == nil {
+			return age < time.Duration(secs)*time.Second
+		}
+	}
+	if exp := e.res.Header.Get("Expires"); exp != "" {
+		t, err := http.ParseTime(exp)
+		return err == nil && time.Now().Before(t)
+	}
+	return age < c.DefaultTTL
+}
+
+// storable reports whether a response may be written to the cache
+func storable(res *http.Response) bool {
+	if res.StatusCode != http.StatusOK {
+		return false
+	}
+	_, noStore := cacheControl(res.Header)["no-store"]
+	return !noStore
+}
+
+func cacheControl(h http.Header) map[string]string {
+	cc := map[string]string{}
+	for _, part := range strings.Split(h.Get("Cache-Control"), ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if i := strings.Index(part, "="); i > 0 {
+			cc[strings.ToLower(part[:i])] = strings.Trim(part[i+1:], `"`)
+		} else {
+			cc[strings.ToLower(part)] = ""
+		}
+	}
+	return cc
+}
+
+// Transport is an http.RoundTripper that serves responses from a Cache when
+// possible, falling back to Base. A Transport with a nil Cache passes all
+// requests to Base
+type Transport struct {
+	Cache *Cache
+	Base  http.RoundTripper
+	// Log receives errors reading & writing the cache, which don't fail requests.
+	// errors are discarded if Log is nil
+	Log io.Writer
+}
+
+var _ http.RoundTripper = (*Transport)(nil)
+
+// RoundTrip implements the http.RoundTripper interface
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if t.Cache == nil {
+		return base.RoundTrip(req)
+	}
+
+	// shallow copy the request, RoundTrippers should not modify requests
+	r := new(http.Request)
+	*r = *req
+	r.Header = make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		r.Header[k] = v
+	}
+
+	key, err := Key(r)
+	if err != nil {
+		return nil, err
+	}
+	e, err := t.Cache.get(key, r)
+	if err != nil {
+		if t.Cache.Offline {
+			return nil, err
+		}
+		// an unreadable entry is a cache miss
+		t.logf("httpcache: reading response for %s: %s\n", req.URL, err)
+	}
+
+	if e != nil && (t.Cache.Offline || t.Cache.fresh(e)) {
+		return e.response(), nil
+	}
+	if t.Cache.Offline {
+		return nil, ErrOffline
+	}
+
+	if e != nil {
+		if etag := e.res.Header.Get("ETag"); etag != "" {
+			r.Header.Set("If-None-Match", etag)
+		}
+		if lastMod := e.res.Header.Get("Last-Modified"); lastMod != "" {
+			r.Header.Set("If-Modified-Since", lastMod)
+		}
+	}
+
+	res, err := base.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode == http.StatusNotModified && e != nil {
+		res.Body.Close()
+		if err := t.Cache.touch(key); err != nil {
+			t.logf("httpcache: refreshing response for %s: %s\n", req.URL, err)
+		}
+		return e.response(), nil
+	}
+
+	if storable(res) {
+		// a response that can't be cached is still a successful response
+		if err := t.Cache.put(key, res); err != nil {
+			t.logf("httpcache: writing response for %s: %s\n", req.URL, err)
+		}
+	}
+
+	return res, nil
+}
+
+func (t *Transport) logf(format string, args ...interface{}) {
+	if t.Log != nil {
+		fmt.Fprintf(t.Log, format, args...)
+	}
+}
+
+// response creates a readable response from a cache entry
+func (e *entry) response() *http.Response {
+	res := new(http.Response)
+	*res = *e.res
+	res.Header = make(http.Header, len(e.res.Header))
+	for k, v := range e.res.Header {
+		res.Header[k] = v
+	}
+	res.Body = ioutil.NopCloser(bytes.NewReader(e.body))
+	res.ContentLength = int64(len(e.body))
+	res.TransferEncoding = nil
+	res.Header.Set("X-From-Cache", "1")
+	return res
+}
+
+// Clear removes all cached responses
+func (c *Cache) Clear() error {
+	infos, err := ioutil.ReadDir(c.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, fi := range infos {
+		if err := os.Remove(filepath.Join(c.Dir, fi.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package httpcache
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func tempCache(t *testing.T) (*Cache, func()) {
+	dir, err := ioutil.TempDir("", "httpcache_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewCache(dir), func() { os.RemoveAll(dir) }
+}
+
+func get(t *testing.T, cli *http.Client, url string) (string, bool) {
+	res, err := cli.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data), res.Header.Get("X-From-Cache") == "1"
+}
+
+func TestTransport(t *testing.T) {
+	calls := 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch r.URL.Path {
+		case "/max-age":
+			w.Header().Set("Cache-Control", "max-age=60")
+		case "/no-store":
+			w.Header().Set("Cache-Control", "no-store")
+		case "/etag":
+			if r.Header.Get("If-None-Match") == `"abc"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"abc"`)
+		}
+		w.Write([]byte("hello " + r.URL.Path))
+	}))
+	defer s.Close()
+
+	cache, cleanup := tempCache(t)
+	defer cleanup()
+	// revalidate responses without freshness headers
+	cache.DefaultTTL = 0
+	cli := &http.Client{Transport: &Transport{Cache: cache}}
+
+	cases := []struct {
+		path      string
+		fromCache []bool
+		calls     int
+	}{
+		{"/max-age", []bool{false, true, true}, 1},
+		{"/no-store", []bool{false, false}, 2},
+		{"/etag", []bool{false, true}, 2},
+		{"/plain", []bool{false, false}, 2},
+	}
+
+	for _, c := range cases {
+		calls = 0
+		for i, expect := range c.fromCache {
+			body, cached := get(t, cli, s.URL+c.path)
+			if body != "hello "+c.path {
+				t.Errorf("%s request %d body mismatch. got: %s", c.path, i, body)
+			}
+			if cached != expect {
+				t.Errorf("%s request %d from cache mismatch. expected: %t, got: %t", c.path, i, expect, cached)
+			}
+		}
+		if calls != c.calls {
+			t.Errorf("%s server calls mismatch. expected: %d, got: %d", c.path, c.calls, calls)
+		}
+	}
+
+	cache.DefaultTTL = time.Minute
+	calls = 0
+	get(t, cli, s.URL+"/plain")
+	if _, cached := get(t, cli, s.URL+"/plain"); !cached {
+		t.Errorf("expected default ttl to serve response from cache")
+	}
+	if calls != 0 {
+		t.Errorf("expected response cached by previous request to be used, got %d server calls", calls)
+	}
+}
+
+func TestDefaultTTL(t *testing.T) {
+	calls := 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Write([]byte("ok"))
+	}))
+	defer s.Close()
+
+	cache, cleanup := tempCache(t)
+	defer cleanup()
+	cli := &http.Client{Transport: &Transport{Cache: cache}}
+
+	get(t, cli, s.URL)
+	if _, cached := get(t, cli, s.URL); !cached || calls != 1 {
+		t.Errorf("expected a new cache to serve responses without cache headers, got %d server calls", calls)
+	}
+}
+
+func TestPutError(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer s.Close()
+
+	dir, err := ioutil.TempDir("", "httpcache_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// a file in place of the cache directory makes writes fail
+	path := dir + "/file"
+	if err := ioutil.WriteFile(path, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	logs := &bytes.Buffer{}
+	cli := &http.Client{Transport: &Transport{Cache: NewCache(path), Log: logs}}
+
+	if body, cached := get(t, cli, s.URL); body != "ok" || cached {
+		t.Errorf("expected a response when the cache can't be written, got: %q (cached: %t)", body, cached)
+	}
+	if !strings.Contains(logs.String(), "httpcache: writing response for "+s.URL) {
+		t.Errorf("expected the write error to be logged, got: %q", logs.String())
+	}
+}
+
+func TestOffline(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write([]byte("ok"))
+	}))
+	defer s.Close()
+
+	cache, cleanup := tempCache(t)
+	defer cleanup()
+	cli := &http.Client{Transport: &Transport{Cache: cache}}
+
+	get(t, cli, s.URL+"/a")
+	cache.Offline = true
+	if body, cached := get(t, cli, s.URL+"/a"); !cached || body != "ok" {
+		t.Errorf("expected offline cache to serve stale response")
+	}
+
+	_, err := cli.Get(s.URL + "/b")
+	if err == nil || !strings.Contains(err.Error(), ErrOffline.Error()) {
+		t.Errorf("expected offline error, got: %v", err)
+	}
+}
+
+func TestKey(t *testing.T) {
+	a, _ := http.NewRequest("POST", "http://example.com", strings.NewReader("a"))
+	b, _ := http.NewRequest("POST", "http://example.com", strings.NewReader("b"))
+	ka, err := Key(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kb, err := Key(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ka == kb {
+		t.Errorf("expected requests with different bodies to have different keys")
+	}
+
+	data, _ := ioutil.ReadAll(a.Body)
+	if string(data) != "a" {
+		t.Errorf("expected Key to replace request body, got: %s", string(data))
+	}
+
+	c, _ := http.NewRequest("POST", "http://example.com", strings.NewReader("a"))
+	c.Header.Set("If-None-Match", "foo")
+	if kc, _ := Key(c); kc != ka {
+		t.Errorf("expected conditional headers to be ignored when calculating keys")
+	}
+}
@@ -0,0 +1,244 @@
+// Package httpfixture serves canned http responses for testing transform download
+// functions offline. Responses come from either a directory of files or a YAML
+// route table, and the server records which routes were requested
+package httpfixture
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.starlark.net/starlark"
+	"gopkg.in/yaml.v2"
+)
+
+// GlobalName is the name of the starlark global Globals assigns the server url to
+const GlobalName = "test_server_url"
+
+// TB is the subset of testing.TB used for assertions
+type TB interface {
+	Errorf(format string, args ...interface{})
+	Helper()
+}
+
+// Route is a canned response for requests matching a method & path
+type Route struct {
+	// Method to match, defaults to GET
+	Method string `yaml:"method"`
+	// Path to match, eg: /data.json
+	Path string `yaml:"path"`
+	// Status code to respond with, defaults to 200
+	Status int `yaml:"status"`
+	// Headers to set on the response
+	Headers map[string]string `yaml:"headers"`
+	// Body is the response body
+	Body string `yaml:"body"`
+	// File is a path to read the response body from. relative paths are
+	// resolved from the directory of the route table
+	File string `yaml:"file"`
+}
+
+// key returns a route's identifier, eg: "GET /data.json"
+func (r *Route) key() string {
+	return routeKey(r.Method, r.Path)
+}
+
+func routeKey(method, path string) string {
+	if method == "" {
+		method = "GET"
+	}
+	return fmt.Sprintf("%s %s", strings.ToUpper(method), path)
+}
+
+// RouteTable is the YAML document format for describing routes
+type RouteTable struct {
+	Routes []*Route `yaml:"routes"`
+}
+
+// Server is a local http server that responds with canned responses
+type Server struct {
+	URL string
+
+	srv    *httptest.Server
+	routes map[string]*Route
+	lock   sync.Mutex
+	hits   map[string]int
+}
+
+// NewServer starts a server that responds to routes. Requests that don't match a
+// route get a 404 response
+func NewServer(routes []*Route) *Server {
+	s := &Server{
+		routes: map[string]*Route{},
+		hits:   map[string]int{},
+	}
+	for _, r := range routes {
+		s.routes[r.key()] = r
+	}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.srv.URL
+	return s
+}
+
+// NewRouteTableServer starts a server from a YAML route table file
+func NewRouteTableServer(path string) (*Server, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	table := &RouteTable{}
+	if err := yaml.Unmarshal(data, table); err != nil {
+		return nil, fmt.Errorf("parsing route table: %s", err)
+	}
+
+	base := filepath.Dir(path)
+	for _, r := range table.Routes {
+		if r.Path == "" {
+			return nil, fmt.Errorf("route table: route is missing a path")
+		}
+		if r.File == "" {
+			continue
+		}
+		file := r.File
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(base, file)
+		}
+		body, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("route %s: %s", r.key(), err)
+		}
+		r.Body = string(body)
+	}
+
+	return NewServer(table.Routes), nil
+}
+
+// NewDirServer starts a server that responds to GET requests with files in dir,
+// using each file's path relative to dir as the route path
+func NewDirServer(dir string) (*Server, error) {
+	var routes []*Route
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		body, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		routes = append(routes, &Route{
+			Path:    "/" + filepath.ToSlash(rel),
+			Headers: map[string]string{"Content-Type": contentType(path)},
+			Body:    string(body),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return NewServer(routes), nil
+}
+
+func contentType(path string) string {
+	switch filepath.Ext(path) {
+	case ".json":
+		return "application/json"
+	case ".csv":
+		return "text/csv"
+	case ".html", ".htm":
+		return "text/html"
+	}
+	return "application/octet-stream"
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	key := routeKey(req.Method, req.URL.Path)
+
+	s.lock.Lock()
+	s.hits[key]++
+	s.lock.Unlock()
+
+	r, ok := s.routes[key]
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+	for k, v := range r.Headers {
+		w.Header().Set(k, v)
+	}
+	if r.Status != 0 {
+		w.WriteHeader(r.Status)
+	}
+	w.Write([]byte(r.Body))
+}
+
+// Close shuts down the server
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// Globals returns starlark globals that wire the server url into a script as
+// test_server_url
+func (s *Server) Globals() starlark.StringDict {
+	return starlark.StringDict{
+		GlobalName: starlark.String(s.URL),
+	}
+}
+
+// Hits returns the number of times a route was requested, routes are
+// identified by method and path, eg: "GET /data.json"
+func (s *Server) Hits(route string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.hits[route]
+}
+
+// AssertHit fails the test if any of the given routes weren't requested
+func (s *Server) AssertHit(t TB, routes ...string) {
+	t.Helper()
+	for _, r := range routes {
+		if s.Hits(r) == 0 {
+			t.Errorf("expected route %q to be requested", r)
+		}
+	}
+}
+
+// AssertNotHit fails the test if any of the given routes were requested
+func (s *Server) AssertNotHit(t TB, routes ...string) {
+	t.Helper()
+	for _, r := range routes {
+		if n := s.Hits(r); n > 0 {
+			t.Errorf("expected route %q not to be requested, got %d requests", r, n)
+		}
+	}
+}
+
+// AssertAllRoutesHit fails the test if any route wasn't requested, or if any
+// request didn't match a route
+func (s *Server) AssertAllRoutesHit(t TB) {
+	t.Helper()
+	keys := make([]string, 0, len(s.routes))
+	for k := range s.routes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	s.AssertHit(t, keys...)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for k := range s.hits {
+		if _, ok := s.routes[k]; !ok {
+			t.Errorf("unexpected request to unknown route %q", k)
+		}
+	}
+}
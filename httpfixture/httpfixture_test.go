@@ -0,0 +1,112 @@
+package httpfixture
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"go.starlark.net/starlark"
+)
+
+func get(t *testing.T, method, url string) (int, string) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res.StatusCode, string(data)
+}
+
+func TestRouteTableServer(t *testing.T) {
+	s, err := NewRouteTableServer("testdata/routes.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	cases := []struct {
+		method, path string
+		status       int
+		body         string
+	}{
+		{"GET", "/inline.json", 200, `{"inline": true}`},
+		{"GET", "/file.json", 200, `["from file"]`},
+		{"POST", "/submit", 201, "created"},
+	}
+	for i, c := range cases {
+		status, body := get(t, c.method, s.URL+c.path)
+		if status != c.status {
+			t.Errorf("case %d status mismatch. expected: %d, got: %d", i, c.status, status)
+		}
+		if body != c.body {
+			t.Errorf("case %d body mismatch. expected: %q, got: %q", i, c.body, body)
+		}
+	}
+
+	s.AssertAllRoutesHit(t)
+	if n := s.Hits("GET /inline.json"); n != 1 {
+		t.Errorf("expected 1 hit, got: %d", n)
+	}
+
+	if status, _ := get(t, "GET", s.URL+"/missing"); status != http.StatusNotFound {
+		t.Errorf("expected unknown route to 404, got: %d", status)
+	}
+	rec := &recorder{}
+	s.AssertAllRoutesHit(rec)
+	s.AssertNotHit(rec, "GET /file.json")
+	expect := []string{
+		`unexpected request to unknown route "GET /missing"`,
+		`expected route "GET /file.json" not to be requested, got 1 requests`,
+	}
+	if strings.Join(rec.errs, "\n") != strings.Join(expect, "\n") {
+		t.Errorf("assertion errors mismatch. expected: %v, got: %v", expect, rec.errs)
+	}
+}
+
+func TestDirServer(t *testing.T) {
+	s, err := NewDirServer("testdata/files")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if _, body := get(t, "GET", s.URL+"/nested/table.csv"); body != "a,b\n1,2\n" {
+		t.Errorf("body mismatch. got: %q", body)
+	}
+
+	rec := &recorder{}
+	s.AssertAllRoutesHit(rec)
+	expect := `expected route "GET /data.json" to be requested`
+	if len(rec.errs) != 1 || rec.errs[0] != expect {
+		t.Errorf("expected error %q, got: %v", expect, rec.errs)
+	}
+}
+
+func TestGlobals(t *testing.T) {
+	s := NewServer(nil)
+	defer s.Close()
+	if s.Globals()[GlobalName] != starlark.String(s.URL) {
+		t.Errorf("expected globals to contain server url")
+	}
+}
+
+// recorder captures assertion failures
+type recorder struct {
+	errs []string
+}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errs = append(r.errs, fmt.Sprintf(format, args...))
+}
+
+func (r *recorder) Helper() {}
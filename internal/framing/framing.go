@@ -0,0 +1,64 @@
+// Package framing reads & writes messages framed with a Content-Length header,
+// the base protocol shared by the Debug Adapter & Language Server protocols
+package framing
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// MaxMessageSize is the largest message content Read accepts, so a bad header
+// can't make a server allocate an unbounded buffer
+const MaxMessageSize = 64 << 20
+
+// Read reads a single message, returning the message content. Read returns io.EOF
+// if the reader ends between messages
+func Read(r *bufio.Reader) ([]byte, error) {
+	length := -1
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && line == "" && length == -1 {
+				return nil, io.EOF
+			}
+			return nil, fmt.Errorf("reading message header: %s", err)
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		i := strings.Index(line, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid message header: %q", line)
+		}
+		if strings.EqualFold(strings.TrimSpace(line[:i]), "Content-Length") {
+			if length, err = strconv.Atoi(strings.TrimSpace(line[i+1:])); err != nil || length < 0 {
+				return nil, fmt.Errorf("invalid Content-Length: %q", line[i+1:])
+			}
+		}
+	}
+	if length == -1 {
+		return nil, fmt.Errorf("message is missing a Content-Length header")
+	}
+	if length > MaxMessageSize {
+		return nil, fmt.Errorf("message Content-Length %d exceeds the %d byte limit", length, MaxMessageSize)
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("reading message content: %s", err)
+	}
+	return data, nil
+}
+
+// Write writes data as a single message
+func Write(w io.Writer, data []byte) error {
+	if _, err := fmt.Fprintf(w, "Content-Length: %d\r\n\r\n", len(data)); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
@@ -0,0 +1,52 @@
+package framing
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReadWrite(t *testing.T) {
+	buf := &bytes.Buffer{}
+	msgs := []string{`{"seq":1}`, `{"seq":2,"command":"next"}`, ``}
+	for _, m := range msgs {
+		if err := Write(buf, []byte(m)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := bufio.NewReader(buf)
+	for i, m := range msgs {
+		data, err := Read(r)
+		if err != nil {
+			t.Fatalf("message %d: %s", i, err)
+		}
+		if string(data) != m {
+			t.Errorf("message %d mismatch. expected: %q, got: %q", i, m, string(data))
+		}
+	}
+	if _, err := Read(r); err != io.EOF {
+		t.Errorf("expected io.EOF after last message, got: %v", err)
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	cases := []struct {
+		input, err string
+	}{
+		{"Content-Type: json\r\n\r\n{}", "message is missing a Content-Length header"},
+		{"Content-Length: abc\r\n\r\n{}", `invalid Content-Length: " abc"`},
+		{"no colon\r\n\r\n", `invalid message header: "no colon"`},
+		{"Content-Length: 10\r\n\r\n{}", "reading message content: unexpected EOF"},
+		{"Content-Length: 9999999999\r\n\r\n{}", "message Content-Length 9999999999 exceeds the 67108864 byte limit"},
+	}
+
+	for i, c := range cases {
+		_, err := Read(bufio.NewReader(strings.NewReader(c.input)))
+		if err == nil || err.Error() != c.err {
+			t.Errorf("case %d error mismatch. expected: %q, got: %v", i, c.err, err)
+		}
+	}
+}
@@ -0,0 +1,504 @@
+package startf
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/qri-io/dataset"
+	"github.com/qri-io/qfs"
+	"github.com/qri-io/startf/fetch"
+	skyqri "github.com/qri-io/startf/qri"
+	"go.starlark.net/resolve"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// LintIssue is a problem found by statically checking a transform script
+type LintIssue struct {
+	Line    int
+	Col     int
+	Rule    string
+	Message string
+}
+
+// String formats an issue as "line:col: message (rule)"
+func (li LintIssue) String() string {
+	return fmt.Sprintf("%d:%d: %s (%s)", li.Line, li.Col, li.Message, li.Rule)
+}
+
+// Lint rules
+const (
+	LintSyntax       = "syntax"        // script can't be parsed or resolved
+	LintMissing      = "missing-func"  // transform function isn't defined
+	LintNotFunc      = "not-func"      // special name is bound to a value that isn't a function
+	LintArity        = "arity"         // special function has the wrong number of parameters
+	LintNetwork      = "network"       // network call outside of a network-enabled special function
+	LintUnknownLoad  = "unknown-load"  // load statement references a module that can't be loaded
+	LintUnusedVar    = "unused"        // variable or loaded symbol is never used
+	LintLanguageFeat = "language-feat" // language feature is disallowed by ExecOpts
+)
+
+// networkModules are modules that make network requests
+var networkModules = map[string]bool{
+	"http.star":      true,
+	fetch.ModuleName: true,
+}
+
+// Lint checks a transform script for problems without executing it. Lint
+// respects the language features, special functions, globals and module loader
+// configured by opts
+func Lint(script qfs.File, opts ...func(o *ExecOpts)) ([]LintIssue, error) {
+	o := &ExecOpts{}
+	DefaultExecOpts(o)
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	src, err := ioutil.ReadAll(script)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &linter{opts: o, defs: map[string]*syntax.DefStmt{}, misspelled: map[string]bool{}}
+	f, err := syntax.Parse(script.FileName(), src, 0)
+	if err != nil {
+		if se, ok := err.(syntax.Error); ok {
+			l.add(se.Pos, LintSyntax, se.Msg)
+			return l.issues, nil
+		}
+		return nil, err
+	}
+
+	l.resolve(f)
+	l.collect(f)
+	l.checkSpecialFuncs(f)
+	l.checkLoads(f)
+	l.checkNetwork(f)
+	l.checkUnused(f)
+
+	sort.SliceStable(l.issues, func(i, j int) bool {
+		a, b := l.issues[i], l.issues[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Col < b.Col
+	})
+	return l.issues, nil
+}
+
+type linter struct {
+	opts   *ExecOpts
+	issues []LintIssue
+	// top-level function definitions by name
+	defs map[string]*syntax.DefStmt
+	// misspelled records special function names reported as typos
+	misspelled map[string]bool
+	// referenced records names the script uses other than where they're defined
+	referenced map[string]bool
+	// top-level non-function bindings by name
+	vals map[string]syntax.Position
+	// names bound by load statements to modules that make network requests
+	netNames map[string]bool
+}
+
+func (l *linter) add(pos syntax.Position, rule, format string, args ...interface{}) {
+	l.issues = append(l.issues, LintIssue{
+		Line:    int(pos.Line),
+		Col:     int(pos.Col),
+		Rule:    rule,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// resolve checks names & disallowed language features with the starlark resolver
+func (l *linter) resolve(f *syntax.File) {
+	prevFloat, prevSet, prevLambda, prevNested := resolve.AllowFloat, resolve.AllowSet, resolve.AllowLambda, resolve.AllowNestedDef
+	resolve.AllowFloat = l.opts.AllowFloat
+	resolve.AllowSet = l.opts.AllowSet
+	resolve.AllowLambda = l.opts.AllowLambda
+	resolve.AllowNestedDef = l.opts.AllowNestedDef
+	defer func() {
+		resolve.AllowFloat, resolve.AllowSet, resolve.AllowLambda, resolve.AllowNestedDef = prevFloat, prevSet, prevLambda, prevNested
+	}()
+
+	predeclared := (&transform{}).locals()
+	isPredeclared := func(name string) bool {
+		_, ok := predeclared[name]
+		if !ok {
+			_, ok = l.opts.Globals[name]
+		}
+		return ok
+	}
+	isUniversal := func(name string) bool {
+		_, ok := starlark.Universe[name]
+		return ok || name == "error"
+	}
+
+	if err := resolve.File(f, isPredeclared, isUniversal); err != nil {
+		if errs, ok := err.(resolve.ErrorList); ok {
+			for _, e := range errs {
+				rule := LintSyntax
+				if strings.Contains(e.Msg, "does not support") {
+					rule = LintLanguageFeat
+				}
+				l.add(e.Pos, rule, e.Msg)
+			}
+			return
+		}
+		l.add(syntax.Position{}, LintSyntax, err.Error())
+	}
+}
+
+// collect records top-level definitions & network module names
+func (l *linter) collect(f *syntax.File) {
+	l.vals = map[string]syntax.Position{}
+	l.netNames = map[string]bool{}
+	l.referenced = referencedNames(f)
+	for _, stmt := range f.Stmts {
+		switch s := stmt.(type) {
+		case *syntax.DefStmt:
+			l.defs[s.Name.Name] = s
+		case *syntax.AssignStmt:
+			for _, id := range boundIdents(s.LHS) {
+				l.vals[id.Name] = id.NamePos
+			}
+		case *syntax.LoadStmt:
+			if networkModules[loadModule(s)] {
+				for _, id := range s.To {
+					l.netNames[id.Name] = true
+				}
+			}
+		}
+	}
+}
+
+// checkSpecialFuncs ensures transform is defined, and special functions are
+// functions that accept the right number of arguments
+func (l *linter) checkSpecialFuncs(f *syntax.File) {
+	expect := map[string]int{"transform": 2}
+	for _, sf := range l.opts.SpecialFuncs {
+		expect[sf.Name] = 1
+	}
+
+	names := make([]string, 0, len(expect))
+	for name := range expect {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if pos, ok := l.vals[name]; ok {
+			l.add(pos, LintNotFunc, "'%s' is not a function", name)
+			continue
+		}
+		def, ok := l.defs[name]
+		if !ok {
+			l.checkMisspelling(name, expect)
+			continue
+		}
+		if n := len(def.Params); n != expect[name] {
+			l.add(def.Name.NamePos, LintArity, "%s must accept %d %s, got %d", name, expect[name], pluralize("argument", expect[name]), n)
+		}
+	}
+
+	if _, ok := l.defs["transform"]; !ok {
+		if _, ok := l.vals["transform"]; !ok && !l.misspelled["transform"] {
+			l.add(syntax.Position{Line: 1, Col: 1}, LintMissing, "transform function is not defined")
+		}
+	}
+}
+
+// checkMisspelling reports functions whose names look like a typo of the
+// undefined special function name. functions the script uses itself are helpers,
+// not misspelled special functions
+func (l *linter) checkMisspelling(name string, expect map[string]int) {
+	var candidates []string
+	for def := range l.defs {
+		if _, ok := expect[def]; !ok && !l.referenced[def] {
+			candidates = append(candidates, def)
+		}
+	}
+	if typo := closestName(name, candidates); typo != "" {
+		l.misspelled[name] = true
+		l.add(l.defs[typo].Name.NamePos, LintMissing, "no %s function defined: found '%s', did you mean '%s'?", name, typo, name)
+	}
+}
+
+// referencedNames gives the names a script uses, such as functions it calls or
+// passes as values. names aren't counted where they're defined
+func referencedNames(f *syntax.File) map[string]bool {
+	refs := map[string]bool{}
+	defined := map[*syntax.Ident]bool{}
+	syntax.Walk(f, func(n syntax.Node) bool {
+		switch x := n.(type) {
+		case *syntax.DefStmt:
+			defined[x.Name] = true
+			for _, param := range x.Params {
+				// parameters with defaults are binary expressions: name=default
+				if bin, ok := param.(*syntax.BinaryExpr); ok {
+					param = bin.X
+				}
+				if id, ok := param.(*syntax.Ident); ok {
+					defined[id] = true
+				}
+			}
+		case *syntax.Ident:
+			if !defined[x] {
+				refs[x.Name] = true
+			}
+		}
+		return true
+	})
+	return refs
+}
+
+func pluralize(word string, n int) string {
+	if n == 1 {
+		return word
+	}
+	return word + "s"
+}
+
+// checkLoads ensures all loaded modules can be loaded
+func (l *linter) checkLoads(f *syntax.File) {
+	t := &transform{
+		next:         &dataset.Dataset{Transform: &dataset.Transform{}},
+		skyqri:       skyqri.NewModule(l.opts.Node),
+		fetch:        fetch.NewModule(httpClient, httpGuard),
+		moduleLoader: l.opts.ModuleLoader,
+	}
+	thread := &starlark.Thread{Load: t.ModuleLoader}
+
+	for _, stmt := range f.Stmts {
+		s, ok := stmt.(*syntax.LoadStmt)
+		if !ok {
+			continue
+		}
+		module := loadModule(s)
+		dict, err := t.ModuleLoader(thread, module)
+		if err != nil {
+			l.add(s.Module.TokenPos, LintUnknownLoad, "cannot load module '%s': %s", module, err)
+			continue
+		}
+		for _, from := range s.From {
+			if _, ok := dict[from.Name]; !ok {
+				l.add(from.NamePos, LintUnknownLoad, "module '%s' has no member '%s'", module, from.Name)
+			}
+		}
+	}
+}
+
+func loadModule(s *syntax.LoadStmt) string {
+	module, _ := s.Module.Value.(string)
+	return module
+}
+
+// checkNetwork reports network module calls from anywhere other than
+// network-enabled special functions & the helpers they call
+func (l *linter) checkNetwork(f *syntax.File) {
+	if len(l.netNames) == 0 {
+		return
+	}
+
+	var allowed, denied []string
+	for _, sf := range l.opts.SpecialFuncs {
+		if sf.AllowNetwork {
+			allowed = append(allowed, sf.Name)
+		} else {
+			denied = append(denied, sf.Name)
+		}
+	}
+	denied = append(denied, "transform")
+
+	// functions reachable from non-network functions can't make network calls,
+	// even if they're also called from network-enabled functions
+	offline := l.reachable(denied)
+	online := l.reachable(allowed)
+
+	for name, def := range l.defs {
+		if online[name] && !offline[name] {
+			continue
+		}
+		if !online[name] && !offline[name] {
+			// functions that no special function calls never run
+			continue
+		}
+		l.reportNetworkCalls(def.Body, fmt.Sprintf("in function '%s'", name))
+	}
+
+	// top-level statements execute before any special function
+	var top []syntax.Stmt
+	for _, stmt := range f.Stmts {
+		if _, ok := stmt.(*syntax.DefStmt); !ok {
+			top = append(top, stmt)
+		}
+	}
+	l.reportNetworkCalls(top, "at the top level of the script")
+}
+
+func (l *linter) reportNetworkCalls(stmts []syntax.Stmt, where string) {
+	for _, stmt := range stmts {
+		syntax.Walk(stmt, func(n syntax.Node) bool {
+			call, ok := n.(*syntax.CallExpr)
+			if !ok {
+				return true
+			}
+			if dot, ok := call.Fn.(*syntax.DotExpr); ok {
+				if id, ok := dot.X.(*syntax.Ident); ok && l.netNames[id.Name] {
+					l.add(id.NamePos, LintNetwork, "network call %s.%s %s, network access is only allowed during download", id.Name, dot.Name.Name, where)
+				}
+			}
+			return true
+		})
+	}
+}
+
+// reachable returns the set of top-level functions called directly or
+// indirectly from the given roots, including the roots themselves
+func (l *linter) reachable(roots []string) map[string]bool {
+	seen := map[string]bool{}
+	var visit func(name string)
+	visit = func(name string) {
+		def, ok := l.defs[name]
+		if !ok || seen[name] {
+			return
+		}
+		seen[name] = true
+		for _, stmt := range def.Body {
+			syntax.Walk(stmt, func(n syntax.Node) bool {
+				if id, ok := n.(*syntax.Ident); ok {
+					visit(id.Name)
+				}
+				return true
+			})
+		}
+	}
+	for _, r := range roots {
+		visit(r)
+	}
+	return seen
+}
+
+// checkUnused reports function-local variables that are assigned but never
+// read, and loaded symbols that are never used
+func (l *linter) checkUnused(f *syntax.File) {
+	for _, stmt := range f.Stmts {
+		if def, ok := stmt.(*syntax.DefStmt); ok {
+			l.checkUnusedLocals(def)
+		}
+	}
+
+	used := usedNames(f.Stmts)
+	for _, stmt := range f.Stmts {
+		if s, ok := stmt.(*syntax.LoadStmt); ok {
+			for _, id := range s.To {
+				if !used[id.Name] && !strings.HasPrefix(id.Name, "_") {
+					l.add(id.NamePos, LintUnusedVar, "'%s' is loaded but never used", id.Name)
+				}
+			}
+		}
+	}
+}
+
+func (l *linter) checkUnusedLocals(def *syntax.DefStmt) {
+	params := map[string]bool{}
+	for _, p := range def.Params {
+		syntax.Walk(p, func(n syntax.Node) bool {
+			if id, ok := n.(*syntax.Ident); ok {
+				params[id.Name] = true
+			}
+			return true
+		})
+	}
+
+	var bound []*syntax.Ident
+	for _, stmt := range def.Body {
+		syntax.Walk(stmt, func(n syntax.Node) bool {
+			switch s := n.(type) {
+			case *syntax.AssignStmt:
+				if s.Op == syntax.EQ {
+					bound = append(bound, boundIdents(s.LHS)...)
+				}
+			case *syntax.ForStmt:
+				bound = append(bound, boundIdents(s.Vars)...)
+			}
+			return true
+		})
+	}
+
+	used := usedNames(def.Body)
+	reported := map[string]bool{}
+	for _, id := range bound {
+		if used[id.Name] || params[id.Name] || reported[id.Name] || strings.HasPrefix(id.Name, "_") {
+			continue
+		}
+		reported[id.Name] = true
+		l.add(id.NamePos, LintUnusedVar, "'%s' is assigned but never used", id.Name)
+	}
+}
+
+// usedNames collects the names of identifiers that are read in stmts
+func usedNames(stmts []syntax.Stmt) map[string]bool {
+	binding := map[*syntax.Ident]bool{}
+	for _, stmt := range stmts {
+		syntax.Walk(stmt, func(n syntax.Node) bool {
+			switch s := n.(type) {
+			case *syntax.AssignStmt:
+				if s.Op == syntax.EQ {
+					for _, id := range boundIdents(s.LHS) {
+						binding[id] = true
+					}
+				}
+			case *syntax.ForStmt:
+				for _, id := range boundIdents(s.Vars) {
+					binding[id] = true
+				}
+			case *syntax.DefStmt:
+				binding[s.Name] = true
+			case *syntax.LoadStmt:
+				for _, id := range s.From {
+					binding[id] = true
+				}
+				for _, id := range s.To {
+					binding[id] = true
+				}
+			case *syntax.DotExpr:
+				// attribute names aren't variable references
+				binding[s.Name] = true
+			}
+			return true
+		})
+	}
+
+	used := map[string]bool{}
+	for _, stmt := range stmts {
+		syntax.Walk(stmt, func(n syntax.Node) bool {
+			if id, ok := n.(*syntax.Ident); ok && !binding[id] {
+				used[id.Name] = true
+			}
+			return true
+		})
+	}
+	return used
+}
+
+// boundIdents returns the identifiers bound by an assignment target
+func boundIdents(x syntax.Expr) (ids []*syntax.Ident) {
+	switch e := x.(type) {
+	case *syntax.Ident:
+		return []*syntax.Ident{e}
+	case *syntax.TupleExpr:
+		for _, el := range e.List {
+			ids = append(ids, boundIdents(el)...)
+		}
+	case *syntax.ListExpr:
+		for _, el := range e.List {
+			ids = append(ids, boundIdents(el)...)
+		}
+	case *syntax.ParenExpr:
+		return boundIdents(e.X)
+	}
+	return ids
+}
@@ -0,0 +1,75 @@
+package startf
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/qri-io/qfs"
+)
+
+func TestLint(t *testing.T) {
+	issues, err := Lint(scriptFile(t, "testdata/lint.star"), func(o *ExecOpts) {
+		o.AllowFloat = false
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{
+		"2:19: 'time' is loaded but never used (unused)",
+		"3:6: cannot load module 'nope.star'",
+		"3:19: 'nope' is loaded but never used (unused)",
+		"5:1: 'download' is not a function (not-func)",
+		"8:10: network call http.get in function 'fetch_page', network access is only allowed during download (network)",
+		"10:5: transform must accept 2 arguments, got 1 (arity)",
+		"11:3: 'unused' is assigned but never used (unused)",
+		"13:7: 'i' is assigned but never used (unused)",
+		"15:20: ",
+	}
+	if len(issues) != len(expect) {
+		t.Errorf("expected %d issues, got %d: %v", len(expect), len(issues), issues)
+	}
+	for i, e := range expect {
+		if i >= len(issues) {
+			break
+		}
+		if !strings.HasPrefix(issues[i].String(), e) {
+			t.Errorf("issue %d mismatch. expected prefix: %q, got: %q", i, e, issues[i].String())
+		}
+	}
+	if len(issues) == len(expect) && issues[len(issues)-1].Rule != LintLanguageFeat {
+		t.Errorf("expected float literal to be a language feature issue, got: %s", issues[len(issues)-1])
+	}
+}
+
+func TestLintCases(t *testing.T) {
+	cases := []struct {
+		script string
+		expect []string
+	}{
+		{"def transform(ds, ctx):\n  pass\n", nil},
+		{"def transfrom(ds, ctx):\n  pass\n", []string{"1:5: no transform function defined: found 'transfrom', did you mean 'transform'? (missing-func)"}},
+		{"def main(ds, ctx):\n  pass\ndef helper(x):\n  pass\n", []string{"1:1: transform function is not defined (missing-func)"}},
+		{"def transforms(x):\n  return x\ndef main(ds, ctx):\n  ds.set_body(transforms([1]))\n", []string{"1:1: transform function is not defined (missing-func)"}},
+		{"def transform(ds, ctx)\n", []string{"2:1: got newline, want ':' (syntax)"}},
+		{"load('http.star', 'http')\ndef download(ctx):\n  return http.get('http://a.com')\ndef transform(ds, ctx):\n  pass\n", nil},
+		{"load('http.star', 'http')\nres = http.get('http://a.com')\ndef transform(ds, ctx):\n  pass\n", []string{"2:7: network call http.get at the top level of the script"}},
+	}
+
+	for i, c := range cases {
+		issues, err := Lint(qfs.NewMemfileBytes("transform.star", []byte(c.script)))
+		if err != nil {
+			t.Errorf("case %d unexpected error: %s", i, err)
+			continue
+		}
+		if len(issues) != len(c.expect) {
+			t.Errorf("case %d expected %d issues, got: %v", i, len(c.expect), issues)
+			continue
+		}
+		for j, e := range c.expect {
+			if !strings.HasPrefix(issues[j].String(), e) {
+				t.Errorf("case %d issue %d mismatch. expected prefix: %q, got: %q", i, j, e, issues[j].String())
+			}
+		}
+	}
+}
@@ -0,0 +1,10 @@
+// Code generated by gendocs.go; DO NOT EDIT.
+
+package lsp
+
+// packageDocs are the package outlines documenting each type, by type name
+var packageDocs = map[string]string{
+	TypeContext: "Package context defines the transformation context object within starlark\n\n  outline: context\n    context carries values across special function calls in a transformation.\n    the context is passed to each special function as the ctx argument\n\n    types:\n      Context\n        a transformation context. The return value of each special function is\n        available on the context by name, eg: ctx.download\n        methods:\n          get_config(key string) value|None\n            get a value from the transform configuration by key\n          get_secret(key string) value|None\n            get a secret value by key. secrets are only available in steps that\n            allow them\n          set(key string, value)\n            store a value on the context for use in later steps\n          get(key string) value\n            get a value stored with set, erroring if key isn't set\n",
+	TypeDataset: "Package ds defines the qri dataset object within starlark\n\n  outline: ds\n    ds defines the qri dataset object within starlark. it's loaded by default\n    in the qri runtime\n\n    types:\n      Dataset\n        a qri dataset. Datasets can be either read-only or read-write. By default datasets are read-write\n        methods:\n          set_meta(meta dict)\n            set dataset meta component\n          get_meta() dict|None\n            get dataset meta component\n          get_structure() dict|None\n            get dataset structure component if one is defined\n          set_structure(structure) structure\n            set dataset structure component\n          get_body(default?, as_dicts? bool, offset? int, limit? int) dict|list|None\n            get dataset body component if one is defined, returning default otherwise. when as_dicts is True, rows\n            of an array body are returned as dicts keyed by the column titles of the structure's schema. offset &\n            limit read limit entries starting at offset, without loading the whole body. offset defaults to 0 &\n            limit to all entries\n          get_entry(index_or_key int|string) value\n            get a single body entry by index for array bodies or by key for object bodies, reading the body only\n            as far as the entry. missing entries are an error\n          get_table() table|None\n            get dataset body component as a table, naming columns with the titles of the structure's schema. the\n            body must be an array of rows\n          get_stats(columns? bool) dict|None\n            summarize the body without loading it: \"entries\" is the entry count, \"length\" the body size in bytes\n            & \"columns\" maps each column (or object key) to its \"count\" of values, \"nulls\", \"min\", \"max\" &\n            \"distinct\", an estimate of the number of distinct values that's exact below 256. stats are read in one\n            pass over the body file. with columns=False only entries & length are given, read from the structure\n            when it records them\n          set_body(data dict|list|table, parse_as? string, format? string, format_config? dict, compression? string, member? string, sheet? string) body\n            set dataset body component. 'parse_as' defaults to the empty string. By default qri assumes the data\n            value provided to set_body is an iterable starlark data structure (tuple, set, list, dict). Object\n            bodies can be a dict, a struct of fields or any other mapping that can be iterated, and object keys\n            must be strings, at any depth. When parse_as is set, set_body assumes the provided body value will be a string of serialized\n            structured data in the given format. valid parse_as values are \"json\", \"csv\", \"cbor\", \"xlsx\". parse_as\n            data must parse completely, errors report the line they occur on, and the structure is detected from it:\n            the format, a csv header row, an inferred schema & the entry count. When data is a table, the body\n            schema is set to describe the table's columns, keeping the existing structure format. Lists of dicts set\n            the body of a tabular dataset (csv, xlsx, or a schema of arrays) as rows, ordering columns by the\n            existing schema & adding new keys as columns at the end. Otherwise lists of dicts are written as an\n            array of objects. When the dataset has no structure, one is inferred from data, see infer_schema. format\n            sets the format the body is written in, one of \"csv\", \"json\", \"cbor\", \"ndjson\", \"xlsx\", converting from\n            the inherited structure's format, which is json by default. format_config sets options for the format:\n            header_row, lazy_quotes, delimiter & variadic_fields for csv, pretty for json, and sheet_name for xlsx.\n            format_config is merged with the existing config when the format doesn't change. format & format_config\n            can't be combined with parse_as. compression decodes parse_as data that is compressed, one of \"gzip\",\n            \"zip\", \"bz2\". data may hold the raw bytes of a file, such as the body of an http response, and can\n            decompress to at most 256MB. member names the file to read from a zip archive, and may be omitted when\n            the archive holds a single file. sheet selects the sheet to read when parsing xlsx.\n          infer_schema(data?) dict|None\n            infer a json schema from data, or the dataset body if data isn't given. schemas record value types,\n            nullability, & the shape of nested objects and arrays. bodies that are arrays of arrays are described as\n            tables with a titled schema for each column. adjust the result & pass it to set_structure to override\n            the schema set_body infers\n          get_history(n? int) list\n            get up to n previous versions of the dataset as a list of read-only datasets, starting with the most\n            recent version. n defaults to 10. Useful for building time series across versions\n      Table\n        tabular data: rows of values with named columns, created with ds.get_table() or\n        dataset.table(rows, columns?). rows can be lists named by columns, or dicts. Tables are immutable,\n        methods return new tables. t[\"name\"] gives a column's values as a list, t[0] gives a row, iterating a\n        table gives rows as lists & len(t) is the number of rows. t.columns lists column names\n        methods:\n          filter(fn) table\n            keep rows for which fn(row) is true, passing each row as a dict keyed by column name\n          select(*columns string) table\n            pick columns by name, in the order given\n          sort(by string|list, reverse? bool) table\n            order rows by one or more columns. the sort is stable & None sorts first\n          group_by(*columns string) grouped_table\n            group rows by the values of one or more columns. iterating a grouped table gives group keys, indexing\n            it with a key gives the group's rows as a table. grouped_table.aggregate(**aggregates) gives a table\n            with the key columns followed by a column for each aggregate\n          join(other table, on string|list, how? string) table\n            combine rows with equal values in the \"on\" columns. how is \"inner\" (default) or \"left\". columns of\n            other that share a name with a column of this table are suffixed with \"_right\"\n          aggregate(**aggregates) table\n            reduce the table to a single row. each aggregate is a (column, function) pair, eg:\n            total=(\"amount\", \"sum\"). function is one of \"count\", \"sum\", \"mean\", \"min\", \"max\", \"first\", \"last\",\n            or a function that accepts a list of the column's values. all but count ignore None values\n      Decimal\n        an exact base 10 number, for values like currency amounts that floats can't represent without rounding\n        errors, created with dataset.decimal(x) from a string, int, float or decimal. decimals support +, -, *,\n        /, // & % with other decimals & ints, and comparison with other decimals. / keeps 16 more digits than\n        its operands when a result doesn't divide exactly. get_body reads values the structure's schema gives\n        format \"decimal\" as decimals, and values with format \"date-time\" as times from the time module.\n        set_body writes them back exactly, and infers those formats when it infers a schema\n        methods:\n          round(places? int) decimal\n            round to a number of digits after the decimal point, rounding halves to even. places defaults to 0\n          float() float\n            convert to the nearest float\n",
+	TypeQri:     "Package qri defines the qri module within starlark\n\n  outline: qri\n    qri exposes a qri node to transform scripts. load it with\n    load(\"qri.star\", \"qri\")\n\n    types:\n      qri\n        the qri module\n        methods:\n          list_datasets() list\n            list references to datasets in the local qri repo\n",
+}
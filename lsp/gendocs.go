@@ -0,0 +1,58 @@
+//go:build ignore
+// +build ignore
+
+// gendocs writes docs.go, embedding the package outlines of the packages that
+// document transform script types so the language server has documentation
+// without the startf source. Run with go generate
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"sort"
+	"strconv"
+)
+
+// docFiles maps type name constants to the doc.go files that document them
+var docFiles = map[string]string{
+	"TypeDataset": "../ds/doc.go",
+	"TypeContext": "../context/doc.go",
+	"TypeQri":     "../qri/doc.go",
+}
+
+func main() {
+	types := make([]string, 0, len(docFiles))
+	for typ := range docFiles {
+		types = append(types, typ)
+	}
+	sort.Strings(types)
+
+	buf := &bytes.Buffer{}
+	buf.WriteString("// Code generated by gendocs.go; DO NOT EDIT.\n\npackage lsp\n\n")
+	buf.WriteString("// packageDocs are the package outlines documenting each type, by type name\n")
+	buf.WriteString("var packageDocs = map[string]string{\n")
+	for _, typ := range types {
+		f, err := parser.ParseFile(token.NewFileSet(), docFiles[typ], nil, parser.PackageClauseOnly|parser.ParseComments)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if f.Doc == nil {
+			log.Fatalf("%s has no package comment", docFiles[typ])
+		}
+		fmt.Fprintf(buf, "\t%s: %s,\n", typ, strconv.Quote(f.Doc.Text()))
+	}
+	buf.WriteString("}\n")
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := ioutil.WriteFile("docs.go", src, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
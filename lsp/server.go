@@ -0,0 +1,596 @@
+// Package lsp implements a language server for qri starlark transform scripts,
+// offering completion, hover documentation & signature help for the functions
+// startf provides, and diagnostics from the startf linter
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/qri-io/qfs"
+	"github.com/qri-io/startf"
+	"github.com/qri-io/startf/internal/framing"
+)
+
+// LSP completion item kinds
+const (
+	kindMethod   = 2
+	kindFunction = 3
+	kindKeyword  = 14
+)
+
+// LSP diagnostic severities
+const (
+	severityError   = 1
+	severityWarning = 2
+)
+
+// JSON-RPC error codes
+const (
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+)
+
+var keywords = []string{
+	"and", "break", "continue", "def", "elif", "else", "for", "if", "in", "lambda",
+	"load", "not", "or", "pass", "return",
+}
+
+// Server is a language server
+type Server struct {
+	Symbols *Symbols
+	// LintOpts are passed to startf.Lint when checking documents
+	LintOpts []func(o *startf.ExecOpts)
+
+	lock sync.Mutex
+	docs map[string]string
+
+	wlock sync.Mutex
+	w     io.Writer
+}
+
+// NewServer creates a language server
+func NewServer() *Server {
+	return &Server{
+		Symbols: NewSymbols(),
+		docs:    map[string]string{},
+	}
+}
+
+type request struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type rng struct {
+	Start position `json:"start"`
+	End   position `json:"end"`
+}
+
+type textDocumentPositionParams struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	Position position `json:"position"`
+}
+
+// Serve reads requests from r & writes responses to w until the client sends
+// an exit notification or r ends
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	s.w = w
+	br := bufio.NewReader(r)
+	for {
+		data, err := framing.Read(br)
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		req := &request{}
+		if err := json.Unmarshal(data, req); err != nil {
+			return fmt.Errorf("decoding request: %s", err)
+		}
+		if req.Method == "exit" {
+			return nil
+		}
+
+		result, rerr := s.handle(req)
+		if len(req.ID) == 0 {
+			// notifications get no response
+			continue
+		}
+		s.respond(req.ID, result, rerr)
+	}
+}
+
+func (s *Server) handle(req *request) (interface{}, *rpcError) {
+	switch req.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync":      1,
+				"hoverProvider":         true,
+				"completionProvider":    map[string]interface{}{"triggerCharacters": []string{"."}},
+				"signatureHelpProvider": map[string]interface{}{"triggerCharacters": []string{"(", ","}},
+			},
+			"serverInfo": map[string]interface{}{"name": "startf", "version": startf.Version},
+		}, nil
+	case "shutdown":
+		return nil, nil
+	case "textDocument/didOpen":
+		p := struct {
+			TextDocument struct {
+				URI  string `json:"uri"`
+				Text string `json:"text"`
+			} `json:"textDocument"`
+		}{}
+		if err := json.Unmarshal(req.Params, &p); err != nil {
+			return nil, invalidParams(err)
+		}
+		s.update(p.TextDocument.URI, p.TextDocument.Text)
+		return nil, nil
+	case "textDocument/didChange":
+		p := struct {
+			TextDocument struct {
+				URI string `json:"uri"`
+			} `json:"textDocument"`
+			ContentChanges []struct {
+				Text string `json:"text"`
+			} `json:"contentChanges"`
+		}{}
+		if err := json.Unmarshal(req.Params, &p); err != nil {
+			return nil, invalidParams(err)
+		}
+		// documents are synced in full, the last change is the current text
+		if n := len(p.ContentChanges); n > 0 {
+			s.update(p.TextDocument.URI, p.ContentChanges[n-1].Text)
+		}
+		return nil, nil
+	case "textDocument/didClose":
+		p := textDocumentPositionParams{}
+		if err := json.Unmarshal(req.Params, &p); err != nil {
+			return nil, invalidParams(err)
+		}
+		s.lock.Lock()
+		delete(s.docs, p.TextDocument.URI)
+		s.lock.Unlock()
+		s.notify("textDocument/publishDiagnostics", map[string]interface{}{
+			"uri":         p.TextDocument.URI,
+			"diagnostics": []interface{}{},
+		})
+		return nil, nil
+	case "textDocument/completion", "textDocument/hover", "textDocument/signatureHelp":
+		p := textDocumentPositionParams{}
+		if err := json.Unmarshal(req.Params, &p); err != nil {
+			return nil, invalidParams(err)
+		}
+		s.lock.Lock()
+		text := s.docs[p.TextDocument.URI]
+		s.lock.Unlock()
+
+		switch req.Method {
+		case "textDocument/completion":
+			return s.completion(text, p.Position), nil
+		case "textDocument/hover":
+			return s.hover(text, p.Position), nil
+		default:
+			return s.signatureHelp(text, p.Position), nil
+		}
+	}
+
+	if strings.HasPrefix(req.Method, "$/") || len(req.ID) == 0 {
+		// ignore optional & unhandled notifications
+		return nil, nil
+	}
+	return nil, &rpcError{Code: codeMethodNotFound, Message: fmt.Sprintf("method not found: %s", req.Method)}
+}
+
+func invalidParams(err error) *rpcError {
+	return &rpcError{Code: codeInvalidParams, Message: err.Error()}
+}
+
+// update stores a document's text & publishes diagnostics for it
+func (s *Server) update(uri, text string) {
+	s.lock.Lock()
+	s.docs[uri] = text
+	s.lock.Unlock()
+
+	s.notify("textDocument/publishDiagnostics", map[string]interface{}{
+		"uri":         uri,
+		"diagnostics": s.diagnostics(uri, text),
+	})
+}
+
+func (s *Server) diagnostics(uri, text string) []map[string]interface{} {
+	diags := []map[string]interface{}{}
+	issues, err := startf.Lint(qfs.NewMemfileBytes(uriPath(uri), []byte(text)), s.LintOpts...)
+	if err != nil {
+		return diags
+	}
+
+	lines := strings.Split(text, "\n")
+	for _, issue := range issues {
+		start := position{Line: issue.Line - 1}
+		if start.Line < 0 {
+			start.Line = 0
+		}
+		line := ""
+		if start.Line < len(lines) {
+			line = lines[start.Line]
+		}
+		// lint columns count runes, convert them to UTF-16 characters by way of bytes
+		col := runeOffset(line, issue.Col-1)
+		start.Character = charOffset(line, col)
+		end := start
+		end.Character++
+		if w := wordAt(line, col); len(w) > 0 {
+			end.Character = charOffset(line, col+len(w))
+		}
+
+		severity := severityWarning
+		if issue.Rule == startf.LintSyntax {
+			severity = severityError
+		}
+		diags = append(diags, map[string]interface{}{
+			"range":    rng{Start: start, End: end},
+			"severity": severity,
+			"code":     issue.Rule,
+			"source":   "startf",
+			"message":  issue.Message,
+		})
+	}
+	return diags
+}
+
+// uriPath converts a file uri to a path, returning other uris unchanged
+func uriPath(uri string) string {
+	if u, err := url.Parse(uri); err == nil && u.Scheme == "file" {
+		return u.Path
+	}
+	return uri
+}
+
+var (
+	memberPrefix = regexp.MustCompile(`([A-Za-z_][A-Za-z0-9_]*)\.([A-Za-z0-9_]*)$`)
+	wordPrefix   = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]*$`)
+	topLevelDef  = regexp.MustCompile(`(?m)^def\s+([A-Za-z_][A-Za-z0-9_]*)`)
+)
+
+func (s *Server) completion(text string, pos position) interface{} {
+	prefix := linePrefix(text, pos)
+	items := []map[string]interface{}{}
+
+	if m := memberPrefix.FindStringSubmatch(prefix); m != nil {
+		typ := typeOf(text, m[1])
+		for _, name := range s.Symbols.Names(typ) {
+			if strings.HasPrefix(name, m[2]) {
+				items = append(items, completionItem(s.Symbols.Types[typ][name], kindMethod))
+			}
+		}
+		return map[string]interface{}{"isIncomplete": false, "items": items}
+	}
+
+	word := wordPrefix.FindString(prefix)
+	globals := make([]string, 0, len(s.Symbols.Globals))
+	for name := range s.Symbols.Globals {
+		globals = append(globals, name)
+	}
+	sort.Strings(globals)
+	for _, name := range globals {
+		if strings.HasPrefix(name, word) {
+			items = append(items, completionItem(s.Symbols.Globals[name], kindFunction))
+		}
+	}
+	for _, m := range topLevelDef.FindAllStringSubmatch(text, -1) {
+		if strings.HasPrefix(m[1], word) {
+			items = append(items, map[string]interface{}{"label": m[1], "kind": kindFunction})
+		}
+	}
+	for _, kw := range keywords {
+		if strings.HasPrefix(kw, word) {
+			items = append(items, map[string]interface{}{"label": kw, "kind": kindKeyword})
+		}
+	}
+	return map[string]interface{}{"isIncomplete": false, "items": items}
+}
+
+func completionItem(m *Member, kind int) map[string]interface{} {
+	item := map[string]interface{}{"label": m.Name, "kind": kind}
+	if m.Signature != "" {
+		item["detail"] = m.Signature
+	}
+	if m.Doc != "" {
+		item["documentation"] = m.Doc
+	}
+	return item
+}
+
+func (s *Server) hover(text string, pos position) interface{} {
+	lines := strings.Split(text, "\n")
+	if pos.Line >= len(lines) {
+		return nil
+	}
+	line := lines[pos.Line]
+	start, end := wordBounds(line, byteOffset(line, pos.Character))
+	if start == end {
+		return nil
+	}
+
+	m := s.lookup(text, line[:start], line[start:end])
+	if m == nil || (m.Signature == "" && m.Doc == "") {
+		return nil
+	}
+	value := fmt.Sprintf("```python\n%s\n```", m.Signature)
+	if m.Signature == "" {
+		value = fmt.Sprintf("```python\n%s\n```", m.Name)
+	}
+	if m.Doc != "" {
+		value += "\n\n" + m.Doc
+	}
+	return map[string]interface{}{
+		"contents": map[string]interface{}{"kind": "markdown", "value": value},
+		"range": rng{
+			Start: position{Line: pos.Line, Character: charOffset(line, start)},
+			End:   position{Line: pos.Line, Character: charOffset(line, end)},
+		},
+	}
+}
+
+// lookup finds the member a name refers to. before is the text that precedes name,
+// used to find the value name is accessed on, if any
+func (s *Server) lookup(text, before, name string) *Member {
+	if m := memberPrefix.FindStringSubmatch(before); m != nil && m[2] == "" {
+		return s.Symbols.Types[typeOf(text, m[1])][name]
+	}
+	return s.Symbols.Globals[name]
+}
+
+func (s *Server) signatureHelp(text string, pos position) interface{} {
+	before := textBefore(text, pos)
+	open, param := openCall(before)
+	if open < 0 {
+		return nil
+	}
+	callee := strings.TrimRight(before[:open], " \t")
+	nameStart := len(callee) - len(wordPrefix.FindString(callee))
+	m := s.lookup(text, callee[:nameStart], callee[nameStart:])
+	if m == nil || m.Signature == "" {
+		return nil
+	}
+
+	params := make([]map[string]interface{}, len(m.Params))
+	for i, p := range m.Params {
+		params[i] = map[string]interface{}{"label": p}
+	}
+	return map[string]interface{}{
+		"signatures": []map[string]interface{}{{
+			"label":         m.Signature,
+			"documentation": m.Doc,
+			"parameters":    params,
+		}},
+		"activeSignature": 0,
+		"activeParameter": param,
+	}
+}
+
+// openCall finds the innermost unclosed call in text, returning the offset of its
+// open paren & the index of the argument being written. returns -1 if text
+// doesn't end inside a call
+func openCall(text string) (open, param int) {
+	var stack []int
+	var commas []int
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			for i < len(text) && text[i] != '\n' {
+				i++
+			}
+		case c == '(' || c == '[' || c == '{':
+			stack = append(stack, i)
+			commas = append(commas, 0)
+		case c == ')' || c == ']' || c == '}':
+			if len(stack) > 0 {
+				stack, commas = stack[:len(stack)-1], commas[:len(commas)-1]
+			}
+		case c == ',':
+			if len(commas) > 0 {
+				commas[len(commas)-1]++
+			}
+		}
+	}
+	if len(stack) == 0 || text[stack[len(stack)-1]] != '(' {
+		return -1, 0
+	}
+	return stack[len(stack)-1], commas[len(commas)-1]
+}
+
+var (
+	loadQri     = regexp.MustCompile(`load\(\s*["']qri\.star["'][^)]*?(?:([A-Za-z_][A-Za-z0-9_]*)\s*=\s*)?["']qri["']`)
+	loadDataset = regexp.MustCompile(`([A-Za-z_][A-Za-z0-9_]*)\s*=\s*load_dataset\(`)
+	defParams   = regexp.MustCompile(`(?m)^def\s+(transform|download)\s*\(([^)]*)\)`)
+)
+
+// typeOf guesses the type of a variable from how it's bound in a script
+func typeOf(text, name string) string {
+	for _, m := range defParams.FindAllStringSubmatch(text, -1) {
+		params := strings.Split(m[2], ",")
+		for i, p := range params {
+			if strings.TrimSpace(p) != name {
+				continue
+			}
+			if m[1] == "transform" && i == 0 {
+				return TypeDataset
+			}
+			return TypeContext
+		}
+	}
+	for _, m := range loadQri.FindAllStringSubmatch(text, -1) {
+		if m[1] == name || (m[1] == "" && name == "qri") {
+			return TypeQri
+		}
+	}
+	for _, m := range loadDataset.FindAllStringSubmatch(text, -1) {
+		if m[1] == name {
+			return TypeDataset
+		}
+	}
+
+	// fall back to conventional names
+	switch name {
+	case "ds":
+		return TypeDataset
+	case "ctx":
+		return TypeContext
+	}
+	return ""
+}
+
+// textBefore returns the document text before a position
+func textBefore(text string, pos position) string {
+	lines := strings.SplitAfter(text, "\n")
+	if pos.Line >= len(lines) {
+		return text
+	}
+	return strings.Join(lines[:pos.Line], "") + linePrefix(text, pos)
+}
+
+// linePrefix returns the text of a position's line before the position
+func linePrefix(text string, pos position) string {
+	lines := strings.Split(text, "\n")
+	if pos.Line >= len(lines) {
+		return ""
+	}
+	line := lines[pos.Line]
+	return line[:byteOffset(line, pos.Character)]
+}
+
+// LSP positions count characters in UTF-16 code units, while lines are indexed by
+// byte. byteOffset converts a character offset in line to a byte offset
+func byteOffset(line string, char int) int {
+	n := 0
+	for i, r := range line {
+		if n >= char {
+			return i
+		}
+		n += utf16Len(r)
+	}
+	return len(line)
+}
+
+// charOffset converts a byte offset in line to a UTF-16 character offset
+func charOffset(line string, offset int) int {
+	n := 0
+	for i, r := range line {
+		if i >= offset {
+			break
+		}
+		n += utf16Len(r)
+	}
+	return n
+}
+
+// runeOffset converts a rune column in line to a byte offset
+func runeOffset(line string, col int) int {
+	n := 0
+	for i := range line {
+		if n >= col {
+			return i
+		}
+		n++
+	}
+	return len(line)
+}
+
+// utf16Len is the number of UTF-16 code units that encode r
+func utf16Len(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
+// wordBounds returns the start & end of the identifier that contains col
+func wordBounds(line string, col int) (start, end int) {
+	if col > len(line) {
+		col = len(line)
+	}
+	start, end = col, col
+	for start > 0 && isIdentChar(line[start-1]) {
+		start--
+	}
+	for end < len(line) && isIdentChar(line[end]) {
+		end++
+	}
+	return start, end
+}
+
+// wordAt returns the identifier that starts at col
+func wordAt(line string, col int) string {
+	if col >= len(line) {
+		return ""
+	}
+	end := col
+	for end < len(line) && isIdentChar(line[end]) {
+		end++
+	}
+	return line[col:end]
+}
+
+func (s *Server) respond(id json.RawMessage, result interface{}, err *rpcError) {
+	res := map[string]interface{}{"jsonrpc": "2.0", "id": id}
+	if err != nil {
+		res["error"] = err
+	} else {
+		res["result"] = result
+	}
+	s.send(res)
+}
+
+func (s *Server) notify(method string, params interface{}) {
+	s.send(map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+// send writes a message, ignoring write errors. a broken connection ends the
+// session when the next read fails
+func (s *Server) send(msg interface{}) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	s.wlock.Lock()
+	defer s.wlock.Unlock()
+	framing.Write(s.w, data)
+}
@@ -0,0 +1,253 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/qri-io/startf/internal/framing"
+)
+
+const testScript = `def transform(ds, ctx):
+  ds.set_body(ctx.get_config("x"))
+  unused = 1
+`
+
+type client struct {
+	t    *testing.T
+	w    io.Writer
+	id   int
+	msgs chan map[string]interface{}
+}
+
+func (c *client) send(method string, params interface{}, notify bool) {
+	c.t.Helper()
+	msg := map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params}
+	if !notify {
+		c.id++
+		msg["id"] = c.id
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if err := framing.Write(c.w, data); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// call sends a request & returns its result
+func (c *client) call(method string, params interface{}) interface{} {
+	c.t.Helper()
+	c.send(method, params, false)
+	for {
+		msg := c.next()
+		if id, ok := msg["id"].(float64); ok && int(id) == c.id {
+			if msg["error"] != nil {
+				c.t.Fatalf("%s error: %v", method, msg["error"])
+			}
+			return msg["result"]
+		}
+	}
+}
+
+// notification waits for a notification from the server
+func (c *client) notification(method string) map[string]interface{} {
+	c.t.Helper()
+	for {
+		msg := c.next()
+		if msg["method"] == method {
+			return msg["params"].(map[string]interface{})
+		}
+	}
+}
+
+func (c *client) next() map[string]interface{} {
+	c.t.Helper()
+	select {
+	case msg, ok := <-c.msgs:
+		if !ok {
+			c.t.Fatal("server closed the connection")
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("timed out waiting for a message")
+	}
+	return nil
+}
+
+func TestServer(t *testing.T) {
+	reqR, reqW := io.Pipe()
+	resR, resW := io.Pipe()
+
+	s := NewServer()
+	s.Symbols.AddDocs(TypeContext, readOutline(t, "../context/doc.go"))
+	done := make(chan error)
+	go func() {
+		done <- s.Serve(reqR, resW)
+		resW.Close()
+	}()
+
+	c := &client{t: t, w: reqW, msgs: make(chan map[string]interface{}, 100)}
+	go func() {
+		r := bufio.NewReader(resR)
+		for {
+			data, err := framing.Read(r)
+			if err != nil {
+				close(c.msgs)
+				return
+			}
+			msg := map[string]interface{}{}
+			json.Unmarshal(data, &msg)
+			c.msgs <- msg
+		}
+	}()
+
+	c.call("initialize", map[string]interface{}{})
+	c.send("initialized", map[string]interface{}{}, true)
+
+	uri := "file:///tmp/transform.star"
+	doc := map[string]interface{}{"uri": uri}
+	c.send("textDocument/didOpen", map[string]interface{}{
+		"textDocument": map[string]interface{}{"uri": uri, "languageId": "python", "version": 1, "text": testScript},
+	}, true)
+
+	diags := c.notification("textDocument/publishDiagnostics")["diagnostics"].([]interface{})
+	if len(diags) != 1 {
+		t.Fatalf("expected 1 diagnostic, got: %v", diags)
+	}
+	diag := diags[0].(map[string]interface{})
+	if diag["code"] != "unused" {
+		t.Errorf("expected an unused variable diagnostic, got: %v", diag)
+	}
+	start := diag["range"].(map[string]interface{})["start"].(map[string]interface{})
+	end := diag["range"].(map[string]interface{})["end"].(map[string]interface{})
+	if start["line"] != float64(2) || start["character"] != float64(2) || end["character"] != float64(8) {
+		t.Errorf("diagnostic range mismatch, got: %v", diag["range"])
+	}
+
+	labels := func(res interface{}) string {
+		var names []string
+		for _, item := range res.(map[string]interface{})["items"].([]interface{}) {
+			names = append(names, item.(map[string]interface{})["label"].(string))
+		}
+		return strings.Join(names, ",")
+	}
+
+	res := c.call("textDocument/completion", map[string]interface{}{"textDocument": doc, "position": position{Line: 1, Character: 5}})
+	if got := labels(res); !strings.Contains(got, "set_body") || !strings.Contains(got, "get_meta") || strings.Contains(got, "get_config") {
+		t.Errorf("expected dataset methods, got: %s", got)
+	}
+
+	res = c.call("textDocument/completion", map[string]interface{}{"textDocument": doc, "position": position{Line: 1, Character: 22}})
+	if got := labels(res); got != "get,get_config,get_secret" {
+		t.Errorf("expected context methods starting with 'get', got: %s", got)
+	}
+
+	res = c.call("textDocument/completion", map[string]interface{}{"textDocument": doc, "position": position{Line: 0, Character: 0}})
+	if got := labels(res); !strings.Contains(got, "load_dataset") || !strings.Contains(got, "transform") {
+		t.Errorf("expected globals & top-level functions, got: %s", got)
+	}
+
+	res = c.call("textDocument/hover", map[string]interface{}{"textDocument": doc, "position": position{Line: 1, Character: 24}})
+	hover, _ := res.(map[string]interface{})
+	if hover == nil || !strings.Contains(hover["contents"].(map[string]interface{})["value"].(string), "get a value from the transform configuration") {
+		t.Errorf("expected get_config hover docs, got: %v", res)
+	}
+
+	res = c.call("textDocument/signatureHelp", map[string]interface{}{"textDocument": doc, "position": position{Line: 1, Character: 29}})
+	help, _ := res.(map[string]interface{})
+	if help == nil {
+		t.Fatal("expected signature help for get_config")
+	}
+	sig := help["signatures"].([]interface{})[0].(map[string]interface{})
+	if sig["label"] != "get_config(key string) value|None" || help["activeParameter"] != float64(0) {
+		t.Errorf("signature help mismatch, got: %v", help)
+	}
+
+	c.call("shutdown", nil)
+	c.send("exit", nil, true)
+	if err := <-done; err != nil {
+		t.Errorf("unexpected serve error: %s", err)
+	}
+}
+
+func TestTypeOf(t *testing.T) {
+	script := "load('qri.star', q='qri')\nd = load_dataset('me/data')\ndef transform(data, context):\n  pass\ndef download(c):\n  pass\n"
+	cases := map[string]string{
+		"data":    TypeDataset,
+		"context": TypeContext,
+		"c":       TypeContext,
+		"q":       TypeQri,
+		"d":       TypeDataset,
+		"ds":      TypeDataset,
+		"other":   "",
+	}
+	for name, expect := range cases {
+		if got := typeOf(script, name); got != expect {
+			t.Errorf("%s: expected type %q, got %q", name, expect, got)
+		}
+	}
+}
+
+func TestOpenCall(t *testing.T) {
+	cases := []struct {
+		text  string
+		open  int
+		param int
+	}{
+		{"ds.set_body(", 11, 0},
+		{"ds.set_body([1, 2], ", 11, 1},
+		{"f(\"a, (b\", ", 1, 1},
+		{"f(x)", -1, 0},
+		{"[1, ", -1, 0},
+	}
+	for _, c := range cases {
+		open, param := openCall(c.text)
+		if open != c.open || param != c.param {
+			t.Errorf("%q: expected (%d, %d), got (%d, %d)", c.text, c.open, c.param, open, param)
+		}
+	}
+}
+
+func TestUTF16Positions(t *testing.T) {
+	s := NewServer()
+	s.Symbols.AddDocs(TypeContext, readOutline(t, "../context/doc.go"))
+	// the emoji is two UTF-16 characters & four bytes, é is one character & two bytes
+	text := "def transform(ds, ctx):\n  s = '😀é'; ctx.get_config('x')\n"
+
+	if got := linePrefix(text, position{Line: 1, Character: 20}); got != "  s = '😀é'; ctx.get" {
+		t.Errorf("line prefix mismatch, got: %q", got)
+	}
+
+	res, _ := s.hover(text, position{Line: 1, Character: 20}).(map[string]interface{})
+	if res == nil {
+		t.Fatal("expected get_config hover")
+	}
+	r := res["range"].(rng)
+	if r.Start.Character != 17 || r.End.Character != 27 {
+		t.Errorf("expected hover range in UTF-16 characters 17-27, got: %v", r)
+	}
+
+	line := "  s = '😀é'; ctx.get_config('x')"
+	for _, c := range []struct {
+		char, offset int
+	}{
+		{0, 0}, {7, 7}, {9, 11}, {10, 13}, {13, 16}, {len(line), len(line)},
+	} {
+		if got := byteOffset(line, c.char); got != c.offset {
+			t.Errorf("character %d: expected byte offset %d, got %d", c.char, c.offset, got)
+		}
+		if c.char < len(line) {
+			if got := charOffset(line, c.offset); got != c.char {
+				t.Errorf("byte offset %d: expected character %d, got %d", c.offset, c.char, got)
+			}
+		}
+	}
+	if got := runeOffset(line, 8); got != 11 {
+		t.Errorf("expected rune column 8 at byte 11, got %d", got)
+	}
+}
@@ -0,0 +1,161 @@
+package lsp
+
+import (
+	"sort"
+	"strings"
+
+	skyctx "github.com/qri-io/startf/context"
+	skyds "github.com/qri-io/startf/ds"
+	skyqri "github.com/qri-io/startf/qri"
+	"go.starlark.net/starlark"
+)
+
+// Type names of values with known members
+const (
+	TypeDataset = "dataset"
+	TypeContext = "context"
+	TypeQri     = "qri"
+)
+
+// Member is a function or method available to transform scripts
+type Member struct {
+	Name string
+	// Signature is the documented signature, eg: "set_body(data dict|list, parse_as? string) body"
+	Signature string
+	// Params lists documented parameters, eg: "parse_as? string"
+	Params []string
+	// Doc is the documentation for the member
+	Doc string
+}
+
+// Symbols are the functions & methods available to transform scripts
+type Symbols struct {
+	// Types maps a type name to its methods by name
+	Types map[string]map[string]*Member
+	// Globals are functions available without loading a module
+	Globals map[string]*Member
+}
+
+// builtinDocs documents the globals ExecScript adds to the starlark environment
+var builtinDocs = map[string]*Member{
+	"load_dataset": {Signature: "load_dataset(ref string) dataset", Params: []string{"ref string"}, Doc: "load a read-only dataset by reference, eg: load_dataset(\"me/dataset\")"},
+	"error":        {Signature: "error(msg)", Params: []string{"msg"}, Doc: "halt the transform with an error message"},
+	"breakpoint":   {Signature: "breakpoint()", Doc: "pause the script when running under a debugger. does nothing otherwise"},
+}
+
+//go:generate go run gendocs.go
+
+// NewSymbols builds symbols from the method tables of the starlark types startf
+// provides, adding documentation from the package outlines embedded in docs.go
+func NewSymbols() *Symbols {
+	s := &Symbols{
+		Types: map[string]map[string]*Member{
+			TypeDataset: members(skyds.NewDataset(nil, nil).Methods().AttrNames()),
+			TypeContext: members(skyctx.NewContext(nil, nil).Struct().AttrNames()),
+			TypeQri:     members(skyqri.NewModule(nil).AddAllMethods(starlark.StringDict{}).Keys()),
+		},
+		Globals: members(starlark.Universe.Keys()),
+	}
+	for name, doc := range builtinDocs {
+		m := *doc
+		m.Name = name
+		s.Globals[name] = &m
+	}
+
+	for typ, text := range packageDocs {
+		s.AddDocs(typ, ParseOutline(text))
+	}
+	return s
+}
+
+func members(names []string) map[string]*Member {
+	m := make(map[string]*Member, len(names))
+	for _, name := range names {
+		m[name] = &Member{Name: name}
+	}
+	return m
+}
+
+// AddDocs adds documentation to the members of a type. Documented methods the
+// type doesn't have are ignored
+func (s *Symbols) AddDocs(typ string, docs map[string]*Member) {
+	for name, m := range s.Types[typ] {
+		if d, ok := docs[name]; ok {
+			m.Signature, m.Params, m.Doc = d.Signature, d.Params, d.Doc
+		}
+	}
+}
+
+// Names returns the sorted member names of a type
+func (s *Symbols) Names(typ string) []string {
+	var names []string
+	for name := range s.Types[typ] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseOutline reads method documentation from a package outline comment. Outlines
+// list methods under a "methods:" heading, each signature followed by indented
+// documentation:
+//
+//	methods:
+//	  get_meta() dict|None
+//	    get dataset meta component
+func ParseOutline(text string) map[string]*Member {
+	docs := map[string]*Member{}
+	// indentation of the current section heading & its signatures, -1 when
+	// outside of a section
+	section, sigIndent := -1, -1
+	var current *Member
+
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " \t"))
+
+		if trimmed == "methods:" || trimmed == "functions:" {
+			section, sigIndent, current = indent, -1, nil
+			continue
+		}
+		if section < 0 {
+			continue
+		}
+
+		switch {
+		case indent <= section:
+			// outdented past the section heading
+			section, current = -1, nil
+		case sigIndent < 0 || indent <= sigIndent:
+			sigIndent = indent
+			if current = parseSignature(trimmed); current != nil {
+				docs[current.Name] = current
+			}
+		case current != nil:
+			if current.Doc != "" {
+				current.Doc += " "
+			}
+			current.Doc += trimmed
+		}
+	}
+	return docs
+}
+
+// parseSignature parses a documented signature like "name(a, b? string) ret"
+func parseSignature(sig string) *Member {
+	open := strings.Index(sig, "(")
+	end := strings.LastIndex(sig, ")")
+	if open <= 0 || end < open {
+		return nil
+	}
+	m := &Member{Name: sig[:open], Signature: sig}
+	if params := strings.TrimSpace(sig[open+1 : end]); params != "" {
+		for _, p := range strings.Split(params, ",") {
+			m.Params = append(m.Params, strings.TrimSpace(p))
+		}
+	}
+	return m
+}
@@ -0,0 +1,71 @@
+package lsp
+
+import (
+	"go/parser"
+	"go/token"
+	"testing"
+)
+
+func TestParseOutline(t *testing.T) {
+	text := `outline: example
+  types:
+    Thing
+      a thing
+      methods:
+        get(key string, default?) value|None
+          get a value
+          by key
+        clear()
+          remove all values
+  functions:
+    new() Thing
+      create a thing
+`
+	docs := ParseOutline(text)
+	if len(docs) != 3 {
+		t.Fatalf("expected 3 documented members, got %d", len(docs))
+	}
+
+	get := docs["get"]
+	if get.Signature != "get(key string, default?) value|None" {
+		t.Errorf("signature mismatch. got: %q", get.Signature)
+	}
+	if len(get.Params) != 2 || get.Params[0] != "key string" || get.Params[1] != "default?" {
+		t.Errorf("params mismatch. got: %v", get.Params)
+	}
+	if get.Doc != "get a value by key" {
+		t.Errorf("doc mismatch. got: %q", get.Doc)
+	}
+	if docs["clear"].Params != nil {
+		t.Errorf("expected clear to have no params, got: %v", docs["clear"].Params)
+	}
+	if docs["new"].Doc != "create a thing" {
+		t.Errorf("doc mismatch. got: %q", docs["new"].Doc)
+	}
+}
+
+func TestDatasetOutline(t *testing.T) {
+	s := NewSymbols()
+	for _, name := range s.Names(TypeDataset) {
+		if s.Types[TypeDataset][name].Doc == "" {
+			t.Errorf("dataset method %s is missing from the ds package outline", name)
+		}
+	}
+}
+
+func TestPackageDocsCurrent(t *testing.T) {
+	files := map[string]string{
+		TypeDataset: "../ds/doc.go",
+		TypeContext: "../context/doc.go",
+		TypeQri:     "../qri/doc.go",
+	}
+	for typ, path := range files {
+		f, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.PackageClauseOnly|parser.ParseComments)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if packageDocs[typ] != f.Doc.Text() {
+			t.Errorf("embedded docs for %s are out of date with %s, run go generate ./lsp", typ, path)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package startf
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Timing summarizes time spent on one kind of work during script execution
+type Timing struct {
+	Name  string
+	Calls int
+	Total time.Duration
+}
+
+// timer accumulates timings. http requests can be timed from other goroutines,
+// so timers are safe for concurrent use. Methods are no-ops on a nil timer
+type timer struct {
+	lock    sync.Mutex
+	timings map[string]*Timing
+}
+
+func newTimer() *timer {
+	return &timer{timings: map[string]*Timing{}}
+}
+
+// record adds a duration to the named timing
+func (t *timer) record(name string, d time.Duration) {
+	if t == nil {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	tm, ok := t.timings[name]
+	if !ok {
+		tm = &Timing{Name: name}
+		t.timings[name] = tm
+	}
+	tm.Calls++
+	tm.Total += d
+}
+
+// since records time elapsed since start, intended to be deferred:
+// defer t.since("name", time.Now())
+func (t *timer) since(name string, start time.Time) {
+	t.record(name, time.Since(start))
+}
+
+// Timings lists recorded timings, longest total first
+func (t *timer) Timings() []Timing {
+	if t == nil {
+		return nil
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	timings := make([]Timing, 0, len(t.timings))
+	for _, tm := range t.timings {
+		timings = append(timings, *tm)
+	}
+	sort.Slice(timings, func(i, j int) bool {
+		if timings[i].Total == timings[j].Total {
+			return timings[i].Name < timings[j].Name
+		}
+		return timings[i].Total > timings[j].Total
+	})
+	return timings
+}
+
+// WriteTimings writes a table summarizing where script execution spent its time.
+// Step timings include time spent in the body conversion & http calls made
+// during that step
+func (r *ExecResult) WriteTimings(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tCALLS\tTOTAL\tAVERAGE")
+	for _, tm := range r.Timings {
+		avg := tm.Total
+		if tm.Calls > 0 {
+			avg = tm.Total / time.Duration(tm.Calls)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", tm.Name, tm.Calls, tm.Total, avg)
+	}
+	return tw.Flush()
+}
+
+// timingTransport records the duration of http requests, from sending a request
+// until its response body is read to the end or closed
+type timingTransport struct {
+	Base  http.RoundTripper
+	timer *timer
+}
+
+// RoundTrip implements the http.RoundTripper interface
+func (t *timingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	res, err := t.Base.RoundTrip(req)
+	if err != nil || res.Body == nil {
+		t.timer.since("http", start)
+		return res, err
+	}
+	res.Body = &timedBody{ReadCloser: res.Body, done: func() { t.timer.since("http", start) }}
+	return res, nil
+}
+
+// timedBody calls done once, when the body is read to the end, fails or is closed
+type timedBody struct {
+	io.ReadCloser
+	once sync.Once
+	done func()
+}
+
+func (b *timedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil {
+		b.once.Do(b.done)
+	}
+	return n, err
+}
+
+func (b *timedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.done)
+	return err
+}
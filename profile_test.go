@@ -0,0 +1,138 @@
+package startf
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/qri-io/dataset"
+	"github.com/qri-io/qfs"
+	"github.com/qri-io/startf/httpfixture"
+)
+
+func TestProfile(t *testing.T) {
+	s := httpfixture.NewServer([]*httpfixture.Route{
+		{Path: "/", Body: `{"foo":["bar","baz","bat"]}`},
+	})
+	defer s.Close()
+
+	ds := &dataset.Dataset{
+		Transform: &dataset.Transform{},
+	}
+	ds.Transform.SetScriptFile(scriptFile(t, "testdata/fetch.star"))
+
+	profile := &bytes.Buffer{}
+	res := &ExecResult{}
+	if err := ExecScript(ds, nil, AddGlobals(s.Globals()), SetProfile(profile), SetExecResult(res)); err != nil {
+		t.Fatal(err)
+	}
+
+	if profile.Len() == 0 {
+		t.Error("expected a profile to be written")
+	}
+
+	calls := map[string]int{}
+	for _, tm := range res.Timings {
+		calls[tm.Name] = tm.Calls
+	}
+	for _, name := range []string{"download", "transform", "http", "set_body"} {
+		if calls[name] != 1 {
+			t.Errorf("expected one %q timing, got: %v", name, res.Timings)
+		}
+	}
+}
+
+func TestProfileFailure(t *testing.T) {
+	ds := &dataset.Dataset{
+		Transform: &dataset.Transform{},
+	}
+	ds.Transform.SetScriptFile(qfs.NewMemfileBytes("fail.star", []byte("def transform(ds, ctx):\n  error('fail')\n")))
+
+	res := &ExecResult{}
+	if err := ExecScript(ds, nil, SetProfile(&bytes.Buffer{}), SetExecResult(res)); err == nil {
+		t.Fatal("expected an error")
+	}
+	if len(res.Steps) != 1 || res.Steps[0] != "transform" {
+		t.Errorf("expected the failed transform step to be recorded, got: %v", res.Steps)
+	}
+	if len(res.Timings) != 1 || res.Timings[0].Name != "transform" {
+		t.Errorf("expected a timing for the failed transform, got: %v", res.Timings)
+	}
+}
+
+func TestTimingTransportBody(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("head"))
+		w.(http.Flusher).Flush()
+		time.Sleep(50 * time.Millisecond)
+		w.Write([]byte("tail"))
+	}))
+	defer s.Close()
+
+	tm := newTimer()
+	cli := &http.Client{Transport: &timingTransport{Base: http.DefaultTransport, timer: tm}}
+	res, err := cli.Get(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tm.Timings()) != 0 {
+		t.Errorf("expected requests not to be timed until the body is read, got: %v", tm.Timings())
+	}
+	if _, err := ioutil.ReadAll(res.Body); err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	timings := tm.Timings()
+	if len(timings) != 1 || timings[0].Calls != 1 {
+		t.Fatalf("expected one http timing, got: %v", timings)
+	}
+	if timings[0].Total < 50*time.Millisecond {
+		t.Errorf("expected http timing to include reading the body, got: %s", timings[0].Total)
+	}
+}
+
+func TestNoProfile(t *testing.T) {
+	ds := &dataset.Dataset{
+		Transform: &dataset.Transform{},
+	}
+	ds.Transform.SetScriptFile(scriptFile(t, "testdata/tf.star"))
+
+	res := &ExecResult{}
+	if err := ExecScript(ds, nil, SetExecResult(res)); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Timings) != 0 {
+		t.Errorf("expected no timings without profiling, got: %v", res.Timings)
+	}
+}
+
+func TestWriteTimings(t *testing.T) {
+	tm := newTimer()
+	tm.record("get_body", time.Second)
+	tm.record("transform", 3*time.Second)
+	tm.record("get_body", time.Second)
+
+	res := &ExecResult{Timings: tm.Timings()}
+	buf := &bytes.Buffer{}
+	if err := res.WriteTimings(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	expect := `NAME       CALLS  TOTAL  AVERAGE
+transform  1      3s     3s
+get_body   2      2s     1s
+`
+	if buf.String() != expect {
+		t.Errorf("table mismatch. expected:\n%s\ngot:\n%s", expect, buf.String())
+	}
+
+	var nilTimer *timer
+	nilTimer.record("ignored", time.Second)
+	if nilTimer.Timings() != nil {
+		t.Error("expected a nil timer to record nothing")
+	}
+}
@@ -0,0 +1,14 @@
+/*Package qri defines the qri module within starlark
+
+  outline: qri
+    qri exposes a qri node to transform scripts. load it with
+    load("qri.star", "qri")
+
+    types:
+      qri
+        the qri module
+        methods:
+          list_datasets() list
+            list references to datasets in the local qri repo
+*/
+package qri
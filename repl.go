@@ -0,0 +1,64 @@
+package startf
+
+import (
+	"fmt"
+
+	"github.com/qri-io/dataset"
+	skyctx "github.com/qri-io/startf/context"
+	skyds "github.com/qri-io/startf/ds"
+	"github.com/qri-io/startf/fetch"
+	skyqri "github.com/qri-io/startf/qri"
+	"go.starlark.net/starlark"
+)
+
+// NewREPL prepares a thread & globals for exploring a dataset interactively,
+// with the same builtins & module loaders ExecScript provides. ds is bound to a
+// dataset that reads from prev & writes to next, and ctx to a context with config
+// and any secrets set in opts. Print output is written to the OutWriter option
+func NewREPL(next, prev *dataset.Dataset, config map[string]interface{}, opts ...func(o *ExecOpts)) (*starlark.Thread, starlark.StringDict) {
+	o := &ExecOpts{}
+	DefaultExecOpts(o)
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	hoistOpts(o)
+
+	if prev == nil {
+		prev = &dataset.Dataset{}
+	}
+	if next == nil {
+		next = &dataset.Dataset{}
+	}
+
+	t := &transform{
+		node:         o.Node,
+		next:         next,
+		prev:         prev,
+		skyqri:       skyqri.NewModule(o.Node),
+		checkFunc:    o.MutateFieldCheck,
+		stderr:       o.OutWriter,
+		moduleLoader: o.ModuleLoader,
+		specials:     o.SpecialFuncs,
+		http:         newHTTPTransport(o),
+	}
+	// the REPL's http route stays open for as long as the thread can be used
+	t.fetch = fetch.NewModule(t.client(), httpGuard)
+
+	thread := &starlark.Thread{
+		Load: t.ModuleLoader,
+		Print: func(thread *starlark.Thread, msg string) {
+			fmt.Fprintln(t.stderr, msg)
+		},
+	}
+
+	d := skyds.NewDataset(prev, o.MutateFieldCheck)
+	d.SetMutable(next)
+	d.SetVersionLoader(t.loadVersion)
+	d.SetBodyOpener(t.bodyOpener())
+
+	globals := t.locals()
+	globals["ds"] = d.Methods()
+	globals["ctx"] = skyctx.NewContext(config, o.Secrets).Struct()
+	return thread, globals
+}
@@ -0,0 +1,71 @@
+package startf
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/qri-io/dataset"
+	"github.com/qri-io/qfs"
+	"go.starlark.net/starlark"
+)
+
+func TestNewREPL(t *testing.T) {
+	prev := &dataset.Dataset{
+		Meta:      &dataset.Meta{Title: "previous"},
+		Structure: &dataset.Structure{Format: "json", Schema: dataset.BaseSchemaArray},
+	}
+	prev.SetBodyFile(qfs.NewMemfileBytes("body.json", []byte(`[1,2,3]`)))
+	next := &dataset.Dataset{}
+
+	out := &bytes.Buffer{}
+	thread, globals := NewREPL(next, prev, map[string]interface{}{"greeting": "hi"}, SetOutWriter(out))
+
+	// each statement runs against the globals of the ones before it, as in a repl
+	lines := []string{
+		`load("time.star", "time")`,
+		`print(ds.get_meta()["title"], ctx.get_config("greeting"))`,
+		`body = ds.get_body()`,
+		`print(len(body), body[0], type(time.now))`,
+		`ds.set_body([x * 2 for x in body])`,
+		`ds.set_meta("title", "next")`,
+	}
+	for _, line := range lines {
+		vals, err := starlark.ExecFile(thread, "<stdin>", line, globals)
+		if err != nil {
+			t.Fatalf("%q: %s", line, err)
+		}
+		for k, v := range vals {
+			globals[k] = v
+		}
+	}
+
+	if expect := "previous hi\n3 1 builtin_function_or_method\n"; out.String() != expect {
+		t.Errorf("output mismatch. expected: %q, got: %q", expect, out.String())
+	}
+	if next.Meta == nil || next.Meta.Title != "next" {
+		t.Errorf("expected ds.set_meta to write to the next dataset, got: %v", next.Meta)
+	}
+	if next.BodyFile() == nil {
+		t.Errorf("expected ds.set_body to write a body to the next dataset")
+	}
+	if _, ok := globals["load_dataset"]; !ok {
+		t.Errorf("expected load_dataset to be defined")
+	}
+}
+
+func TestLoadRef(t *testing.T) {
+	prev, err := LoadRef(testQriNode(t), "peer/movies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prev.Meta == nil || prev.Meta.Title != "example movie data" {
+		t.Errorf("expected movies dataset meta, got: %v", prev.Meta)
+	}
+	if prev.BodyFile() == nil {
+		t.Error("expected an open body file")
+	}
+
+	if _, err := LoadRef(nil, "peer/movies"); err == nil {
+		t.Error("expected an error loading a ref without a node")
+	}
+}
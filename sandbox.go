@@ -3,12 +3,20 @@ package startf
 import (
 	"fmt"
 	"net/http"
+	"strconv"
+	"sync"
 
 	starhttp "github.com/qri-io/starlib/http"
+	"github.com/qri-io/startf/httpcache"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
 )
 
 var (
 	httpGuard = &HTTPGuard{}
+	// httpRoute sends script http requests to the transport of the script making them
+	httpRoute  = &routeTransport{routes: map[string]http.RoundTripper{}}
+	httpClient = &http.Client{Transport: httpRoute}
 	// ErrNtwkDisabled is returned whenever a network call is attempted but h.NetworkEnabled is false
 	ErrNtwkDisabled = fmt.Errorf("network use is disabled. http can only be used during download step")
 )
@@ -36,7 +44,137 @@ func (h *HTTPGuard) DisableNtwk() {
 	h.NetworkEnabled = false
 }
 
+// newHTTPTransport creates the transport a script's http requests are sent to
+func newHTTPTransport(o *ExecOpts) *httpcache.Transport {
+	return &httpcache.Transport{Cache: o.HTTPCache, Base: http.DefaultTransport, Log: o.OutWriter}
+}
+
+// routeHeader is the request header that names the route a request is sent to.
+// routeTransport removes it before requests are sent
+const routeHeader = "X-Startf-Route"
+
+// routeTransport is the transport of the http client the starlib http module
+// uses. Each script has its own transport with its own cache, so builtins of the
+// http module are wrapped to add a header naming the script's route to their
+// requests, which routeTransport sends to that script's transport
+type routeTransport struct {
+	lock   sync.RWMutex
+	next   int
+	routes map[string]http.RoundTripper
+}
+
+// RoundTrip implements the http.RoundTripper interface
+func (r *routeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	id := req.Header.Get(routeHeader)
+	if id == "" {
+		return http.DefaultTransport.RoundTrip(req)
+	}
+	r.lock.RLock()
+	rt, ok := r.routes[id]
+	r.lock.RUnlock()
+	if !ok {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return nil, fmt.Errorf("http route %s is closed", id)
+	}
+
+	// shallow copy the request, RoundTrippers should not modify requests
+	routed := new(http.Request)
+	*routed = *req
+	routed.Header = make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		routed.Header[k] = v
+	}
+	routed.Header.Del(routeHeader)
+	return rt.RoundTrip(routed)
+}
+
+// add creates a route that sends requests to rt, returning the route's id
+func (r *routeTransport) add(rt http.RoundTripper) string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.next++
+	id := strconv.Itoa(r.next)
+	r.routes[id] = rt
+	return id
+}
+
+// remove closes a route. removing a route that doesn't exist is a no-op
+func (r *routeTransport) remove(id string) {
+	r.lock.Lock()
+	delete(r.routes, id)
+	r.lock.Unlock()
+}
+
+// routeModule wraps the builtins of a module namespace, including builtins of
+// structs, so the requests they make are sent to the route with id
+func routeModule(ns starlark.StringDict, id string) starlark.StringDict {
+	routed := make(starlark.StringDict, len(ns))
+	for name, val := range ns {
+		routed[name] = routeValue(val, id)
+	}
+	return routed
+}
+
+func routeValue(v starlark.Value, id string) starlark.Value {
+	switch x := v.(type) {
+	case *starlark.Builtin:
+		return starlark.NewBuiltin(x.Name(), func(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			args, kwargs = routeArgs(id, args, kwargs)
+			return x.CallInternal(thread, args, kwargs)
+		})
+	case *starlarkstruct.Struct:
+		members := starlark.StringDict{}
+		x.ToStringDict(members)
+		return starlarkstruct.FromStringDict(x.Constructor(), routeModule(members, id))
+	}
+	return v
+}
+
+// routeArgs adds the route header to the arguments of a starlib http builtin,
+// which takes request headers as its third argument
+func routeArgs(id string, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Tuple, []starlark.Tuple) {
+	if len(args) > 2 {
+		args = append(starlark.Tuple{}, args...)
+		args[2] = routeHeaders(id, args[2])
+		return args, kwargs
+	}
+
+	routed := make([]starlark.Tuple, 0, len(kwargs)+1)
+	found := false
+	for _, kw := range kwargs {
+		if name, _ := kw[0].(starlark.String); name == "headers" {
+			kw = starlark.Tuple{kw[0], routeHeaders(id, kw[1])}
+			found = true
+		}
+		routed = append(routed, kw)
+	}
+	if !found {
+		routed = append(routed, starlark.Tuple{starlark.String("headers"), routeHeaders(id, &starlark.Dict{})})
+	}
+	return args, routed
+}
+
+// routeHeaders copies a headers dict, adding the route header. values that
+// aren't dicts are left for the builtin to report
+func routeHeaders(id string, v starlark.Value) starlark.Value {
+	d, ok := v.(*starlark.Dict)
+	if !ok {
+		return v
+	}
+	headers := &starlark.Dict{}
+	for _, kv := range d.Items() {
+		// keys of a dict are hashable, so copying them can't fail
+		_ = headers.SetKey(kv[0], kv[1])
+	}
+	_ = headers.SetKey(starlark.String(routeHeader), starlark.String(id))
+	return headers
+}
+
 func init() {
 	// connect httpGuard instance to starlib http guard
 	starhttp.Guard = httpGuard
+	// route starlib http requests to the transport of the script making them
+	starhttp.Client = httpClient
 }
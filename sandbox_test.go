@@ -0,0 +1,157 @@
+package startf
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+)
+
+// namedTransport responds to every request with its name & the value of the
+// request's "A" header
+type namedTransport string
+
+func (n namedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get(routeHeader) != "" {
+		return nil, fmt.Errorf("route header wasn't removed")
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(strings.NewReader(string(n) + req.Header.Get("A"))),
+		Request:    req,
+	}, nil
+}
+
+// blockingTransport waits for release before responding
+type blockingTransport chan struct{}
+
+func (b blockingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	<-b
+	return namedTransport("blocked").RoundTrip(req)
+}
+
+// httpModule mimics the starlib http module, which sends requests with the
+// package http client
+var httpModule = starlark.StringDict{
+	"http": starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"get": starlark.NewBuiltin("get", func(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var (
+				url     string
+				params  = &starlark.Dict{}
+				headers = &starlark.Dict{}
+			)
+			if err := starlark.UnpackArgs("get", args, kwargs, "url", &url, "params?", &params, "headers?", &headers); err != nil {
+				return nil, err
+			}
+			req, err := http.NewRequest("GET", url, nil)
+			if err != nil {
+				return nil, err
+			}
+			for _, kv := range headers.Items() {
+				req.Header.Add(string(kv[0].(starlark.String)), string(kv[1].(starlark.String)))
+			}
+			res, err := httpClient.Do(req)
+			if err != nil {
+				return nil, err
+			}
+			defer res.Body.Close()
+			data, err := ioutil.ReadAll(res.Body)
+			return starlark.String(data), err
+		}),
+	}),
+}
+
+func routedScript(id, script string) (starlark.StringDict, error) {
+	return starlark.ExecFile(&starlark.Thread{}, "route.star", script, routeModule(httpModule, id))
+}
+
+func TestRouteModule(t *testing.T) {
+	// concurrent scripts each get responses from their own transport
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			id := httpRoute.add(namedTransport(name))
+			defer httpRoute.remove(id)
+
+			script := `
+url = 'http://example.com'
+res = [http.get(url) for i in range(20)]
+res.append(http.get(url, {}, {'A': '_a'}))
+res.append(http.get(url, headers={'A': '_a'}))
+`
+			globals, err := routedScript(id, script)
+			if err != nil {
+				errs <- err
+				return
+			}
+			res := globals["res"].(*starlark.List)
+			for i := 0; i < res.Len(); i++ {
+				expect := name
+				if i >= 20 {
+					expect = name + "_a"
+				}
+				if got := string(res.Index(i).(starlark.String)); got != expect {
+					errs <- fmt.Errorf("%s: expected response %q, got: %q", name, expect, got)
+					return
+				}
+			}
+		}(fmt.Sprintf("script_%d", i))
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestRouteModuleConcurrentRequests(t *testing.T) {
+	release := make(blockingTransport)
+	blocked := httpRoute.add(release)
+	defer httpRoute.remove(blocked)
+	done := make(chan error)
+	go func() {
+		_, err := routedScript(blocked, "res = http.get('http://example.com')\n")
+		done <- err
+	}()
+
+	// a script waiting on a slow request doesn't hold up other scripts
+	id := httpRoute.add(namedTransport("free"))
+	defer httpRoute.remove(id)
+	finished := make(chan error)
+	go func() {
+		_, err := routedScript(id, "res = http.get('http://example.com')\n")
+		finished <- err
+	}()
+	select {
+	case err := <-finished:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("expected a request to complete while another script's request is blocked")
+	}
+
+	close(release)
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRouteClosed(t *testing.T) {
+	id := httpRoute.add(namedTransport("closed"))
+	httpRoute.remove(id)
+	_, err := routedScript(id, "res = http.get('http://example.com')\n")
+	if err == nil || !strings.Contains(err.Error(), "http route "+id+" is closed") {
+		t.Errorf("expected closed route error, got: %v", err)
+	}
+}
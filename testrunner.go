@@ -0,0 +1,478 @@
+package startf
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/qri-io/dataset"
+	"github.com/qri-io/starlib/util"
+	skyctx "github.com/qri-io/startf/context"
+	skyds "github.com/qri-io/startf/ds"
+	"github.com/qri-io/startf/fetch"
+	skyqri "github.com/qri-io/startf/qri"
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+	"go.starlark.net/starlarktest"
+)
+
+// TestFuncPrefix prefixes the names of functions RunTests will call
+const TestFuncPrefix = "test_"
+
+// TestFilePath gives the conventional test file path for a transform script,
+// eg: "transform.star" becomes "transform_test.star"
+func TestFilePath(scriptPath string) string {
+	ext := filepath.Ext(scriptPath)
+	return strings.TrimSuffix(scriptPath, ext) + "_test" + ext
+}
+
+// TestResult is the outcome of calling a single test function
+type TestResult struct {
+	Name     string
+	Failures []string
+	Output   string
+	Duration time.Duration
+}
+
+// Passed reports whether the test had no failures
+func (r *TestResult) Passed() bool {
+	return len(r.Failures) == 0
+}
+
+// Error implements the starlarktest Reporter interface, recording a failure
+func (r *TestResult) Error(args ...interface{}) {
+	r.Failures = append(r.Failures, fmt.Sprint(args...))
+}
+
+// TestResults collects the results of running a test file
+type TestResults struct {
+	File     string
+	Tests    []*TestResult
+	Duration time.Duration
+}
+
+// Passed reports whether all tests passed
+func (r *TestResults) Passed() bool {
+	for _, t := range r.Tests {
+		if !t.Passed() {
+			return false
+		}
+	}
+	return true
+}
+
+// Failures counts failed tests
+func (r *TestResults) Failures() (n int) {
+	for _, t := range r.Tests {
+		if !t.Passed() {
+			n++
+		}
+	}
+	return n
+}
+
+// WriteGoTest writes results in the output format of "go test -v", which is
+// understood by tools like go-junit-report
+func (r *TestResults) WriteGoTest(w io.Writer) error {
+	buf := &bytes.Buffer{}
+	for _, t := range r.Tests {
+		fmt.Fprintf(buf, "=== RUN   %s\n", t.Name)
+		status := "PASS"
+		if !t.Passed() {
+			status = "FAIL"
+		}
+		fmt.Fprintf(buf, "--- %s: %s (%.2fs)\n", status, t.Name, t.Duration.Seconds())
+		for _, line := range strings.Split(strings.TrimRight(t.Output, "\n"), "\n") {
+			if line != "" {
+				fmt.Fprintf(buf, "    %s\n", line)
+			}
+		}
+		for _, f := range t.Failures {
+			fmt.Fprintf(buf, "    %s\n", strings.Replace(f, "\n", "\n    ", -1))
+		}
+	}
+
+	if r.Passed() {
+		fmt.Fprintf(buf, "PASS\nok  \t%s\t%.3fs\n", r.File, r.Duration.Seconds())
+	} else {
+		fmt.Fprintf(buf, "FAIL\nFAIL\t%s\t%.3fs\n", r.File, r.Duration.Seconds())
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Time      string          `xml:"time,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Classname string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message  string `xml:"message,attr"`
+	Contents string `xml:",chardata"`
+}
+
+// WriteJUnit writes results as JUnit XML
+func (r *TestResults) WriteJUnit(w io.Writer) error {
+	suite := junitTestSuite{
+		Name:     r.File,
+		Tests:    len(r.Tests),
+		Failures: r.Failures(),
+		Time:     fmt.Sprintf("%.3f", r.Duration.Seconds()),
+	}
+	for _, t := range r.Tests {
+		tc := junitTestCase{
+			Classname: r.File,
+			Name:      t.Name,
+			Time:      fmt.Sprintf("%.3f", t.Duration.Seconds()),
+			SystemOut: t.Output,
+		}
+		if !t.Passed() {
+			tc.Failure = &junitFailure{Message: "Failed", Contents: strings.Join(t.Failures, "\n")}
+		}
+		suite.TestCases = append(suite.TestCases, tc)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "\t")
+	if err := enc.Encode(junitTestSuites{Suites: []junitTestSuite{suite}}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// RunTests executes a starlark test file against a transform script. Globals defined
+// by the transform script, including special functions, are available to the test
+// file. Every function in the test file with a name starting with "test_" is called
+// with a fixtures struct that provides:
+//
+//	t.dataset(meta=None, structure=None, body=None) - a dataset with a mock previous version
+//	t.context(config=None, secrets=None, results=None) - a transform context
+//	t.mock_http(url, body, status=200, headers=None) - a canned http response for url
+//	t.error(msg) - record a test failure without halting the test
+//
+// Assertions from "assert.star" report failures to the running test. If testPath is
+// empty the conventional test path for scriptPath is used
+func RunTests(scriptPath, testPath string, opts ...func(o *ExecOpts)) (*TestResults, error) {
+	if testPath == "" {
+		testPath = TestFilePath(scriptPath)
+	}
+
+	o := &ExecOpts{}
+	DefaultExecOpts(o)
+	for _, opt := range opts {
+		opt(o)
+	}
+	hoistOpts(o)
+
+	script, err := ioutil.ReadFile(scriptPath)
+	if err != nil {
+		return nil, err
+	}
+	tests, err := ioutil.ReadFile(testPath)
+	if err != nil {
+		return nil, err
+	}
+
+	next := &dataset.Dataset{Transform: &dataset.Transform{}}
+	output := &bytes.Buffer{}
+	t := &transform{
+		node:         o.Node,
+		next:         next,
+		skyqri:       skyqri.NewModule(o.Node),
+		checkFunc:    o.MutateFieldCheck,
+		stderr:       output,
+		moduleLoader: testModuleLoader(o.ModuleLoader),
+		http:         newHTTPTransport(o),
+	}
+	t.fetch = fetch.NewModule(t.client(), httpGuard)
+	defer t.closeRoute()
+
+	thread := t.testThread(nil, output)
+	t.globals, err = starlark.ExecFile(thread, scriptPath, script, t.locals())
+	if err != nil {
+		return nil, newTransformError(thread, "", err)
+	}
+
+	predeclared := t.locals()
+	for name, val := range t.globals {
+		predeclared[name] = val
+	}
+	testGlobals, err := starlark.ExecFile(thread, testPath, tests, predeclared)
+	if err != nil {
+		return nil, newTransformError(thread, "", err)
+	}
+
+	results := &TestResults{File: testPath}
+	start := time.Now()
+	for _, name := range testGlobals.Keys() {
+		fn, ok := testGlobals[name].(*starlark.Function)
+		if !ok || !strings.HasPrefix(name, TestFuncPrefix) {
+			continue
+		}
+		results.Tests = append(results.Tests, t.runTest(name, fn))
+	}
+	results.Duration = time.Since(start)
+
+	return results, nil
+}
+
+// testThread creates a thread that reports assertion failures to res & writes print
+// output to w
+func (t *transform) testThread(res *TestResult, w io.Writer) *starlark.Thread {
+	thread := &starlark.Thread{
+		Load: t.ModuleLoader,
+		Print: func(thread *starlark.Thread, msg string) {
+			fmt.Fprintln(w, msg)
+		},
+	}
+	if res != nil {
+		starlarktest.SetReporter(thread, res)
+	}
+	return thread
+}
+
+// runTest calls a single test function with network access limited to mock responses
+func (t *transform) runTest(name string, fn *starlark.Function) *TestResult {
+	res := &TestResult{Name: name}
+	output := &bytes.Buffer{}
+	t.stderr = output
+	thread := t.testThread(res, output)
+
+	mocks := &mockTransport{responses: map[string]*mockResponse{}}
+	base, cache := t.http.Base, t.http.Cache
+	t.http.Base, t.http.Cache = mocks, nil
+	httpGuard.EnableNtwk()
+	defer func() {
+		t.http.Base, t.http.Cache = base, cache
+		httpGuard.DisableNtwk()
+	}()
+
+	var args starlark.Tuple
+	if fn.NumParams() > 0 {
+		args = starlark.Tuple{t.fixtures(res, mocks)}
+	}
+
+	start := time.Now()
+	if _, err := starlark.Call(thread, fn, args, nil); err != nil {
+		res.Error(newTransformError(thread, name, err).Error())
+	}
+	res.Duration = time.Since(start)
+	res.Output = output.String()
+	return res
+}
+
+// testModuleLoader adds the starlarktest assert module to a module loader
+func testModuleLoader(loader ModuleLoader) ModuleLoader {
+	return func(thread *starlark.Thread, module string) (starlark.StringDict, error) {
+		if module == "assert.star" {
+			return starlarktest.LoadAssertModule()
+		}
+		if loader == nil {
+			return nil, fmt.Errorf("couldn't load module: %s", module)
+		}
+		return loader(thread, module)
+	}
+}
+
+// fixtures creates the struct passed to test functions
+func (t *transform) fixtures(res *TestResult, mocks *mockTransport) *starlarkstruct.Struct {
+	return starlarkstruct.FromStringDict(starlark.String("fixtures"), starlark.StringDict{
+		"dataset":   starlark.NewBuiltin("dataset", t.mockDataset),
+		"context":   starlark.NewBuiltin("context", mockContext),
+		"mock_http": starlark.NewBuiltin("mock_http", mocks.add),
+		"error": starlark.NewBuiltin("error", func(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var msg starlark.Value
+			if err := starlark.UnpackPositionalArgs("error", args, kwargs, 1, &msg); err != nil {
+				return starlark.None, err
+			}
+			if s, ok := starlark.AsString(msg); ok {
+				res.Error(s)
+			} else {
+				res.Error(msg.String())
+			}
+			return starlark.None, nil
+		}),
+	})
+}
+
+// mockDataset creates a writable dataset with a previous version built from arguments
+func (t *transform) mockDataset(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var meta, structure, body starlark.Value
+	if err := starlark.UnpackArgs("dataset", args, kwargs, "meta?", &meta, "structure?", &structure, "body?", &body); err != nil {
+		return starlark.None, err
+	}
+
+	prev := &dataset.Dataset{}
+	if meta != nil && meta != starlark.None {
+		prev.Meta = &dataset.Meta{}
+		if err := unmarshalInto(meta, prev.Meta); err != nil {
+			return starlark.None, fmt.Errorf("invalid meta: %s", err)
+		}
+	}
+	if structure != nil && structure != starlark.None {
+		prev.Structure = &dataset.Structure{}
+		if err := unmarshalInto(structure, prev.Structure); err != nil {
+			return starlark.None, fmt.Errorf("invalid structure: %s", err)
+		}
+	}
+	if body != nil && body != starlark.None {
+		if prev.Structure == nil {
+			sch := dataset.BaseSchemaArray
+			if body.Type() == "dict" {
+				sch = dataset.BaseSchemaObject
+			}
+			prev.Structure = &dataset.Structure{Format: "json", Schema: sch}
+		}
+
+		iter, ok := body.(starlark.Iterable)
+		if !ok {
+			return starlark.None, fmt.Errorf("expected body data to be iterable")
+		}
+		d := skyds.NewDataset(nil, nil)
+		d.SetMutable(prev)
+		if _, err := d.SetBody(thread, nil, starlark.Tuple{iter}, nil); err != nil {
+			return starlark.None, err
+		}
+	}
+
+	d := skyds.NewDataset(prev, t.checkFunc)
+	d.SetMutable(&dataset.Dataset{})
+	d.SetVersionLoader(t.loadVersion)
+	d.SetBodyOpener(t.bodyOpener())
+	return d.Methods(), nil
+}
+
+// mockContext creates a transform context from arguments
+func mockContext(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var config, secrets, results starlark.Value
+	if err := starlark.UnpackArgs("context", args, kwargs, "config?", &config, "secrets?", &secrets, "results?", &results); err != nil {
+		return starlark.None, err
+	}
+
+	cfg := map[string]interface{}{}
+	if config != nil && config != starlark.None {
+		if err := unmarshalInto(config, &cfg); err != nil {
+			return starlark.None, fmt.Errorf("invalid config: %s", err)
+		}
+	}
+	secretsMap := map[string]interface{}{}
+	if secrets != nil && secrets != starlark.None {
+		if err := unmarshalInto(secrets, &secretsMap); err != nil {
+			return starlark.None, fmt.Errorf("invalid secrets: %s", err)
+		}
+	}
+
+	ctx := skyctx.NewContext(cfg, secretsMap)
+	if results != nil && results != starlark.None {
+		dict, ok := results.(*starlark.Dict)
+		if !ok {
+			return starlark.None, fmt.Errorf("results must be a dict")
+		}
+		for _, kv := range dict.Items() {
+			name, ok := starlark.AsString(kv[0])
+			if !ok {
+				return starlark.None, fmt.Errorf("result names must be strings")
+			}
+			ctx.SetResult(name, kv[1])
+		}
+	}
+	return ctx.Struct(), nil
+}
+
+// unmarshalInto decodes a starlark value into a go value by way of json
+func unmarshalInto(v starlark.Value, dst interface{}) error {
+	val, err := util.Unmarshal(v)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(val)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dst)
+}
+
+type mockResponse struct {
+	status  int
+	body    string
+	headers map[string]string
+}
+
+// mockTransport serves canned http responses by url, failing all other requests
+type mockTransport struct {
+	responses map[string]*mockResponse
+}
+
+func (m *mockTransport) add(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var (
+		url, body string
+		status    = 200
+		headers   = &starlark.Dict{}
+	)
+	if err := starlark.UnpackArgs("mock_http", args, kwargs, "url", &url, "body", &body, "status?", &status, "headers?", &headers); err != nil {
+		return starlark.None, err
+	}
+
+	res := &mockResponse{status: status, body: body, headers: map[string]string{}}
+	for _, kv := range headers.Items() {
+		k, kok := starlark.AsString(kv[0])
+		v, vok := starlark.AsString(kv[1])
+		if !kok || !vok {
+			return starlark.None, fmt.Errorf("mock_http: headers must be a dict of strings")
+		}
+		res.headers[k] = v
+	}
+	m.responses[url] = res
+	return starlark.None, nil
+}
+
+// RoundTrip implements the http.RoundTripper interface
+func (m *mockTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	mock, ok := m.responses[req.URL.String()]
+	if !ok {
+		return nil, fmt.Errorf("no mock response for %s %s", req.Method, req.URL.String())
+	}
+
+	header := http.Header{}
+	for k, v := range mock.headers {
+		header.Set(k, v)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", mock.status, http.StatusText(mock.status)),
+		StatusCode:    mock.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(strings.NewReader(mock.body)),
+		ContentLength: int64(len(mock.body)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,77 @@
+package startf
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRunTests(t *testing.T) {
+	res, err := RunTests("testdata/runner/transform.star", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.File != "testdata/runner/transform_test.star" {
+		t.Errorf("test file mismatch. got: %s", res.File)
+	}
+
+	expect := map[string]int{
+		"test_download":          0,
+		"test_failing_assertion": 2,
+		"test_transform":         0,
+		"test_unmocked_request":  1,
+	}
+	if len(res.Tests) != len(expect) {
+		t.Fatalf("expected %d tests, got: %d", len(expect), len(res.Tests))
+	}
+	for _, tr := range res.Tests {
+		failures, ok := expect[tr.Name]
+		if !ok {
+			t.Errorf("unexpected test: %s", tr.Name)
+			continue
+		}
+		if len(tr.Failures) != failures {
+			t.Errorf("%s: expected %d failures, got: %d %v", tr.Name, failures, len(tr.Failures), tr.Failures)
+		}
+	}
+	if res.Passed() || res.Failures() != 2 {
+		t.Errorf("expected 2 failed tests, got: %d", res.Failures())
+	}
+
+	buf := &bytes.Buffer{}
+	if err := res.WriteGoTest(buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"=== RUN   test_download\n--- PASS: test_download",
+		"--- FAIL: test_failing_assertion",
+		"    about to fail\n",
+		"    custom failure\n",
+		"no mock response for GET http://example.com/missing.json",
+		"FAIL\ttestdata/runner/transform_test.star",
+	} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("expected go test output to contain %q. got:\n%s", s, buf.String())
+		}
+	}
+
+	buf.Reset()
+	if err := res.WriteJUnit(buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		`<testsuite name="testdata/runner/transform_test.star" tests="4" failures="2"`,
+		`<testcase classname="testdata/runner/transform_test.star" name="test_transform"`,
+		`<failure message="Failed">`,
+	} {
+		if !strings.Contains(buf.String(), s) {
+			t.Errorf("expected junit output to contain %q. got:\n%s", s, buf.String())
+		}
+	}
+}
+
+func TestTestFilePath(t *testing.T) {
+	if got := TestFilePath("path/to/transform.star"); got != "path/to/transform_test.star" {
+		t.Errorf("expected path/to/transform_test.star, got: %s", got)
+	}
+}
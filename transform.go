@@ -7,6 +7,10 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/qri-io/dataset"
 	"github.com/qri-io/dataset/dsfs"
@@ -14,11 +18,15 @@ import (
 	"github.com/qri-io/qri/p2p"
 	"github.com/qri-io/qri/repo"
 	"github.com/qri-io/starlib"
+	starhttp "github.com/qri-io/starlib/http"
 	skyctx "github.com/qri-io/startf/context"
 	skyds "github.com/qri-io/startf/ds"
+	"github.com/qri-io/startf/fetch"
+	"github.com/qri-io/startf/httpcache"
 	skyqri "github.com/qri-io/startf/qri"
 	"go.starlark.net/resolve"
 	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
 )
 
 // ExecOpts defines options for execution
@@ -33,6 +41,22 @@ type ExecOpts struct {
 	MutateFieldCheck func(path ...string) error // func that errors if field specified by path is mutated
 	OutWriter        io.Writer                  // provide a writer to record script "stdout" to
 	ModuleLoader     ModuleLoader               // starlark module loader function
+	SpecialFuncs     []SpecialFunc              // special functions to call before transform
+	Result           *ExecResult                // optional result to populate with execution details
+	HTTPCache        *httpcache.Cache           // optional on-disk cache for script http requests, cache errors are written to OutWriter
+	Strict           bool                       // error instead of warn when a script's entry points are missing or misspelled
+	Debugger         *Debugger                  // optional debugger to pause script execution with
+	Profile          io.Writer                  // write a pprof profile of script execution to this writer & record timings
+}
+
+// ExecResult records details of a script execution
+type ExecResult struct {
+	// Steps lists the names of special functions and transform in the order
+	// they were called
+	Steps []string
+	// Timings summarizes time spent in each step, body conversion & http
+	// requests. Only populated when profiling
+	Timings []Timing
 }
 
 // AddQriNodeOpt adds a qri node to execution options
@@ -49,6 +73,15 @@ func AddMutateFieldCheck(check func(path ...string) error) func(o *ExecOpts) {
 	}
 }
 
+// AddGlobals makes values available as global variables in the transform script
+func AddGlobals(globals starlark.StringDict) func(o *ExecOpts) {
+	return func(o *ExecOpts) {
+		for k, v := range globals {
+			o.Globals[k] = v
+		}
+	}
+}
+
 // SetOutWriter provides a writer to record the "stderr" diagnostic output of the transform script
 func SetOutWriter(w io.Writer) func(o *ExecOpts) {
 	return func(o *ExecOpts) {
@@ -58,6 +91,44 @@ func SetOutWriter(w io.Writer) func(o *ExecOpts) {
 	}
 }
 
+// SetExecResult provides a result for ExecScript to populate with details of execution
+func SetExecResult(r *ExecResult) func(o *ExecOpts) {
+	return func(o *ExecOpts) {
+		o.Result = r
+	}
+}
+
+// SetProfile enables profiling, writing a pprof CPU profile of starlark execution
+// to w & recording timings of steps, body conversion and http requests in the
+// execution result
+func SetProfile(w io.Writer) func(o *ExecOpts) {
+	return func(o *ExecOpts) {
+		o.Profile = w
+	}
+}
+
+// SetHTTPCache caches http responses from script requests in c. Set c.Offline to
+// only serve responses from the cache
+func SetHTTPCache(c *httpcache.Cache) func(o *ExecOpts) {
+	return func(o *ExecOpts) {
+		o.HTTPCache = c
+	}
+}
+
+// AddSpecialFunc registers a special function to call before transform. Registering a
+// function with the same name as an existing special function replaces it
+func AddSpecialFunc(fn SpecialFunc) func(o *ExecOpts) {
+	return func(o *ExecOpts) {
+		for i, sf := range o.SpecialFuncs {
+			if sf.Name == fn.Name {
+				o.SpecialFuncs[i] = fn
+				return
+			}
+		}
+		o.SpecialFuncs = append(o.SpecialFuncs, fn)
+	}
+}
+
 // DefaultExecOpts applies default options to an ExecOpts pointer
 func DefaultExecOpts(o *ExecOpts) {
 	o.AllowFloat = true
@@ -66,6 +137,7 @@ func DefaultExecOpts(o *ExecOpts) {
 	o.Globals = starlark.StringDict{}
 	o.OutWriter = ioutil.Discard
 	o.ModuleLoader = DefaultModuleLoader
+	o.SpecialFuncs = []SpecialFunc{DownloadFunc}
 }
 
 type transform struct {
@@ -73,11 +145,22 @@ type transform struct {
 	next         *dataset.Dataset
 	prev         *dataset.Dataset
 	skyqri       *skyqri.Module
+	fetch        *fetch.Module
 	checkFunc    func(path ...string) error
 	globals      starlark.StringDict
 	bodyFile     qfs.File
 	stderr       io.Writer
 	moduleLoader ModuleLoader
+	specials     []SpecialFunc
+	steps        []string
+	timer        *timer
+	// http is the transport script http requests are sent to
+	http *httpcache.Transport
+	// route is the id of the http route to the script's transport, set when
+	// the script loads the http module
+	route string
+	// debugger pauses scripts that call breakpoint(), may be nil
+	debugger *Debugger
 
 	download starlark.Iterable
 }
@@ -95,8 +178,7 @@ var DefaultModuleLoader = func(thread *starlark.Thread, module string) (dict sta
 // will set transformation details, but starlark scripts can modify many parts of the dataset
 // pointer, including meta, structure, and transform. opts may provide more ways for output to
 // be produced from this function.
-func ExecScript(next, prev *dataset.Dataset, opts ...func(o *ExecOpts)) error {
-	var err error
+func ExecScript(next, prev *dataset.Dataset, opts ...func(o *ExecOpts)) (err error) {
 	if next.Transform == nil || next.Transform.ScriptFile() == nil {
 		return fmt.Errorf("no script to execute")
 	}
@@ -107,17 +189,7 @@ func ExecScript(next, prev *dataset.Dataset, opts ...func(o *ExecOpts)) error {
 		opt(o)
 	}
 
-	// hoist execution settings to resolve package settings
-	resolve.AllowFloat = o.AllowFloat
-	resolve.AllowSet = o.AllowSet
-	resolve.AllowLambda = o.AllowLambda
-	resolve.AllowNestedDef = o.AllowNestedDef
-
-	// add error func to starlark environment
-	starlark.Universe["error"] = starlark.NewBuiltin("error", Error)
-	for key, val := range o.Globals {
-		starlark.Universe[key] = val
-	}
+	hoistOpts(o)
 
 	// set transform details
 	next.Transform.Syntax = "starlark"
@@ -138,6 +210,33 @@ func ExecScript(next, prev *dataset.Dataset, opts ...func(o *ExecOpts)) error {
 		checkFunc:    o.MutateFieldCheck,
 		stderr:       o.OutWriter,
 		moduleLoader: o.ModuleLoader,
+		specials:     o.SpecialFuncs,
+		http:         newHTTPTransport(o),
+		debugger:     o.Debugger,
+	}
+	defer t.closeRoute()
+
+	if o.Profile != nil {
+		if err = starlark.StartProfile(o.Profile); err != nil {
+			return err
+		}
+		t.timer = newTimer()
+		defer func() {
+			if perr := starlark.StopProfile(); perr != nil && err == nil {
+				err = perr
+			}
+		}()
+	}
+	// fetch requests are timed, so the module is created once the timer is set
+	t.fetch = fetch.NewModule(t.client(), httpGuard)
+
+	if o.Result != nil {
+		// results are recorded for failed runs too, the timings of a failed run
+		// show where it spent its time
+		defer func() {
+			o.Result.Steps = t.steps
+			o.Result.Timings = t.timer.Timings()
+		}()
 	}
 
 	if o.Node != nil {
@@ -155,13 +254,22 @@ func ExecScript(next, prev *dataset.Dataset, opts ...func(o *ExecOpts)) error {
 		},
 	}
 
+	predeclared := t.locals()
+	var src interface{} = pipeScript
+	if o.Debugger != nil {
+		data, err := ioutil.ReadAll(pipeScript)
+		if err != nil {
+			return err
+		}
+		src = o.Debugger.instrument(pipeScript.FileName(), data)
+		predeclared[debugHookName] = starlark.NewBuiltin(debugHookName, o.Debugger.hook)
+		o.Debugger.start()
+	}
+
 	// execute the transformation
-	t.globals, err = starlark.ExecFile(thread, pipeScript.FileName(), pipeScript, t.locals())
+	t.globals, err = starlark.ExecFile(thread, pipeScript.FileName(), src, predeclared)
 	if err != nil {
-		if evalErr, ok := err.(*starlark.EvalError); ok {
-			return fmt.Errorf(evalErr.Backtrace())
-		}
-		return err
+		return newTransformError(thread, "", err)
 	}
 
 	funcs, err := t.specialFuncs()
@@ -169,38 +277,55 @@ func ExecScript(next, prev *dataset.Dataset, opts ...func(o *ExecOpts)) error {
 		return err
 	}
 
-	for name, fn := range funcs {
-		val, err := fn(t, thread, ctx)
+	if err = t.checkEntryPoints(buf.Bytes(), funcs, o.Strict); err != nil {
+		return err
+	}
 
+	for _, sf := range funcs {
+		val, err := callSpecialFunc(t, thread, ctx, sf)
 		if err != nil {
-			if evalErr, ok := err.(*starlark.EvalError); ok {
-				return fmt.Errorf(evalErr.Backtrace())
-			}
-			return err
+			return newTransformError(thread, sf.Name, err)
 		}
 
-		ctx.SetResult(name, val)
+		ctx.SetResult(sf.Name, val)
 	}
 
-	err = callTransformFunc(t, thread, ctx)
-	if evalErr, ok := err.(*starlark.EvalError); ok {
-		return fmt.Errorf(evalErr.Backtrace())
+	if err = callTransformFunc(t, thread, ctx); err != nil {
+		return newTransformError(thread, "transform", err)
 	}
 
 	// restore consumed script file
 	next.Transform.SetScriptFile(qfs.NewMemfileBytes("transform.star", buf.Bytes()))
 
-	return err
+	return nil
 }
 
-// Error halts program execution with an error
+// hoistOpts applies execution settings to package-level starlark & http settings
+func hoistOpts(o *ExecOpts) {
+	// hoist execution settings to resolve package settings
+	resolve.AllowFloat = o.AllowFloat
+	resolve.AllowSet = o.AllowSet
+	resolve.AllowLambda = o.AllowLambda
+	resolve.AllowNestedDef = o.AllowNestedDef
+
+	// add error func to starlark environment
+	starlark.Universe["error"] = starlark.NewBuiltin("error", Error)
+	for key, val := range o.Globals {
+		starlark.Universe[key] = val
+	}
+}
+
+// Error halts program execution with an error. Errors raised with Error are
+// marked as Raised when returned as a TransformError
 func Error(thread *starlark.Thread, _ *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
 	var msg starlark.Value
 	if err := starlark.UnpackPositionalArgs("error", args, kwargs, 1, &msg); err != nil {
 		return nil, err
 	}
 
-	return nil, fmt.Errorf("transform error: %s", msg)
+	err := fmt.Errorf("transform error: %s", msg)
+	thread.SetLocal(raisedKey, err)
+	return nil, err
 }
 
 // ErrNotDefined is for when a starlark value is not defined or does not exist
@@ -218,6 +343,118 @@ func (t *transform) globalFunc(name string) (fn *starlark.Function, err error) {
 	return x.(*starlark.Function), nil
 }
 
+// checkEntryPoints looks for scripts that define neither transform nor any special
+// functions, and for functions whose names look like misspellings of an entry point.
+// In strict mode problems are returned as an error, otherwise they're written to
+// the script's output as warnings
+func (t *transform) checkEntryPoints(src []byte, defined []SpecialFunc, strict bool) error {
+	names := []string{"transform"}
+	for _, sf := range t.specials {
+		names = append(names, sf.Name)
+	}
+
+	var (
+		problems []string
+		refs     map[string]bool
+	)
+	for _, name := range names {
+		if _, ok := t.globals[name]; ok {
+			continue
+		}
+		if refs == nil {
+			refs = map[string]bool{}
+			// the script has already run, so it parses
+			if f, err := syntax.Parse("", src, 0); err == nil {
+				refs = referencedNames(f)
+			}
+		}
+		if typo := t.misspelling(name, names, refs); typo != "" {
+			problems = append(problems, fmt.Sprintf("no %s function defined: found '%s', did you mean '%s'?", name, typo, name))
+		}
+	}
+
+	if _, ok := t.globals["transform"]; !ok && len(defined) == 0 && len(problems) == 0 {
+		problems = append(problems, fmt.Sprintf("script doesn't define any entry point functions, expected one of: %s", strings.Join(names, ", ")))
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	if strict {
+		return fmt.Errorf("%s", strings.Join(problems, "\n"))
+	}
+	for _, p := range problems {
+		t.print(fmt.Sprintf("⚠️  warning: %s\n", p))
+	}
+	return nil
+}
+
+// misspelling returns the name of the global function that looks like a typo of
+// name. names lists entry points, which are never misspellings of one another, and
+// functions in refs are used by the script itself, so they're helpers
+func (t *transform) misspelling(name string, names []string, refs map[string]bool) string {
+	entry := map[string]bool{}
+	for _, n := range names {
+		entry[n] = true
+	}
+
+	var candidates []string
+	for g, val := range t.globals {
+		if _, ok := val.(*starlark.Function); ok && !entry[g] && !refs[g] {
+			candidates = append(candidates, g)
+		}
+	}
+	return closestName(name, candidates)
+}
+
+// closestName returns the candidate closest to name, if it's close enough to be a
+// likely typo. returns the empty string if no candidate is close
+func closestName(name string, candidates []string) string {
+	sorted := append([]string(nil), candidates...)
+	sort.Strings(sorted)
+
+	// allow roughly one edit for every three characters
+	best, bestDist := "", len(name)/3+1
+	for _, c := range sorted {
+		if d := editDistance(strings.ToLower(name), strings.ToLower(c)); d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	return best
+}
+
+// editDistance calculates the levenshtein distance between two strings
+func editDistance(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+	prev := make([]int, len(br)+1)
+	cur := make([]int, len(br)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ar); i++ {
+		cur[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(br)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
 func confirmIterable(x starlark.Value) (starlark.Iterable, error) {
 	v, ok := x.(starlark.Iterable)
 	if !ok {
@@ -226,43 +463,125 @@ func confirmIterable(x starlark.Value) (starlark.Iterable, error) {
 	return v, nil
 }
 
-func (t *transform) specialFuncs() (defined map[string]specialFunc, err error) {
-	specialFuncs := map[string]specialFunc{
-		"download": callDownloadFunc,
-	}
+// SpecialFunc configures a script-defined function that ExecScript calls before transform.
+// Special functions are called with a single context argument. The return value of a
+// special function is placed on the context by name, eg: ctx.download
+//
+// Special functions are called in registration order, except where a function lists
+// dependencies in After, in which case it's called once all of its dependencies have
+// run. Dependencies that are registered but not defined by a script are skipped.
+// Transform is always called last
+type SpecialFunc struct {
+	Name         string   // name of the global function to call
+	AllowNetwork bool     // permit http requests while the function runs
+	AllowSecrets bool     // permit ctx.get_secret while the function runs
+	After        []string // names of special functions that must be called before this one
+}
 
-	defined = map[string]specialFunc{}
+// DownloadFunc is the default special function, and the only one that can access the network
+// unless configured otherwise
+var DownloadFunc = SpecialFunc{Name: "download", AllowNetwork: true, AllowSecrets: true}
 
-	for name, fn := range specialFuncs {
-		if _, err = t.globalFunc(name); err != nil {
+// specialFuncs returns configured special functions that are defined by the script in
+// the order they should be called
+func (t *transform) specialFuncs() (defined []SpecialFunc, err error) {
+	ordered, err := orderSpecialFuncs(t.specials)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, sf := range ordered {
+		if _, err = t.globalFunc(sf.Name); err != nil {
 			if err == ErrNotDefined {
 				err = nil
 				continue
 			}
 			return nil, err
 		}
-		defined[name] = fn
+		defined = append(defined, sf)
 	}
 
 	return
 }
 
-type specialFunc func(t *transform, thread *starlark.Thread, ctx *skyctx.Context) (result starlark.Value, err error)
+// orderSpecialFuncs sorts special functions so each function comes after its
+// dependencies, otherwise preserving registration order
+func orderSpecialFuncs(funcs []SpecialFunc) ([]SpecialFunc, error) {
+	registered := map[string]bool{}
+	for _, sf := range funcs {
+		if sf.Name == "transform" {
+			return nil, fmt.Errorf("'transform' cannot be used as a special function name")
+		}
+		if registered[sf.Name] {
+			return nil, fmt.Errorf("special function '%s' is registered more than once", sf.Name)
+		}
+		registered[sf.Name] = true
+	}
+	for _, sf := range funcs {
+		for _, dep := range sf.After {
+			if !registered[dep] {
+				return nil, fmt.Errorf("special function '%s' depends on unknown special function '%s'", sf.Name, dep)
+			}
+		}
+	}
+
+	ordered := make([]SpecialFunc, 0, len(funcs))
+	added := map[string]bool{}
+	for len(ordered) < len(funcs) {
+		progress := false
+		for _, sf := range funcs {
+			if added[sf.Name] || !depsAdded(sf, added) {
+				continue
+			}
+			ordered = append(ordered, sf)
+			added[sf.Name] = true
+			progress = true
+			// restart from the beginning to preserve registration order
+			break
+		}
+		if !progress {
+			return nil, fmt.Errorf("special functions have circular dependencies")
+		}
+	}
+
+	return ordered, nil
+}
+
+func depsAdded(sf SpecialFunc, added map[string]bool) bool {
+	for _, dep := range sf.After {
+		if !added[dep] {
+			return false
+		}
+	}
+	return true
+}
 
-func callDownloadFunc(t *transform, thread *starlark.Thread, ctx *skyctx.Context) (result starlark.Value, err error) {
-	httpGuard.EnableNtwk()
-	defer httpGuard.DisableNtwk()
-	t.print("📡 running download...\n")
+func callSpecialFunc(t *transform, thread *starlark.Thread, ctx *skyctx.Context, sf SpecialFunc) (result starlark.Value, err error) {
+	if sf.AllowNetwork {
+		httpGuard.EnableNtwk()
+		defer httpGuard.DisableNtwk()
+	}
+	if !sf.AllowSecrets {
+		ctx.DisableSecrets()
+		defer ctx.EnableSecrets()
+	}
 
-	var download *starlark.Function
-	if download, err = t.globalFunc("download"); err != nil {
+	var fn *starlark.Function
+	if fn, err = t.globalFunc(sf.Name); err != nil {
 		if err == ErrNotDefined {
 			return starlark.None, nil
 		}
 		return starlark.None, err
 	}
+	if sf.AllowNetwork {
+		t.print(fmt.Sprintf("📡 running %s...\n", sf.Name))
+	} else {
+		t.print(fmt.Sprintf("🤖  running %s...\n", sf.Name))
+	}
+	t.steps = append(t.steps, sf.Name)
+	defer t.timer.since(sf.Name, time.Now())
 
-	return starlark.Call(thread, download, starlark.Tuple{ctx.Struct()}, nil)
+	return starlark.Call(thread, fn, starlark.Tuple{ctx.Struct()}, nil)
 }
 
 func callTransformFunc(t *transform, thread *starlark.Thread, ctx *skyctx.Context) (err error) {
@@ -274,9 +593,16 @@ func callTransformFunc(t *transform, thread *starlark.Thread, ctx *skyctx.Contex
 		return err
 	}
 	t.print("🤖  running transform...\n")
+	t.steps = append(t.steps, "transform")
+	defer t.timer.since("transform", time.Now())
 
 	d := skyds.NewDataset(t.prev, t.checkFunc)
 	d.SetMutable(t.next)
+	d.SetVersionLoader(t.loadVersion)
+	d.SetBodyOpener(t.bodyOpener())
+	if t.timer != nil {
+		d.SetTimingFunc(t.timer.record)
+	}
 	if _, err = starlark.Call(thread, transform, starlark.Tuple{d.Methods(), ctx.Struct()}, nil); err != nil {
 		return err
 	}
@@ -297,6 +623,7 @@ func (t *transform) print(msg string) {
 func (t *transform) locals() starlark.StringDict {
 	return starlark.StringDict{
 		"load_dataset": starlark.NewBuiltin("load_dataset", t.LoadDataset),
+		"breakpoint":   starlark.NewBuiltin("breakpoint", t.debugger.Breakpoint),
 	}
 }
 
@@ -305,12 +632,53 @@ func (t *transform) ModuleLoader(thread *starlark.Thread, module string) (dict s
 	if module == skyqri.ModuleName && t.skyqri != nil {
 		return t.skyqri.Namespace(), nil
 	}
+	if module == fetch.ModuleName && t.fetch != nil {
+		return t.fetch.Namespace(), nil
+	}
 
 	if t.moduleLoader == nil {
 		return nil, fmt.Errorf("couldn't load module: %s", module)
 	}
 
-	return t.moduleLoader(thread, module)
+	dict, err = t.moduleLoader(thread, module)
+	if err == nil && module == starhttp.ModuleName {
+		dict = t.routeHTTP(dict)
+	}
+	return dict, err
+}
+
+// transport gives the transport script http requests are sent to, timing
+// requests if the script is profiled
+func (t *transform) transport() http.RoundTripper {
+	if t.timer != nil {
+		return &timingTransport{Base: t.http, timer: t.timer}
+	}
+	return t.http
+}
+
+// client creates a client that sends requests to the script's transport
+func (t *transform) client() *http.Client {
+	if t.http == nil {
+		return nil
+	}
+	return &http.Client{Transport: t.transport()}
+}
+
+// routeHTTP sends requests made by the builtins of the starlib http module to
+// the script's transport. the route is closed by closeRoute
+func (t *transform) routeHTTP(ns starlark.StringDict) starlark.StringDict {
+	if t.http == nil {
+		return ns
+	}
+	if t.route == "" {
+		t.route = httpRoute.add(t.transport())
+	}
+	return routeModule(ns, t.route)
+}
+
+// closeRoute stops routing requests to the script's transport
+func (t *transform) closeRoute() {
+	httpRoute.remove(t.route)
 }
 
 // LoadDataset is a function
@@ -325,7 +693,11 @@ func (t *transform) LoadDataset(thread *starlark.Thread, _ *starlark.Builtin, ar
 		return starlark.None, err
 	}
 
-	return skyds.NewDataset(ds, nil).Methods(), nil
+	d := skyds.NewDataset(ds, nil)
+	if t.timer != nil {
+		d.SetTimingFunc(t.timer.record)
+	}
+	return d.Methods(), nil
 }
 
 func (t *transform) loadDataset(refstr string) (*dataset.Dataset, error) {
@@ -333,30 +705,79 @@ func (t *transform) loadDataset(refstr string) (*dataset.Dataset, error) {
 		return nil, fmt.Errorf("no qri node available to load dataset: %s", refstr)
 	}
 
-	ref, err := repo.ParseDatasetRef(refstr)
+	ds, ref, err := loadRef(t.node, refstr)
 	if err != nil {
 		return nil, err
 	}
-	if err := repo.CanonicalizeDatasetRef(t.node.Repo, &ref); err != nil {
-		return nil, err
+
+	if t.next.Transform.Resources == nil {
+		t.next.Transform.Resources = map[string]*dataset.TransformResource{}
 	}
-	t.node.LocalStreams.PrintErr(fmt.Sprintf("load: %s\n", ref.String()))
+	t.next.Transform.Resources[ref.Path] = &dataset.TransformResource{Path: ref.String()}
 
-	ds, err := dsfs.LoadDataset(t.node.Repo.Store(), ref.Path)
+	return ds, nil
+}
+
+// LoadRef loads a dataset from a qri node by reference, with an open body file.
+// Use it to give NewREPL a previous version of a dataset from a node
+func LoadRef(node *p2p.QriNode, refstr string) (*dataset.Dataset, error) {
+	if node == nil {
+		return nil, fmt.Errorf("no qri node available to load dataset: %s", refstr)
+	}
+	ds, _, err := loadRef(node, refstr)
+	return ds, err
+}
+
+func loadRef(node *p2p.QriNode, refstr string) (*dataset.Dataset, repo.DatasetRef, error) {
+	ref, err := repo.ParseDatasetRef(refstr)
 	if err != nil {
-		return nil, err
+		return nil, ref, err
+	}
+	if err := repo.CanonicalizeDatasetRef(node.Repo, &ref); err != nil {
+		return nil, ref, err
+	}
+	node.LocalStreams.PrintErr(fmt.Sprintf("load: %s\n", ref.String()))
+
+	ds, err := dsfs.LoadDataset(node.Repo.Store(), ref.Path)
+	if err != nil {
+		return nil, ref, err
 	}
 
 	if ds.BodyFile() == nil {
-		if err = ds.OpenBodyFile(t.node.Repo.Filesystem()); err != nil {
-			return nil, err
+		if err = ds.OpenBodyFile(node.Repo.Filesystem()); err != nil {
+			return nil, ref, err
 		}
 	}
+	return ds, ref, nil
+}
 
-	if t.next.Transform.Resources == nil {
-		t.next.Transform.Resources = map[string]*dataset.TransformResource{}
+// loadVersion loads a previous version of the dataset being transformed by path
+func (t *transform) loadVersion(path string) (*dataset.Dataset, error) {
+	if t.node == nil {
+		return nil, fmt.Errorf("no qri node available to load dataset version: %s", path)
+	}
+
+	ds, err := dsfs.LoadDataset(t.node.Repo.Store(), path)
+	if err != nil {
+		return nil, err
+	}
+
+	if ds.BodyFile() == nil && ds.BodyPath != "" {
+		if err = ds.OpenBodyFile(t.node.Repo.Filesystem()); err != nil {
+			return nil, err
+		}
 	}
-	t.next.Transform.Resources[ref.Path] = &dataset.TransformResource{Path: ref.String()}
 
 	return ds, nil
 }
+
+// bodyOpener gives a function that reopens dataset bodies from the qri node's
+// filesystem, or nil if there's no node to open bodies with
+func (t *transform) bodyOpener() skyds.BodyOpener {
+	if t.node == nil {
+		return nil
+	}
+	return func(ds *dataset.Dataset) error {
+		return ds.OpenBodyFile(t.node.Repo.Filesystem())
+	}
+}
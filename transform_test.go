@@ -2,9 +2,11 @@ package startf
 
 import (
 	"bytes"
+	"encoding/json"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/qri-io/dataset"
@@ -14,6 +16,7 @@ import (
 	"github.com/qri-io/qri/p2p"
 	repoTest "github.com/qri-io/qri/repo/test"
 	"github.com/qri-io/starlib"
+	"github.com/qri-io/startf/httpfixture"
 	"go.starlark.net/starlark"
 	"go.starlark.net/starlarktest"
 )
@@ -73,6 +76,60 @@ hello world!`
 	}
 }
 
+func TestExecScriptObjectBody(t *testing.T) {
+	prev := &dataset.Dataset{
+		Structure: &dataset.Structure{Format: "json", Schema: dataset.BaseSchemaObject},
+	}
+	prev.SetBodyFile(qfs.NewMemfileBytes("body.json", []byte(`{"a":1,"b":2}`)))
+
+	ds := &dataset.Dataset{
+		Transform: &dataset.Transform{},
+	}
+	ds.Transform.SetScriptFile(scriptFile(t, "testdata/object_body.star"))
+	if err := ExecScript(ds, prev, SetOutWriter(ioutil.Discard)); err != nil {
+		t.Fatal(err)
+	}
+
+	if tlt, err := dsio.GetTopLevelType(ds.Structure); err != nil || tlt != "object" {
+		t.Fatalf("expected an object body structure, got: %q, %v", tlt, err)
+	}
+	r, err := dsio.NewEntryReader(ds.Structure, ds.BodyFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := map[string]interface{}{}
+	err = dsio.EachEntry(r, func(_ int, e dsio.Entry, err error) error {
+		if err != nil {
+			return err
+		}
+		body[e.Key] = e.Value
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `{"a":2,"a_entry":1,"b":3,"nested":{"inner":{"x":[1,{"y":2}]}},"stats":{"entries":2,"length":13}}`
+	if string(data) != expect {
+		t.Errorf("body mismatch.\nexpected: %s\ngot:      %s", expect, data)
+	}
+}
+
+func TestExecScriptObjectBodyKeys(t *testing.T) {
+	ds := &dataset.Dataset{
+		Transform: &dataset.Transform{},
+	}
+	ds.Transform.SetScriptFile(scriptFile(t, "testdata/object_body_keys.star"))
+	err := ExecScript(ds, nil, SetOutWriter(ioutil.Discard))
+	if err == nil || !strings.Contains(err.Error(), `key "a": dict keys must be strings, got int: 1`) {
+		t.Errorf("expected a key type error, got: %v", err)
+	}
+}
+
 func TestExecScript2(t *testing.T) {
 
 	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -96,6 +153,154 @@ func TestExecScript2(t *testing.T) {
 	}
 }
 
+func TestExecScriptHTTPFixture(t *testing.T) {
+	s := httpfixture.NewServer([]*httpfixture.Route{
+		{Path: "/", Body: `{"foo":["bar","baz","bat"]}`},
+	})
+	defer s.Close()
+
+	ds := &dataset.Dataset{
+		Transform: &dataset.Transform{},
+	}
+	ds.Transform.SetScriptFile(scriptFile(t, "testdata/fetch.star"))
+	if err := ExecScript(ds, nil, AddGlobals(s.Globals())); err != nil {
+		t.Fatal(err)
+	}
+	s.AssertAllRoutesHit(t)
+}
+
+func TestSpecialFuncs(t *testing.T) {
+	validate := SpecialFunc{Name: "validate", After: []string{"download"}}
+	secrets := map[string]interface{}{"api_key": "secret"}
+
+	ds := &dataset.Dataset{
+		Transform: &dataset.Transform{},
+	}
+	ds.Transform.SetScriptFile(scriptFile(t, "testdata/special_funcs.star"))
+	stderr := &bytes.Buffer{}
+	res := &ExecResult{}
+	// publish isn't defined by the script, so it isn't run or reported
+	publish := SpecialFunc{Name: "publish", After: []string{"validate"}}
+	err := ExecScript(ds, nil, AddSpecialFunc(validate), AddSpecialFunc(publish), SetOutWriter(stderr), SetExecResult(res), func(o *ExecOpts) {
+		o.Secrets = secrets
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := strings.Join(res.Steps, ",")
+	if steps != "download,validate,transform" {
+		t.Errorf("steps mismatch. expected: 'download,validate,transform', got: '%s'", steps)
+	}
+
+	expect := "📡 running download...\n🤖  running validate...\n🤖  running transform...\n"
+	if stderr.String() != expect {
+		t.Errorf("stderr mismatch. expected: '%s', got: '%s'", expect, stderr.String())
+	}
+
+	data, _ := ioutil.ReadAll(ds.BodyFile())
+	if string(data) != "[true]" {
+		t.Errorf("body mismatch. expected: '[true]', got: '%s'", string(data))
+	}
+
+	ds = &dataset.Dataset{
+		Transform: &dataset.Transform{
+			Config: map[string]interface{}{"read_secret": true},
+		},
+	}
+	ds.Transform.SetScriptFile(scriptFile(t, "testdata/special_funcs.star"))
+	err = ExecScript(ds, nil, AddSpecialFunc(validate), func(o *ExecOpts) {
+		o.Secrets = secrets
+	})
+	if err == nil || !strings.Contains(err.Error(), "secrets are not available in this step") {
+		t.Errorf("expected secrets error, got: %v", err)
+	}
+
+	ds.Transform.SetScriptFile(scriptFile(t, "testdata/special_funcs.star"))
+	err = ExecScript(ds, nil, AddSpecialFunc(SpecialFunc{Name: "transform"}))
+	if err == nil {
+		t.Errorf("expected registering 'transform' as a special function to error")
+	}
+}
+
+func TestEntryPoints(t *testing.T) {
+	cases := []struct {
+		script string
+		strict bool
+		err    string
+		warn   string
+	}{
+		{"def transform(ds, ctx):\n  pass\n", true, "", ""},
+		{"def download(ctx):\n  return [1]\n", true, "", ""},
+		{"def transfrom(ds, ctx):\n  pass\n", true, "no transform function defined: found 'transfrom', did you mean 'transform'?", ""},
+		{"def Transform(ds, ctx):\n  pass\n", true, "no transform function defined: found 'Transform', did you mean 'transform'?", ""},
+		{"def downlod(ctx):\n  return [1]\ndef transform(ds, ctx):\n  pass\n", true, "no download function defined: found 'downlod', did you mean 'download'?", ""},
+		{"x = 1\n", true, "script doesn't define any entry point functions, expected one of: transform, download", ""},
+		// helpers the script calls aren't misspelled special functions
+		{"def downloads(url):\n  return [url]\ndef transform(ds, ctx):\n  ds.set_body(downloads('a'))\n", true, "", ""},
+		{"def downloads(url):\n  return [url]\ndef transform(ds, ctx):\n  pass\n", true, "no download function defined: found 'downloads', did you mean 'download'?", ""},
+		{"def transfrom(ds, ctx):\n  pass\n", false, "", "⚠️  warning: no transform function defined: found 'transfrom', did you mean 'transform'?\n"},
+		{"x = 1\n", false, "", "⚠️  warning: script doesn't define any entry point functions, expected one of: transform, download\n"},
+	}
+
+	for i, c := range cases {
+		ds := &dataset.Dataset{Transform: &dataset.Transform{}}
+		ds.Transform.SetScriptFile(qfs.NewMemfileBytes("transform.star", []byte(c.script)))
+		stderr := &bytes.Buffer{}
+		err := ExecScript(ds, nil, SetOutWriter(stderr), func(o *ExecOpts) {
+			o.Strict = c.strict
+		})
+		if c.err == "" && err != nil {
+			t.Errorf("case %d unexpected error: %s", i, err)
+			continue
+		}
+		if c.err != "" && (err == nil || err.Error() != c.err) {
+			t.Errorf("case %d error mismatch. expected: %q, got: %v", i, c.err, err)
+			continue
+		}
+		if c.warn != "" && !strings.Contains(stderr.String(), c.warn) {
+			t.Errorf("case %d expected warning %q, got output: %q", i, c.warn, stderr.String())
+		}
+	}
+}
+
+func TestOrderSpecialFuncs(t *testing.T) {
+	cases := []struct {
+		funcs  []SpecialFunc
+		expect string
+		err    string
+	}{
+		{[]SpecialFunc{{Name: "a"}, {Name: "b"}, {Name: "c"}}, "a,b,c", ""},
+		{[]SpecialFunc{{Name: "a", After: []string{"c"}}, {Name: "b"}, {Name: "c"}}, "b,c,a", ""},
+		{[]SpecialFunc{{Name: "a", After: []string{"b"}}, {Name: "b", After: []string{"c"}}, {Name: "c"}}, "c,b,a", ""},
+		{[]SpecialFunc{{Name: "a", After: []string{"b"}}, {Name: "b", After: []string{"a"}}}, "", "special functions have circular dependencies"},
+		{[]SpecialFunc{{Name: "a", After: []string{"z"}}}, "", "special function 'a' depends on unknown special function 'z'"},
+		{[]SpecialFunc{{Name: "a"}, {Name: "a"}}, "", "special function 'a' is registered more than once"},
+		{[]SpecialFunc{{Name: "transform"}}, "", "'transform' cannot be used as a special function name"},
+	}
+
+	for i, c := range cases {
+		got, err := orderSpecialFuncs(c.funcs)
+		if c.err != "" {
+			if err == nil || err.Error() != c.err {
+				t.Errorf("case %d error mismatch. expected: '%s', got: '%v'", i, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %d unexpected error: %s", i, err)
+			continue
+		}
+		names := make([]string, len(got))
+		for j, sf := range got {
+			names[j] = sf.Name
+		}
+		if strings.Join(names, ",") != c.expect {
+			t.Errorf("case %d order mismatch. expected: '%s', got: '%s'", i, c.expect, strings.Join(names, ","))
+		}
+	}
+}
+
 func TestLoadDataset(t *testing.T) {
 	node := testQriNode(t)
 